@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"device-monitor-go/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReloadConfig handles POST /api/admin/reload, the HTTP equivalent of
+// sending the server SIGHUP
+func ReloadConfig(c *gin.Context) {
+	result, err := services.ReloadConfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// CreateBackup handles POST /api/admin/backup?compress=true, backing up the
+// live database into the configured backup directory
+func CreateBackup(c *gin.Context) {
+	compress := config.Current().BackupCompress
+	if v := c.Query("compress"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid compress, expected true or false",
+			})
+			return
+		}
+		compress = parsed
+	}
+
+	backup, err := services.RunBackup(config.Current().BackupDir, compress)
+	if err != nil {
+		if errors.Is(err, database.ErrBackupUnsupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to back up database: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    backup,
+	})
+}
+
+// GetBackups handles GET /api/admin/backups, newest first
+func GetBackups(c *gin.Context) {
+	backups, err := database.ListBackups(config.Current().BackupDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list backups: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    backups,
+	})
+}
+
+// GetRetention handles GET /api/admin/retention, returning the IoT data
+// retention policies
+func GetRetention(c *gin.Context) {
+	policies, err := services.RetentionPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policies,
+	})
+}
+
+// CompactTelemetry handles POST /api/admin/retention/compact, applying the
+// retention policies immediately
+func CompactTelemetry(c *gin.Context) {
+	result, err := services.CompactTelemetry(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to compact telemetry: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"database/sql"
+	"device-monitor-go/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// annotationRequest is the body of annotation create and update requests
+type annotationRequest struct {
+	Kind       string `json:"kind"`
+	Body       string `json:"body"`
+	MarkerTime string `json:"marker_time"`
+	Author     string `json:"author"`
+}
+
+// tagRequest is the body of tag vocabulary create and update requests
+type tagRequest struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// GetSessionAnnotations handles GET /api/sessions/:id/annotations
+func GetSessionAnnotations(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	annotations, err := models.GetSessionAnnotations(session.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get annotations: " + err.Error(),
+		})
+		return
+	}
+	for _, a := range annotations {
+		a.In(loc)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    annotations,
+	})
+}
+
+// CreateSessionAnnotation handles POST /api/sessions/:id/annotations
+func CreateSessionAnnotation(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	var req annotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	annotation := &models.SessionAnnotation{
+		SessionID: session.SessionID,
+		Kind:      req.Kind,
+		Author:    requestAuthor(c, req.Author),
+	}
+	if annotation.Kind == "" {
+		annotation.Kind = models.AnnotationNote
+	}
+	if !applyAnnotationRequest(c, annotation, req, session) {
+		return
+	}
+
+	if err := models.CreateAnnotation(annotation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create annotation: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    annotation,
+	})
+}
+
+// UpdateSessionAnnotation handles PUT /api/sessions/:id/annotations/:annotationId
+func UpdateSessionAnnotation(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	annotation, ok := loadAnnotation(c, session.SessionID)
+	if !ok {
+		return
+	}
+
+	var req annotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Kind != "" {
+		annotation.Kind = req.Kind
+	}
+	if req.Author != "" || c.GetHeader("X-User") != "" {
+		annotation.Author = requestAuthor(c, req.Author)
+	}
+	if !applyAnnotationRequest(c, annotation, req, session) {
+		return
+	}
+
+	if err := models.UpdateAnnotation(annotation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update annotation: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    annotation,
+	})
+}
+
+// DeleteSessionAnnotation handles DELETE /api/sessions/:id/annotations/:annotationId
+func DeleteSessionAnnotation(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("annotationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid annotation id",
+		})
+		return
+	}
+
+	if err := models.DeleteAnnotation(session.SessionID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Annotation not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete annotation: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Annotation deleted successfully",
+	})
+}
+
+// GetSessionTags handles GET /api/sessions/:id/tags
+func GetSessionTags(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	tags, err := models.GetSessionTags(session.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get session tags: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tags,
+	})
+}
+
+// AddSessionTag handles POST /api/sessions/:id/tags with {"tag": "...", "author": "..."}
+func AddSessionTag(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Tag    string `json:"tag"`
+		Author string `json:"author"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if err := models.AddSessionTag(session.SessionID, req.Tag, requestAuthor(c, req.Author)); err != nil {
+		if errors.Is(err, models.ErrUnknownTag) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to tag session: " + err.Error(),
+		})
+		return
+	}
+
+	GetSessionTags(c)
+}
+
+// RemoveSessionTag handles DELETE /api/sessions/:id/tags/:tag
+func RemoveSessionTag(c *gin.Context) {
+	session, ok := loadSession(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveSessionTag(session.SessionID, c.Param("tag")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Tag not assigned to session",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to remove tag: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tag removed successfully",
+	})
+}
+
+// GetTags handles GET /api/tags
+func GetTags(c *gin.Context) {
+	tags, err := models.GetTags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get tags: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tags,
+	})
+}
+
+// CreateTag handles POST /api/tags
+func CreateTag(c *gin.Context) {
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	tag := &models.Tag{Name: req.Name, Color: req.Color, Description: req.Description}
+	if err := models.CreateTag(tag); err != nil {
+		respondTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    tag,
+	})
+}
+
+// UpdateTag handles PUT /api/tags/:tagId
+func UpdateTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid tag id",
+		})
+		return
+	}
+
+	tag, err := models.GetTagByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Tag not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get tag: " + err.Error(),
+		})
+		return
+	}
+
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	if req.Name != "" {
+		tag.Name = req.Name
+	}
+	tag.Color = req.Color
+	tag.Description = req.Description
+
+	if err := models.UpdateTag(tag); err != nil {
+		respondTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tag,
+	})
+}
+
+// DeleteTag handles DELETE /api/tags/:tagId
+func DeleteTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid tag id",
+		})
+		return
+	}
+
+	if err := models.DeleteTag(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Tag not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete tag: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tag deleted successfully",
+	})
+}
+
+// respondTagError maps tag validation and uniqueness failures to 400
+func respondTagError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrInvalidTag) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, models.ErrTagExists) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A tag with this name already exists",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "Failed to save tag: " + err.Error(),
+	})
+}
+
+// applyAnnotationRequest copies body and marker time from the request and
+// validates the result, responding with 400 on failure
+func applyAnnotationRequest(c *gin.Context, annotation *models.SessionAnnotation, req annotationRequest, session *models.DeviceSession) bool {
+	if req.Body != "" {
+		annotation.Body = req.Body
+	}
+
+	if req.MarkerTime != "" {
+		t, err := parseWebhookTime(req.MarkerTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid marker_time: " + err.Error(),
+			})
+			return false
+		}
+		annotation.MarkerTime = &t
+	} else if annotation.Kind == models.AnnotationNote {
+		annotation.MarkerTime = nil
+	}
+
+	if err := annotation.Validate(session); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// requestAuthor returns the author from the request body, falling back to
+// the X-User header set by an authenticating proxy
+func requestAuthor(c *gin.Context, author string) string {
+	if author != "" {
+		return author
+	}
+	return c.GetHeader("X-User")
+}
+
+// loadSession loads the session referenced in the URL
+func loadSession(c *gin.Context) (*models.DeviceSession, bool) {
+	session, err := models.GetSessionByID(requestTenant(c).ID, c.Param("id"))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Session not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get session: " + err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return session, true
+}
+
+// loadAnnotation loads the annotation referenced in the URL
+func loadAnnotation(c *gin.Context, sessionID string) (*models.SessionAnnotation, bool) {
+	id, err := strconv.Atoi(c.Param("annotationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid annotation id",
+		})
+		return nil, false
+	}
+
+	annotation, err := models.GetAnnotationByID(sessionID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Annotation not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get annotation: " + err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return annotation, true
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"device-monitor-go/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCompareInterval = 60
+	maxCompareSessions     = 10
+	maxCompareGridPoints   = 5000
+)
+
+// compareSample is a single value positioned relative to its session start
+type compareSample struct {
+	Offset float64
+	Value  float64
+}
+
+// CompareSessions handles GET /api/sessions/compare?ids=a,b,c
+func CompareSessions(c *gin.Context) {
+	ids := []string{}
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least two session ids are required",
+		})
+		return
+	}
+	if len(ids) > maxCompareSessions {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Too many sessions to compare (max " + strconv.Itoa(maxCompareSessions) + ")",
+		})
+		return
+	}
+
+	interval := defaultCompareInterval
+	if v := c.Query("interval"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid interval",
+			})
+			return
+		}
+		interval = i
+	}
+
+	// Load sessions and their IoT data through the same path as the report
+	sessions := make([]*models.DeviceSession, 0, len(ids))
+	aggregated := make([]map[string]interface{}, 0, len(ids))
+	var maxDuration float64
+	for _, id := range ids {
+		session, err := models.GetSessionByID(requestTenant(c).ID, id)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Session not found: " + id,
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to get session: " + err.Error(),
+				})
+			}
+			return
+		}
+
+		_, data := buildSessionIotData(c, session)
+		sessions = append(sessions, session)
+		aggregated = append(aggregated, data)
+
+		if d := sessionSpan(session).Seconds(); d > maxDuration {
+			maxDuration = d
+		}
+	}
+
+	// Common grid of offsets (seconds since start)
+	gridSize := int(math.Floor(maxDuration/float64(interval))) + 1
+	if gridSize > maxCompareGridPoints {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Interval too small for the selected sessions",
+		})
+		return
+	}
+	offsets := make([]int, gridSize)
+	for i := range offsets {
+		offsets[i] = i * interval
+	}
+
+	// Collect the union of point names across all sessions
+	pointNames := []string{}
+	seen := map[string]bool{}
+	for _, data := range aggregated {
+		for name := range data {
+			if !seen[name] {
+				seen[name] = true
+				pointNames = append(pointNames, name)
+			}
+		}
+	}
+
+	baseline := sessions[0].SessionID
+	points := gin.H{}
+	for _, name := range pointNames {
+		series := gin.H{}
+		summaries := gin.H{}
+		unit := ""
+		var baseSummary gin.H
+
+		for i, session := range sessions {
+			entry, ok := aggregated[i][name].(gin.H)
+			if !ok {
+				series[session.SessionID] = make([]*float64, gridSize)
+				summaries[session.SessionID] = nil
+				continue
+			}
+
+			summary, _ := entry["summary"].(gin.H)
+			if u, ok := summary["unit"].(string); ok && unit == "" {
+				unit = u
+			}
+
+			samples := extractSamples(entry["timeSeries"], session.StartTime)
+			series[session.SessionID] = resampleSeries(samples, interval, gridSize)
+			summaries[session.SessionID] = summary
+			if i == 0 {
+				baseSummary = summary
+			}
+		}
+
+		// Only numeric points can be overlaid
+		if !hasNumericSeries(series) {
+			continue
+		}
+
+		deltas := gin.H{}
+		for _, session := range sessions[1:] {
+			summary, _ := summaries[session.SessionID].(gin.H)
+			deltas[session.SessionID] = summaryDelta(baseSummary, summary)
+		}
+
+		points[name] = gin.H{
+			"unit":      unit,
+			"series":    series,
+			"summaries": summaries,
+			"deltas":    deltas,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"baseline": baseline,
+			"interval": interval,
+			"offsets":  offsets,
+			"sessions": sessions,
+			"points":   points,
+		},
+	})
+}
+
+// sessionSpan returns how long a session ran, or has been running so far
+func sessionSpan(session *models.DeviceSession) time.Duration {
+	if session.EndTime != nil {
+		return session.EndTime.Sub(session.StartTime)
+	}
+	return time.Since(session.StartTime)
+}
+
+// extractSamples converts a report time series into offsets relative to start
+func extractSamples(timeSeries interface{}, start time.Time) []compareSample {
+	samples := []compareSample{}
+
+	add := func(bucket interface{}, value interface{}) {
+		t, ok := parseBucketTime(bucket)
+		if !ok {
+			return
+		}
+		v, ok := toFloat(value)
+		if !ok {
+			return
+		}
+		offset := t.Sub(start).Seconds()
+		if offset < 0 {
+			return
+		}
+		samples = append(samples, compareSample{Offset: offset, Value: v})
+	}
+
+	switch series := timeSeries.(type) {
+	case []gin.H:
+		for _, item := range series {
+			add(item["time_bucket"], item["avg_value"])
+		}
+	case []models.IotTimeSeries:
+		for _, item := range series {
+			add(item.TimeBucket, item.AvgValue)
+		}
+	}
+
+	return samples
+}
+
+// resampleSeries averages samples into fixed-width buckets; empty buckets are nil
+func resampleSeries(samples []compareSample, interval, gridSize int) []*float64 {
+	sums := make([]float64, gridSize)
+	counts := make([]int, gridSize)
+
+	for _, s := range samples {
+		idx := int(s.Offset) / interval
+		if idx >= gridSize {
+			continue
+		}
+		sums[idx] += s.Value
+		counts[idx]++
+	}
+
+	result := make([]*float64, gridSize)
+	for i := range result {
+		if counts[i] > 0 {
+			avg := sums[i] / float64(counts[i])
+			result[i] = &avg
+		}
+	}
+	return result
+}
+
+// summaryDelta returns the difference of a summary against the baseline
+func summaryDelta(base, other gin.H) gin.H {
+	if base == nil || other == nil {
+		return nil
+	}
+
+	delta := gin.H{}
+	for _, key := range []string{"count", "min_value", "max_value", "avg_value"} {
+		b, ok1 := toFloat(base[key])
+		o, ok2 := toFloat(other[key])
+		if ok1 && ok2 {
+			delta[key] = o - b
+		}
+	}
+	return delta
+}
+
+// hasNumericSeries reports whether any resampled series holds a value
+func hasNumericSeries(series gin.H) bool {
+	for _, s := range series {
+		values, _ := s.([]*float64)
+		for _, v := range values {
+			if v != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseBucketTime parses the time_bucket formats used by report series
+func parseBucketTime(bucket interface{}) (time.Time, bool) {
+	s, ok := bucket.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toFloat converts the loosely typed values found in IoT data to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
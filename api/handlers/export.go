@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"device-monitor-go/models"
+	"device-monitor-go/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportSample is a single timestamped value of one data point; Unit is
+// empty when the point's configured unit applies
+type exportSample struct {
+	Time  time.Time
+	Value interface{}
+	Unit  string
+}
+
+// ExportSession handles GET /api/sessions/:id/export?format=csv|xlsx|parquet&layout=wide|long
+func ExportSession(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
+	layout := c.DefaultQuery("layout", "wide")
+	if layout != "wide" && layout != "long" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid layout, expected wide or long",
+		})
+		return
+	}
+
+	session, err := models.GetSessionByID(requestTenant(c).ID, sessionID)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Session not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get session: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	configured := models.GetIotDataPoints()
+	pointTypes := map[string]string{}
+	units := map[string]string{}
+	for _, dp := range configured {
+		pointTypes[dp.Name] = dp.Type
+		units[dp.Name] = dp.Unit
+	}
+
+	source, pointNames := sessionExportSource(c, session, pointTypes)
+
+	// Keep points in the configured order, followed by anything unknown
+	ordered := []string{}
+	for _, dp := range configured {
+		if pointNames[dp.Name] {
+			ordered = append(ordered, dp.Name)
+		}
+	}
+	extra := []string{}
+	for name := range pointNames {
+		if _, ok := pointTypes[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	ordered = append(ordered, extra...)
+
+	writer, err := startExport(c, format, fmt.Sprintf("session-%s", sessionID))
+	if err != nil {
+		return
+	}
+
+	if layout == "long" {
+		err = writeLongExport(writer, source, ordered, units, pointTypes)
+	} else {
+		err = writeWideExport(writer, source, ordered, pointTypes)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Headers are already sent, so the best we can do is log and abort
+		log.Printf("Failed to export session %s: %v", sessionID, err)
+		c.Abort()
+	}
+}
+
+// ExportSessions handles GET /api/sessions/export?format=csv|xlsx|parquet
+// It exports the session list using the same filters as GET /api/sessions
+func ExportSessions(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	filter, ok := sessionFilter(c, loc)
+	if !ok {
+		return
+	}
+
+	columns := []services.ExportColumn{
+		{Name: "session_id", Kind: services.ExportString},
+		{Name: "device_id", Kind: services.ExportString},
+		{Name: "status", Kind: services.ExportString},
+		{Name: "start_time", Kind: services.ExportString},
+		{Name: "end_time", Kind: services.ExportString},
+		{Name: "duration", Kind: services.ExportNumber},
+		{Name: "metadata", Kind: services.ExportString},
+	}
+
+	// The response starts with the first row, so filter errors are still
+	// reported as JSON
+	var writer services.TableWriter
+	start := func() error {
+		w, err := startExport(c, format, "sessions")
+		if err != nil {
+			return err
+		}
+		writer = w
+		return writer.WriteHeader(columns)
+	}
+
+	err := models.EachSession(filter, func(s *models.DeviceSession) error {
+		if writer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		var endTime, duration, metadata interface{}
+		s.In(loc)
+		if s.EndTime != nil {
+			endTime = *s.EndTime
+		}
+		if s.DurationInt != nil {
+			duration = float64(*s.DurationInt)
+		}
+		if s.MetadataObj != nil {
+			if data, jsonErr := json.Marshal(s.MetadataObj); jsonErr == nil {
+				metadata = string(data)
+			}
+		}
+
+		return writer.WriteRow([]interface{}{
+			s.SessionID, s.DeviceID, s.Status, s.StartTime, endTime, duration, metadata,
+		})
+	})
+	if err != nil && writer == nil {
+		if errors.Is(err, models.ErrInvalidDate) || errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get sessions: " + err.Error(),
+			})
+		}
+		return
+	}
+	if err == nil && writer == nil {
+		err = start()
+	}
+
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Printf("Failed to export sessions: %v", err)
+		c.Abort()
+	}
+}
+
+// exportFormat reads and validates the format query parameter
+func exportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", services.ExportFormatCSV)
+	switch format {
+	case services.ExportFormatCSV, services.ExportFormatXLSX, services.ExportFormatParquet:
+		return format, true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "Invalid format, expected csv, xlsx or parquet",
+	})
+	return "", false
+}
+
+// startExport sets download headers and returns a writer bound to the response
+func startExport(c *gin.Context, format, name string) (services.TableWriter, error) {
+	writer, err := services.NewTableWriter(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, err
+	}
+
+	c.Header("Content-Type", services.ExportContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	c.Status(http.StatusOK)
+	return writer, nil
+}
+
+// exportSource yields the time series of the points of an exported session
+type exportSource interface {
+	// eachSample calls fn with the samples of one point in time order
+	eachSample(name string, fn func(exportSample) error) error
+	// eachRow calls fn with the samples of all points at each timestamp, in
+	// time order; several samples of a point at one timestamp keep the last
+	eachRow(fn func(t time.Time, values map[string]interface{}) error) error
+}
+
+// sessionExportSource returns the source of a session's export and the names
+// of its points. Stored telemetry is read from the database as it is
+// written out; a session without any is synced from the IoT platform, whose
+// response is already held in memory.
+func sessionExportSource(c *gin.Context, session *models.DeviceSession, pointTypes map[string]string) (exportSource, map[string]bool) {
+	names := map[string]bool{}
+	points, err := models.GetIotDataPointNames(session.SessionID)
+	if err == nil && len(points) > 0 {
+		for _, p := range points {
+			names[p.PointName] = true
+		}
+		return telemetryExport{sessionID: session.SessionID, pointTypes: pointTypes}, names
+	}
+
+	_, aggregatedData := buildSessionIotData(c, session)
+	series := memoryExport{}
+	for name, data := range aggregatedData {
+		entry, _ := data.(gin.H)
+		names[name] = true
+		series[name] = exportSeries(entry["timeSeries"], pointTypes[name] == "number")
+	}
+	return series, names
+}
+
+// telemetryExport streams a session's stored samples: raw points with
+// their own timestamps, units and values, and rollup averages where the raw
+// points have expired
+type telemetryExport struct {
+	sessionID  string
+	pointTypes map[string]string
+}
+
+// value returns a sample's number for numeric points and its raw text for
+// others, falling back to whichever of the two the sample has
+func (t telemetryExport) value(s models.IotSample) interface{} {
+	numeric := t.pointTypes[s.PointName] == "number"
+	switch {
+	case s.Value != nil && (numeric || s.RawData == ""):
+		return *s.Value
+	case s.RawData != "":
+		return s.RawData
+	}
+	return nil
+}
+
+func (t telemetryExport) eachSample(name string, fn func(exportSample) error) error {
+	return models.EachIotDataSample(t.sessionID, name, func(s models.IotSample) error {
+		return fn(exportSample{Time: s.Timestamp, Value: t.value(s), Unit: s.Unit})
+	})
+}
+
+func (t telemetryExport) eachRow(fn func(time.Time, map[string]interface{}) error) error {
+	// Samples arrive ordered by time, so a row is complete once a sample
+	// with a later timestamp arrives
+	var at time.Time
+	var values map[string]interface{}
+	flush := func() error {
+		if values == nil {
+			return nil
+		}
+		return fn(at, values)
+	}
+
+	err := models.EachIotDataSample(t.sessionID, "", func(s models.IotSample) error {
+		if values == nil || !s.Timestamp.Equal(at) {
+			if err := flush(); err != nil {
+				return err
+			}
+			at, values = s.Timestamp, map[string]interface{}{}
+		}
+		values[s.PointName] = t.value(s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// memoryExport holds the time-sorted samples of each point
+type memoryExport map[string][]exportSample
+
+func (m memoryExport) eachSample(name string, fn func(exportSample) error) error {
+	for _, s := range m[name] {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachRow merges the already sorted series instead of building a full table
+func (m memoryExport) eachRow(fn func(time.Time, map[string]interface{}) error) error {
+	cursor := map[string]int{}
+	for {
+		// Find the earliest pending timestamp across all points
+		var next time.Time
+		found := false
+		for name, series := range m {
+			if cursor[name] < len(series) {
+				t := series[cursor[name]].Time
+				if !found || t.Before(next) {
+					next = t
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil
+		}
+
+		values := map[string]interface{}{}
+		for name, series := range m {
+			for cursor[name] < len(series) && series[cursor[name]].Time.Equal(next) {
+				values[name] = series[cursor[name]].Value
+				cursor[name]++
+			}
+		}
+
+		if err := fn(next, values); err != nil {
+			return err
+		}
+	}
+}
+
+// writeWideExport writes one row per timestamp and one column per point
+func writeWideExport(writer services.TableWriter, source exportSource, pointNames []string, pointTypes map[string]string) error {
+	columns := []services.ExportColumn{{Name: "timestamp", Kind: services.ExportString}}
+	for _, name := range pointNames {
+		kind := services.ExportString
+		if pointTypes[name] == "number" {
+			kind = services.ExportNumber
+		}
+		columns = append(columns, services.ExportColumn{Name: name, Kind: kind})
+	}
+	if err := writer.WriteHeader(columns); err != nil {
+		return err
+	}
+
+	return source.eachRow(func(t time.Time, values map[string]interface{}) error {
+		row := make([]interface{}, len(columns))
+		row[0] = t
+		for i, name := range pointNames {
+			row[i+1] = values[name]
+		}
+		return writer.WriteRow(row)
+	})
+}
+
+// writeLongExport writes one row per point sample
+func writeLongExport(writer services.TableWriter, source exportSource, pointNames []string, units map[string]string, pointTypes map[string]string) error {
+	columns := []services.ExportColumn{
+		{Name: "timestamp", Kind: services.ExportString},
+		{Name: "point_name", Kind: services.ExportString},
+		{Name: "value", Kind: services.ExportNumber},
+		{Name: "raw_value", Kind: services.ExportString},
+		{Name: "unit", Kind: services.ExportString},
+	}
+	if err := writer.WriteHeader(columns); err != nil {
+		return err
+	}
+
+	for _, name := range pointNames {
+		err := source.eachSample(name, func(s exportSample) error {
+			// Non-numeric values of numeric points stay in raw_value
+			var value, raw interface{}
+			if f, ok := s.Value.(float64); ok && pointTypes[name] == "number" {
+				value = f
+			} else {
+				raw = s.Value
+			}
+			unit := s.Unit
+			if unit == "" {
+				unit = units[name]
+			}
+			return writer.WriteRow([]interface{}{s.Time, name, value, raw, unit})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportSeries converts a report time series into time-sorted samples
+func exportSeries(timeSeries interface{}, numeric bool) []exportSample {
+	samples := []exportSample{}
+
+	add := func(bucket interface{}, value interface{}) {
+		t, ok := parseBucketTime(bucket)
+		if !ok {
+			return
+		}
+		if numeric {
+			f, ok := toFloat(value)
+			if !ok {
+				return
+			}
+			value = f
+		}
+		samples = append(samples, exportSample{Time: t, Value: value})
+	}
+
+	switch series := timeSeries.(type) {
+	case []gin.H:
+		for _, item := range series {
+			add(item["time_bucket"], item["avg_value"])
+		}
+	case []models.IotTimeSeries:
+		for _, item := range series {
+			add(item.TimeBucket, item.AvgValue)
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+	return samples
+}
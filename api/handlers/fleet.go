@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"device-monitor-go/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFleet handles GET /api/fleet
+// It serves the cached snapshot; refresh=true rebuilds it first
+func GetFleet(c *gin.Context) {
+	var (
+		snapshot *services.FleetSnapshot
+		err      error
+	)
+	if c.Query("refresh") == "true" {
+		snapshot, err = services.RefreshFleetSnapshot(requestTenant(c))
+	} else {
+		snapshot, err = services.GetFleetSnapshot(requestTenant(c))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get fleet overview: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    snapshot,
+	})
+}
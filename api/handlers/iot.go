@@ -13,7 +13,7 @@ func SyncIotData(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 
 	// Get session
-	session, err := models.GetSessionByID(sessionID)
+	session, err := models.GetSessionByID(requestTenant(c).ID, sessionID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -28,7 +28,7 @@ func SyncIotData(c *gin.Context) {
 	}
 
 	// Sync IoT data
-	iotService := services.GetIotService()
+	iotService := services.IotServiceFor(requestTenant(c))
 	iotData, err := iotService.SyncSessionData(session)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -74,12 +74,14 @@ func GetIotDataPoints(c *gin.Context) {
 
 // TestIotConnection handles GET /api/iot/test-connection
 func TestIotConnection(c *gin.Context) {
-	iotService := services.GetIotService()
+	iotService := services.IotServiceFor(requestTenant(c))
 	err := iotService.TestConnection()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "IoT connection test failed: " + err.Error(),
 			"success": false,
+			"proxy":   iotService.ProxyInfo(),
+			"tls":     iotService.TLSInfo(),
 		})
 		return
 	}
@@ -87,6 +89,8 @@ func TestIotConnection(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "IoT connection test successful",
 		"success": true,
+		"proxy":   iotService.ProxyInfo(),
+		"tls":     iotService.TLSInfo(),
 	})
 }
 
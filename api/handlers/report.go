@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"device-monitor-go/models"
+	"device-monitor-go/services"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSessionReportPDF handles GET /api/sessions/:id/report.pdf
+func GetSessionReportPDF(c *gin.Context) {
+	report, ok := loadPrintableReport(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.RenderReportPDF(&buf, report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to render report: " + err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", "report-"+report.Session.SessionID+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// GetSessionReportHTML handles GET /api/sessions/:id/report.html
+func GetSessionReportHTML(c *gin.Context) {
+	report, ok := loadPrintableReport(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.RenderReportHTML(&buf, report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to render report: " + err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// loadPrintableReport builds the printable report for the session in the URL
+func loadPrintableReport(c *gin.Context) (*services.SessionReport, bool) {
+	sessionID := c.Param("id")
+
+	session, err := models.GetSessionByID(requestTenant(c).ID, sessionID)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Session not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get session: " + err.Error(),
+			})
+		}
+		return nil, false
+	}
+
+	return buildPrintableReport(c, session), true
+}
+
+// buildPrintableReport converts the report data path output into a SessionReport
+func buildPrintableReport(c *gin.Context, session *models.DeviceSession) *services.SessionReport {
+	_, aggregatedData := buildSessionIotData(c, session)
+
+	report := &services.SessionReport{
+		Session:     session,
+		Duration:    sessionSpan(session),
+		GeneratedAt: time.Now(),
+		Branding:    services.LoadReportBranding(),
+	}
+
+	if annotations, err := models.GetSessionAnnotations(session.SessionID); err == nil {
+		report.Annotations = annotations
+	} else {
+		log.Printf("Failed to get annotations for session %s: %v", session.SessionID, err)
+	}
+	if tags, err := models.GetSessionTags(session.SessionID); err == nil {
+		report.Tags = tags
+	} else {
+		log.Printf("Failed to get tags for session %s: %v", session.SessionID, err)
+	}
+
+	// Only numeric points have meaningful summaries and charts
+	for _, dp := range models.GetIotDataPoints() {
+		if dp.Type != "number" {
+			continue
+		}
+		entry, ok := aggregatedData[dp.Name].(gin.H)
+		if !ok {
+			continue
+		}
+
+		point := services.ReportPoint{
+			Name:        dp.Name,
+			DisplayName: dp.DisplayName,
+			Unit:        dp.Unit,
+		}
+		if summary, ok := entry["summary"].(gin.H); ok {
+			count, _ := toFloat(summary["count"])
+			point.Count = int(count)
+			point.MinValue, _ = toFloat(summary["min_value"])
+			point.MaxValue, _ = toFloat(summary["max_value"])
+			point.AvgValue, _ = toFloat(summary["avg_value"])
+		}
+		for _, s := range exportSeries(entry["timeSeries"], true) {
+			if v, ok := s.Value.(float64); ok {
+				point.Samples = append(point.Samples, services.ReportSample{Time: s.Time, Value: v})
+			}
+		}
+
+		report.Points = append(report.Points, point)
+	}
+
+	return report
+}
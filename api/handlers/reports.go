@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"device-monitor-go/models"
+	"device-monitor-go/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReportPageSize caps the limit of GET /api/reports
+const maxReportPageSize = 200
+
+// GetReports handles GET /api/reports
+func GetReports(c *gin.Context) {
+	period := c.Query("period")
+
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil {
+		limit = min(max(l, 1), maxReportPageSize)
+	}
+	offset := 0
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	snapshots, total, err := models.GetReportSnapshots(requestTenant(c).ID, period, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get reports: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    snapshots,
+		"pagination": gin.H{
+			"limit":  limit,
+			"offset": offset,
+			"total":  total,
+		},
+	})
+}
+
+// GetReport handles GET /api/reports/:id
+func GetReport(c *gin.Context) {
+	snapshot, ok := loadReportSnapshot(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    snapshot,
+	})
+}
+
+// DownloadReport handles GET /api/reports/:id/download?format=json|csv|xlsx
+func DownloadReport(c *gin.Context) {
+	snapshot, ok := loadReportSnapshot(c)
+	if !ok {
+		return
+	}
+
+	name := fmt.Sprintf("%s-report-%s", snapshot.Period, snapshot.PeriodStart.Format("2006-01-02"))
+	format := c.DefaultQuery("format", "json")
+	if format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+		c.Data(http.StatusOK, "application/json", []byte(snapshot.Content))
+		return
+	}
+	if format != services.ExportFormatCSV && format != services.ExportFormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid format, expected json, csv or xlsx",
+		})
+		return
+	}
+
+	writer, err := startExport(c, format, name)
+	if err != nil {
+		return
+	}
+
+	columns := []services.ExportColumn{
+		{Name: "device_id", Kind: services.ExportString},
+		{Name: "session_count", Kind: services.ExportNumber},
+		{Name: "completed_sessions", Kind: services.ExportNumber},
+		{Name: "runtime_hours", Kind: services.ExportNumber},
+		{Name: "avg_duration", Kind: services.ExportNumber},
+		{Name: "short_sessions", Kind: services.ExportNumber},
+		{Name: "stale_sessions", Kind: services.ExportNumber},
+		{Name: "anomalies", Kind: services.ExportNumber},
+	}
+
+	rows := append([]*models.DeviceSummary{}, snapshot.Report.Devices...)
+	rows = append(rows, &snapshot.Report.Fleet)
+
+	err = writer.WriteHeader(columns)
+	for _, d := range rows {
+		if err != nil {
+			break
+		}
+		err = writer.WriteRow([]interface{}{
+			d.DeviceID, float64(d.SessionCount), float64(d.CompletedSessions), d.RuntimeHours,
+			d.AvgDuration, float64(d.ShortSessions), float64(d.StaleSessions), float64(d.Anomalies),
+		})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Printf("Failed to download report %d: %v", snapshot.ID, err)
+		c.Abort()
+	}
+}
+
+// GenerateReport handles POST /api/reports/generate?period=daily|weekly
+func GenerateReport(c *gin.Context) {
+	period := c.DefaultQuery("period", models.ReportPeriodDaily)
+	if period != models.ReportPeriodDaily && period != models.ReportPeriodWeekly {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid period, expected daily or weekly",
+		})
+		return
+	}
+
+	snapshot, err := services.GenerateSummaryReport(requestTenant(c), period, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate report: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    snapshot,
+	})
+}
+
+// loadReportSnapshot loads the report snapshot referenced in the URL
+func loadReportSnapshot(c *gin.Context) (*models.ReportSnapshot, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid report id",
+		})
+		return nil, false
+	}
+
+	snapshot, err := models.GetReportSnapshotByID(requestTenant(c).ID, id)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Report not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get report: " + err.Error(),
+			})
+		}
+		return nil, false
+	}
+
+	return snapshot, true
+}
@@ -1,23 +1,69 @@
 package handlers
 
 import (
+	"device-monitor-go/api/middleware"
+	"device-monitor-go/config"
 	"device-monitor-go/models"
 	"device-monitor-go/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// requestLocation returns the timezone from the tz query parameter,
+// defaulting to the configured site timezone
+func requestLocation(c *gin.Context) (*time.Location, bool) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return config.SiteLocation(), true
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid tz: " + tz,
+		})
+		return nil, false
+	}
+	return loc, true
+}
+
+// requestTenant returns the tenant the request was authenticated as
+func requestTenant(c *gin.Context) *models.Tenant {
+	return middleware.CurrentTenant(c)
+}
+
 // GetSessions handles GET /api/sessions
 func GetSessions(c *gin.Context) {
+	listSessions(c, false)
+}
+
+// GetTrash handles GET /api/sessions/trash, listing deleted sessions with the
+// same filters as GET /api/sessions; it defaults to most recently deleted first
+func GetTrash(c *gin.Context) {
+	listSessions(c, true)
+}
+
+// listSessions responds with live or trashed sessions
+func listSessions(c *gin.Context, deleted bool) {
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
 	// Parse query parameters
-	filter := models.SessionFilter{
-		DeviceID:  c.Query("deviceId"),
-		Status:    c.Query("status"),
-		StartDate: c.Query("startDate"),
-		EndDate:   c.Query("endDate"),
+	filter, ok := sessionFilter(c, loc)
+	if !ok {
+		return
+	}
+	filter.Deleted = deleted
+	if deleted && filter.Sort == "" {
+		filter.Sort = models.SortDeletedAt
 	}
 
 	// Parse pagination
@@ -29,6 +75,15 @@ func GetSessions(c *gin.Context) {
 		filter.Limit = 50 // Default limit (matching Node.js)
 	}
 
+	// count=false skips the COUNT(*) query on large tables
+	filter.SkipCount = c.Query("count") == "false"
+
+	// A cursor parameter, even an empty one, selects keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		getSessionPage(c, filter, cursor, loc)
+		return
+	}
+
 	if offset := c.Query("offset"); offset != "" {
 		if o, err := strconv.Atoi(offset); err == nil {
 			filter.Offset = o
@@ -38,12 +93,27 @@ func GetSessions(c *gin.Context) {
 	// Get sessions
 	sessions, total, err := models.GetSessions(filter)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) || errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get sessions: " + err.Error(),
 		})
 		return
 	}
 
+	for _, session := range sessions {
+		session.In(loc)
+	}
+
+	var totalValue interface{} = total
+	if filter.SkipCount {
+		totalValue = nil
+	}
+
 	// Match Node.js response format
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -51,16 +121,125 @@ func GetSessions(c *gin.Context) {
 		"pagination": gin.H{
 			"limit":  filter.Limit,
 			"offset": filter.Offset,
-			"total":  total,
+			"total":  totalValue,
 		},
 	})
 }
 
+// getSessionPage responds with a keyset paginated session list
+func getSessionPage(c *gin.Context, filter models.SessionFilter, cursor string, loc *time.Location) {
+	page, err := models.GetSessionPage(filter, cursor)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) || errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get sessions: " + err.Error(),
+		})
+		return
+	}
+
+	for _, session := range page.Sessions {
+		session.In(loc)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    page.Sessions,
+		"pagination": gin.H{
+			"limit":       filter.Limit,
+			"total":       page.Total,
+			"next_cursor": nullableString(page.NextCursor),
+			"prev_cursor": nullableString(page.PrevCursor),
+		},
+		"links": gin.H{
+			"next": pageLink(c, page.NextCursor),
+			"prev": pageLink(c, page.PrevCursor),
+		},
+	})
+}
+
+// pageLink returns the current request URL pointing at another cursor
+func pageLink(c *gin.Context, cursor string) interface{} {
+	if cursor == "" {
+		return nil
+	}
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	query.Del("offset")
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// sessionFilter reads the list filters shared by GET /api/sessions and the
+// session export: deviceId, status, startDate, endDate, minDuration,
+// maxDuration, q, tag, sort, order and metadata.<key>=value
+func sessionFilter(c *gin.Context, loc *time.Location) (models.SessionFilter, bool) {
+	filter := models.SessionFilter{
+		TenantID:  requestTenant(c).ID,
+		DeviceID:  c.Query("deviceId"),
+		Status:    c.Query("status"),
+		StartDate: c.Query("startDate"),
+		EndDate:   c.Query("endDate"),
+		Location:  loc,
+		Search:    strings.TrimSpace(c.Query("q")),
+		Tags:      c.QueryArray("tag"),
+		Sort:      c.Query("sort"),
+		Order:     c.Query("order"),
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **int64
+	}{
+		{"minDuration", &filter.MinDuration},
+		{"maxDuration", &filter.MaxDuration},
+	} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		d, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid " + param.name + ", expected seconds",
+			})
+			return filter, false
+		}
+		*param.dest = &d
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		if strings.HasPrefix(key, "metadata.") {
+			if filter.Metadata == nil {
+				filter.Metadata = map[string][]string{}
+			}
+			filter.Metadata[strings.TrimPrefix(key, "metadata.")] = values
+		}
+	}
+
+	return filter, true
+}
+
 // GetSessionByID handles GET /api/sessions/:id
 func GetSessionByID(c *gin.Context) {
 	sessionID := c.Param("id")
 
-	session, err := models.GetSessionByID(sessionID)
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	session, err := models.GetSessionByID(requestTenant(c).ID, sessionID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -74,6 +253,7 @@ func GetSessionByID(c *gin.Context) {
 		return
 	}
 
+	session.In(loc)
 	c.JSON(http.StatusOK, session)
 }
 
@@ -81,7 +261,12 @@ func GetSessionByID(c *gin.Context) {
 func GetSessionReport(c *gin.Context) {
 	sessionID := c.Param("id")
 
-	session, err := models.GetSessionByID(sessionID)
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	session, err := models.GetSessionByID(requestTenant(c).ID, sessionID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -95,6 +280,48 @@ func GetSessionReport(c *gin.Context) {
 		return
 	}
 
+	pointNames, aggregatedData := buildSessionIotData(c, session)
+
+	// Get raw IoT data
+	rawData, _ := models.GetIotDataBySessionId(sessionID)
+
+	annotations, err := models.GetSessionAnnotations(sessionID)
+	if err != nil {
+		log.Printf("Failed to get annotations for session %s: %v", sessionID, err)
+		annotations = []*models.SessionAnnotation{}
+	}
+	tags, err := models.GetSessionTags(sessionID)
+	if err != nil {
+		log.Printf("Failed to get tags for session %s: %v", sessionID, err)
+		tags = []*models.SessionTag{}
+	}
+
+	session.In(loc)
+	for _, a := range annotations {
+		a.In(loc)
+	}
+
+	// Match Node.js response format exactly
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"session": session,
+			"iotData": gin.H{
+				"points":     pointNames,
+				"aggregated": aggregatedData,
+				"raw":        rawData,
+			},
+			"annotations": annotations,
+			"tags":        tags,
+		},
+	})
+}
+
+// buildSessionIotData collects point summaries and time series for a session,
+// falling back to the request tenant's IoT platform when nothing is stored locally
+func buildSessionIotData(c *gin.Context, session *models.DeviceSession) ([]models.IotPointSummary, map[string]interface{}) {
+	sessionID := session.SessionID
+
 	// Get IoT data points from database (like Node.js version)
 	pointNames, err := models.GetIotDataPointNames(sessionID)
 	if err != nil {
@@ -123,7 +350,7 @@ func GetSessionReport(c *gin.Context) {
 	log.Printf("GetSessionReport: pointNames length: %d, session status: %s", len(pointNames), session.Status)
 	if len(pointNames) == 0 {
 		log.Printf("Syncing IoT data for session %s", sessionID)
-		iotService := services.GetIotService()
+		iotService := services.IotServiceFor(requestTenant(c))
 		iotData, err := iotService.SyncSessionData(session)
 		if err == nil && iotData != nil {
 			log.Printf("Successfully synced IoT data, processing %d data points", len(iotData))
@@ -134,34 +361,32 @@ func GetSessionReport(c *gin.Context) {
 					log.Printf("DataMap keys for %s: %v", dataPoint, getMapKeys(dataMap))
 					// Calculate summary from data array
 					summary := calculateSummary(dataMap)
-					
+
 					// Convert data array to timeSeries format
 					timeSeries := []gin.H{}
-					if dataArray, ok := dataMap["data"].([]interface{}); ok {
-						for _, item := range dataArray {
-							if itemMap, ok := item.(map[string]interface{}); ok {
-								// Use time as time_bucket and value as avg_value
-								timeBucket := itemMap["time"]
-								avgValue := itemMap["value"]
-								
-								// For non-Hilbert data, ensure value is numeric
-								if dataPoint != "feature_hilbert_2_hb" {
-									switch v := avgValue.(type) {
-									case string:
-										if floatVal, err := strconv.ParseFloat(v, 64); err == nil {
-											avgValue = floatVal
-										}
+					for _, item := range toInterfaceSlice(dataMap["data"]) {
+						if itemMap, ok := item.(map[string]interface{}); ok {
+							// Use time as time_bucket and value as avg_value
+							timeBucket := itemMap["time"]
+							avgValue := itemMap["value"]
+
+							// For non-Hilbert data, ensure value is numeric
+							if dataPoint != "feature_hilbert_2_hb" {
+								switch v := avgValue.(type) {
+								case string:
+									if floatVal, err := strconv.ParseFloat(v, 64); err == nil {
+										avgValue = floatVal
 									}
 								}
-								
-								timeSeries = append(timeSeries, gin.H{
-									"time_bucket": timeBucket,
-									"avg_value":   avgValue,
-								})
 							}
+
+							timeSeries = append(timeSeries, gin.H{
+								"time_bucket": timeBucket,
+								"avg_value":   avgValue,
+							})
 						}
 					}
-					
+
 					aggregatedData[dataPoint] = gin.H{
 						"summary":    summary,
 						"timeSeries": timeSeries,
@@ -171,21 +396,7 @@ func GetSessionReport(c *gin.Context) {
 		}
 	}
 
-	// Get raw IoT data
-	rawData, _ := models.GetIotDataBySessionId(sessionID)
-
-	// Match Node.js response format exactly
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"session": session,
-			"iotData": gin.H{
-				"points":     pointNames,
-				"aggregated": aggregatedData,
-				"raw":        rawData,
-			},
-		},
-	})
+	return pointNames, aggregatedData
 }
 
 // getMapKeys returns the keys of a map
@@ -197,6 +408,22 @@ func getMapKeys(m map[string]interface{}) []string {
 	return keys
 }
 
+// toInterfaceSlice normalizes the data arrays produced by SyncSessionData,
+// which may be either []interface{} or []map[string]interface{}
+func toInterfaceSlice(data interface{}) []interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		return v
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	}
+	return nil
+}
+
 // calculateSummary calculates summary statistics from IoT data
 func calculateSummary(dataMap map[string]interface{}) gin.H {
 	summary := gin.H{
@@ -215,95 +442,83 @@ func calculateSummary(dataMap map[string]interface{}) gin.H {
 	if unit, ok := dataMap["unit"].(string); ok {
 		summary["unit"] = unit
 	}
-	
+
 	log.Printf("calculateSummary: processing data for %s", summary["point_name"])
 
 	// Calculate statistics from data array
 	dataInterface := dataMap["data"]
 	log.Printf("Data interface type: %T for %s", dataInterface, summary["point_name"])
-	
+
 	// Try to handle both []interface{} and []map[string]interface{}
-	var dataArray []interface{}
-	switch v := dataInterface.(type) {
-	case []interface{}:
-		dataArray = v
-	case []map[string]interface{}:
-		// Convert []map[string]interface{} to []interface{}
-		dataArray = make([]interface{}, len(v))
-		for i, item := range v {
-			dataArray[i] = item
-		}
-	}
-	
+	dataArray := toInterfaceSlice(dataInterface)
+
 	if len(dataArray) > 0 {
 		log.Printf("Data array length: %d for %s", len(dataArray), summary["point_name"])
 		var sum, min, max float64
 		count := 0
-		
+
 		for i, item := range dataArray {
-				if itemMap, ok := item.(map[string]interface{}); ok {
-					// Handle different numeric types
-					var numValue float64
-					handled := false
-					
-					valueInterface := itemMap["value"]
-					if i == 0 {
-						log.Printf("First value type for %s: %T, value: %v", summary["point_name"], valueInterface, valueInterface)
-					}
-					
-					if value, ok := valueInterface.(float64); ok {
-						numValue = value
-						handled = true
-					} else if intValue, ok := valueInterface.(int); ok {
-						numValue = float64(intValue)
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				// Handle different numeric types
+				var numValue float64
+				handled := false
+
+				valueInterface := itemMap["value"]
+				if i == 0 {
+					log.Printf("First value type for %s: %T, value: %v", summary["point_name"], valueInterface, valueInterface)
+				}
+
+				if value, ok := valueInterface.(float64); ok {
+					numValue = value
+					handled = true
+				} else if intValue, ok := valueInterface.(int); ok {
+					numValue = float64(intValue)
+					handled = true
+				} else if strValue, ok := valueInterface.(string); ok {
+					// Try to parse string values as float
+					if floatValue, err := strconv.ParseFloat(strValue, 64); err == nil {
+						numValue = floatValue
 						handled = true
-					} else if strValue, ok := valueInterface.(string); ok {
-						// Try to parse string values as float
-						if floatValue, err := strconv.ParseFloat(strValue, 64); err == nil {
-							numValue = floatValue
-							handled = true
-						}
 					}
-					
-					// Process the numeric value
-					if handled {
-						if i == 0 || count == 0 {
+				}
+
+				// Process the numeric value
+				if handled {
+					if i == 0 || count == 0 {
+						min = numValue
+						max = numValue
+					} else {
+						if numValue < min {
 							min = numValue
+						}
+						if numValue > max {
 							max = numValue
-						} else {
-							if numValue < min {
-								min = numValue
-							}
-							if numValue > max {
-								max = numValue
-							}
 						}
-						sum += numValue
-						count++
 					}
+					sum += numValue
+					count++
 				}
 			}
+		}
 
-			if count > 0 {
-				summary["count"] = count
-				summary["min_value"] = min
-				summary["max_value"] = max
-				summary["avg_value"] = sum / float64(count)
-			}
+		if count > 0 {
+			summary["count"] = count
+			summary["min_value"] = min
+			summary["max_value"] = max
+			summary["avg_value"] = sum / float64(count)
 		}
+	}
 
 	return summary
 }
 
-// DeleteSession handles DELETE /api/sessions/:id
+// DeleteSession handles DELETE /api/sessions/:id?reason=
 func DeleteSession(c *gin.Context) {
 	sessionID := c.Param("id")
 
-	err := models.DeleteSession(sessionID)
+	err := models.DeleteSession(requestTenant(c).ID, sessionID, requestAuthor(c, c.Query("actor")), c.Query("reason"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to delete session: " + err.Error(),
-		})
+		respondSessionEditError(c, err, "Failed to delete session")
 		return
 	}
 
@@ -312,14 +527,33 @@ func DeleteSession(c *gin.Context) {
 	})
 }
 
-// GetStatistics handles GET /api/sessions/statistics
+// GetStatistics handles GET /api/sessions/statistics?groupBy=device|day|week|month|status|metadata.<key>&percentiles=true
 func GetStatistics(c *gin.Context) {
 	deviceID := c.Query("deviceId")
 	startDate := c.Query("startDate")
 	endDate := c.Query("endDate")
 
-	stats, err := models.GetStatistics(deviceID, startDate, endDate)
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	stats, err := models.GetStatistics(models.StatisticsQuery{
+		TenantID:    requestTenant(c).ID,
+		DeviceID:    deviceID,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Location:    loc,
+		GroupBy:     c.Query("groupBy"),
+		Percentiles: c.Query("percentiles") == "true",
+	})
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) || errors.Is(err, models.ErrInvalidGroupBy) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get statistics: " + err.Error(),
 		})
@@ -329,14 +563,33 @@ func GetStatistics(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// GetDeviceStatistics handles GET /api/sessions/device/:deviceId/statistics
+// GetDeviceStatistics handles GET /api/sessions/device/:deviceId/statistics?groupBy=...
 func GetDeviceStatistics(c *gin.Context) {
 	deviceID := c.Param("deviceId")
 	startDate := c.Query("startDate")
 	endDate := c.Query("endDate")
 
-	stats, err := models.GetStatistics(deviceID, startDate, endDate)
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	stats, err := models.GetStatistics(models.StatisticsQuery{
+		TenantID:    requestTenant(c).ID,
+		DeviceID:    deviceID,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Location:    loc,
+		GroupBy:     c.Query("groupBy"),
+		Percentiles: c.Query("percentiles") == "true",
+	})
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) || errors.Is(err, models.ErrInvalidGroupBy) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get statistics: " + err.Error(),
 		})
@@ -348,4 +601,152 @@ func GetDeviceStatistics(c *gin.Context) {
 		"success": true,
 		"data":    stats,
 	})
-}
\ No newline at end of file
+}
+
+// GetUtilization handles GET /api/sessions/statistics/utilization
+func GetUtilization(c *gin.Context) {
+	deviceID := c.Query("deviceId")
+
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	// Default to the last 7 days including today
+	today := time.Now().In(loc)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	start := today.AddDate(0, 0, -6)
+	end := today.AddDate(0, 0, 1)
+
+	if v := c.Query("startDate"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid startDate, expected YYYY-MM-DD",
+			})
+			return
+		}
+		start = t
+	}
+	if v := c.Query("endDate"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid endDate, expected YYYY-MM-DD",
+			})
+			return
+		}
+		end = t.AddDate(0, 0, 1) // endDate is inclusive
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "endDate must not be before startDate",
+		})
+		return
+	}
+
+	// A calendar in the request overrides the configured one
+	shifts := c.DefaultQuery("shifts", config.Current().ShiftCalendar)
+	calendar, err := models.ParseShiftCalendar(shifts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid shift calendar: " + err.Error(),
+		})
+		return
+	}
+
+	stats, err := models.GetUtilization(requestTenant(c).ID, deviceID, start, end, calendar)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get utilization: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"start_date": start.Format("2006-01-02"),
+			"end_date":   end.AddDate(0, 0, -1).Format("2006-01-02"),
+			"shifts":     shifts,
+			"devices":    stats,
+		},
+	})
+}
+
+// GetRuntimeHistogram handles GET /api/sessions/statistics/runtime
+func GetRuntimeHistogram(c *gin.Context) {
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	bucket := c.DefaultQuery("bucket", models.BucketDay)
+	if bucket != models.BucketDay && bucket != models.BucketHour && bucket != models.BucketShift {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid bucket, expected day, hour or shift",
+		})
+		return
+	}
+
+	var calendar models.ShiftCalendar
+	if bucket == models.BucketShift {
+		var err error
+		calendar, err = models.ParseShiftCalendar(c.DefaultQuery("shifts", config.Current().ShiftCalendar))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid shift calendar: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	buckets, err := models.GetRuntimeHistogram(requestTenant(c).ID, c.Query("deviceId"), c.Query("startDate"), c.Query("endDate"), loc, bucket, calendar)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get runtime histogram: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"bucket":  bucket,
+			"buckets": buckets,
+		},
+	})
+}
+
+// GetRuntimeHeatmap handles GET /api/sessions/statistics/heatmap
+func GetRuntimeHeatmap(c *gin.Context) {
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+
+	heatmap, err := models.GetHourlyHeatmap(requestTenant(c).ID, c.Query("deviceId"), c.Query("startDate"), c.Query("endDate"), loc)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get runtime heatmap: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    heatmap,
+	})
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"database/sql"
+	"device-monitor-go/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createSessionRequest is the body of a manual (backfill) session
+type createSessionRequest struct {
+	DeviceID  string                 `json:"device_id" binding:"required"`
+	StartTime string                 `json:"start_time" binding:"required"`
+	EndTime   string                 `json:"end_time"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Actor     string                 `json:"actor"`
+	Reason    string                 `json:"reason"`
+}
+
+// CreateSession handles POST /api/sessions for backfilling missed sessions
+func CreateSession(c *gin.Context) {
+	var req createSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	startTime, err := parseWebhookTime(req.StartTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid start_time: " + err.Error(),
+		})
+		return
+	}
+
+	var endTime *time.Time
+	if req.EndTime != "" {
+		t, err := parseWebhookTime(req.EndTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid end_time: " + err.Error(),
+			})
+			return
+		}
+		endTime = &t
+	}
+
+	session, err := models.CreateManualSession(requestTenant(c).ID, req.DeviceID, startTime, endTime, req.Metadata,
+		requestAuthor(c, req.Actor), req.Reason)
+	if err != nil {
+		respondSessionEditError(c, err, "Failed to create session")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    session,
+	})
+}
+
+// UpdateSession handles PATCH /api/sessions/:id. Only fields present in the
+// body are changed; "end_time": null reopens the session as running and
+// metadata keys set to null are removed.
+func UpdateSession(c *gin.Context) {
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	patch, actor, reason, err := parseSessionPatch(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	session, err := models.UpdateSession(requestTenant(c).ID, c.Param("id"), patch, requestAuthor(c, actor), reason)
+	if err != nil {
+		respondSessionEditError(c, err, "Failed to update session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    session,
+	})
+}
+
+// GetSessionHistory handles GET /api/sessions/:id/history
+func GetSessionHistory(c *gin.Context) {
+	// Trashed sessions keep their history, so the audit log is scoped by
+	// tenant rather than by loading the live session
+	entries, _, err := models.GetAuditLog(models.AuditFilter{
+		TenantID:  requestTenant(c).ID,
+		SessionID: c.Param("id"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get session history: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+	})
+}
+
+// GetAuditLog handles GET /api/audit?sessionId=&action=&actor=&limit=&offset=
+func GetAuditLog(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	filter := models.AuditFilter{
+		TenantID:  requestTenant(c).ID,
+		SessionID: c.Query("sessionId"),
+		Action:    c.Query("action"),
+		Actor:     c.Query("actor"),
+		Limit:     limit,
+		Offset:    offset,
+	}
+
+	entries, total, err := models.GetAuditLog(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get audit log: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// parseSessionPatch converts a PATCH body into a session patch; the raw form
+// distinguishes an explicit null end_time from an absent one
+func parseSessionPatch(body map[string]json.RawMessage) (models.SessionPatch, string, string, error) {
+	patch := models.SessionPatch{}
+	var actor, reason string
+
+	for key, raw := range body {
+		isNull := string(raw) == "null"
+		switch key {
+		case "device_id":
+			var deviceID string
+			if err := json.Unmarshal(raw, &deviceID); err != nil {
+				return patch, "", "", errors.New("Invalid device_id")
+			}
+			patch.DeviceID = &deviceID
+		case "start_time":
+			t, err := parsePatchTime(raw)
+			if err != nil || isNull {
+				return patch, "", "", errors.New("Invalid start_time")
+			}
+			patch.StartTime = &t
+		case "end_time":
+			if isNull {
+				patch.ClearEndTime = true
+				continue
+			}
+			t, err := parsePatchTime(raw)
+			if err != nil {
+				return patch, "", "", errors.New("Invalid end_time")
+			}
+			patch.EndTime = &t
+		case "metadata":
+			if err := json.Unmarshal(raw, &patch.Metadata); err != nil || isNull {
+				return patch, "", "", errors.New("Invalid metadata, expected an object")
+			}
+		case "actor":
+			json.Unmarshal(raw, &actor)
+		case "reason":
+			json.Unmarshal(raw, &reason)
+		default:
+			return patch, "", "", errors.New("Field cannot be edited: " + key)
+		}
+	}
+
+	return patch, actor, reason, nil
+}
+
+// parsePatchTime accepts the same timestamp formats as the webhook
+func parsePatchTime(raw json.RawMessage) (time.Time, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return time.Time{}, err
+	}
+	return parseWebhookTime(value)
+}
+
+// respondSessionEditError maps session edit errors to HTTP responses
+func respondSessionEditError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Session not found",
+		})
+	case errors.Is(err, models.ErrInvalidSession):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message + ": " + err.Error(),
+		})
+	}
+}
+
+// DeleteSessions handles DELETE /api/sessions?<list filters>&reason=, moving
+// every matching session to the trash. At least one filter is required.
+func DeleteSessions(c *gin.Context) {
+	loc, ok := requestLocation(c)
+	if !ok {
+		return
+	}
+	filter, ok := sessionFilter(c, loc)
+	if !ok {
+		return
+	}
+
+	deleted, err := models.DeleteSessions(filter, requestAuthor(c, c.Query("actor")), c.Query("reason"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidDate) || errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete sessions: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"deleted": deleted,
+	})
+}
+
+// RestoreSession handles POST /api/sessions/:id/restore
+func RestoreSession(c *gin.Context) {
+	var req struct {
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}
+	// The body is optional
+	c.ShouldBindJSON(&req)
+
+	session, err := models.RestoreSession(requestTenant(c).ID, c.Param("id"), requestAuthor(c, req.Actor), req.Reason)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Session not found in trash",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to restore session: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    session,
+	})
+}
+
+// MergeSessions handles POST /api/sessions/merge
+// Body: {"session_ids": [...], "actor": "...", "reason": "..."}
+func MergeSessions(c *gin.Context) {
+	var req struct {
+		SessionIDs []string `json:"session_ids" binding:"required"`
+		Actor      string   `json:"actor"`
+		Reason     string   `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	session, err := models.MergeSessions(requestTenant(c).ID, req.SessionIDs, requestAuthor(c, req.Actor), req.Reason)
+	if err != nil {
+		respondSessionEditError(c, err, "Failed to merge sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    session,
+	})
+}
+
+// SplitSession handles POST /api/sessions/:id/split
+// Body: {"at": "<timestamp>", "actor": "...", "reason": "..."}
+func SplitSession(c *gin.Context) {
+	var req struct {
+		At     string `json:"at" binding:"required"`
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	at, err := parseWebhookTime(req.At)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid split time: " + err.Error(),
+		})
+		return
+	}
+
+	first, second, err := models.SplitSession(requestTenant(c).ID, c.Param("id"), at, requestAuthor(c, req.Actor), req.Reason)
+	if err != nil {
+		respondSessionEditError(c, err, "Failed to split session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    []*models.DeviceSession{first, second},
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"device-monitor-go/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantRequest is the body of POST and PATCH /api/admin/tenants; absent
+// fields are left unchanged on PATCH
+type tenantRequest struct {
+	ID               string  `json:"id"`
+	Name             *string `json:"name"`
+	IotAPIBaseURL    *string `json:"iot_api_base_url"`
+	IotAppKey        *string `json:"iot_app_key"`
+	IotAppSecret     *string `json:"iot_app_secret"`
+	IotDeviceCode    *string `json:"iot_device_code"`
+	ReportWebhookURL *string `json:"report_webhook_url"`
+}
+
+// apply copies the fields present in the request onto the tenant
+func (r tenantRequest) apply(t *models.Tenant) {
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{r.Name, &t.Name},
+		{r.IotAPIBaseURL, &t.IotAPIBaseURL},
+		{r.IotAppKey, &t.IotAppKey},
+		{r.IotAppSecret, &t.IotAppSecret},
+		{r.IotDeviceCode, &t.IotDeviceCode},
+		{r.ReportWebhookURL, &t.ReportWebhookURL},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+}
+
+// GetTenants handles GET /api/admin/tenants
+func GetTenants(c *gin.Context) {
+	tenants, err := models.GetTenants()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get tenants: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tenants,
+	})
+}
+
+// CreateTenant handles POST /api/admin/tenants. The new tenant's API key
+// and webhook secret are returned once and cannot be retrieved later, as
+// is the default tenant's API key when the default tenant had none.
+func CreateTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	tenant := &models.Tenant{ID: req.ID}
+	req.apply(tenant)
+	defaultAPIKey, err := models.CreateTenant(tenant)
+	if err != nil {
+		respondTenantError(c, err, "Failed to create tenant")
+		return
+	}
+
+	secrets := gin.H{}
+	for _, kind := range []string{models.TenantAPIKey, models.TenantWebhookSecret} {
+		secret, err := models.RotateTenantSecret(tenant.ID, kind)
+		if err != nil {
+			respondTenantError(c, err, "Failed to issue tenant credentials")
+			return
+		}
+		secrets[kind] = secret
+	}
+	tenant.HasAPIKey, tenant.HasWebhookSecret = true, true
+
+	response := gin.H{
+		"success":        true,
+		"data":           tenant,
+		"api_key":        secrets[models.TenantAPIKey],
+		"webhook_secret": secrets[models.TenantWebhookSecret],
+	}
+	// Keyless requests stop working from here on
+	if defaultAPIKey != "" {
+		response["default_api_key"] = defaultAPIKey
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateTenant handles PATCH /api/admin/tenants/:tenantId
+func UpdateTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	tenant, err := models.GetTenantByID(c.Param("tenantId"))
+	if err != nil {
+		respondTenantError(c, err, "Failed to get tenant")
+		return
+	}
+
+	req.apply(tenant)
+	if err := models.UpdateTenant(tenant); err != nil {
+		respondTenantError(c, err, "Failed to update tenant")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tenant,
+	})
+}
+
+// DeleteTenant handles DELETE /api/admin/tenants/:tenantId
+func DeleteTenant(c *gin.Context) {
+	if err := models.DeleteTenant(c.Param("tenantId")); err != nil {
+		respondTenantError(c, err, "Failed to delete tenant")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant deleted successfully",
+	})
+}
+
+// RotateTenantAPIKey handles POST /api/admin/tenants/:tenantId/api-key
+func RotateTenantAPIKey(c *gin.Context) {
+	rotateTenantSecret(c, models.TenantAPIKey)
+}
+
+// RevokeTenantAPIKey handles DELETE /api/admin/tenants/:tenantId/api-key
+func RevokeTenantAPIKey(c *gin.Context) {
+	revokeTenantSecret(c, models.TenantAPIKey)
+}
+
+// RotateTenantWebhookSecret handles POST /api/admin/tenants/:tenantId/webhook-secret
+func RotateTenantWebhookSecret(c *gin.Context) {
+	rotateTenantSecret(c, models.TenantWebhookSecret)
+}
+
+// RevokeTenantWebhookSecret handles DELETE /api/admin/tenants/:tenantId/webhook-secret
+func RevokeTenantWebhookSecret(c *gin.Context) {
+	revokeTenantSecret(c, models.TenantWebhookSecret)
+}
+
+// rotateTenantSecret replaces a tenant's API key or webhook secret and
+// returns the new one; the previous one stops working immediately
+func rotateTenantSecret(c *gin.Context, kind string) {
+	secret, err := models.RotateTenantSecret(c.Param("tenantId"), kind)
+	if err != nil {
+		respondTenantError(c, err, "Failed to rotate tenant credentials")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		kind:      secret,
+	})
+}
+
+// revokeTenantSecret removes a tenant's API key or webhook secret. For the
+// default tenant this reopens anonymous access.
+func revokeTenantSecret(c *gin.Context, kind string) {
+	if err := models.RevokeTenantSecret(c.Param("tenantId"), kind); err != nil {
+		respondTenantError(c, err, "Failed to revoke tenant credentials")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant credentials revoked successfully",
+	})
+}
+
+// respondTenantError maps tenant errors to HTTP status codes
+func respondTenantError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Tenant not found",
+		})
+	case errors.Is(err, models.ErrInvalidTenant):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, models.ErrTenantExists), errors.Is(err, models.ErrTenantInUse):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message + ": " + err.Error(),
+		})
+	}
+}
@@ -3,7 +3,11 @@ package handlers
 import (
 	"device-monitor-go/config"
 	"device-monitor-go/models"
+	"device-monitor-go/services"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -42,24 +46,17 @@ func DeviceStart(c *gin.Context) {
 		deviceID = req.DeviceID
 	}
 	if deviceID == "" {
-		deviceID = config.AppConfig.IotDeviceCode
+		deviceID = services.IotServiceFor(requestTenant(c)).DeviceCode()
 	}
 
 	// Parse timestamp or use current time
-	var startTime time.Time
-	if req.Timestamp != "" {
-		parsed, err := time.Parse(time.RFC3339, req.Timestamp)
-		if err == nil {
-			startTime = parsed
-		} else {
-			startTime = time.Now()
-		}
-	} else {
+	startTime, err := parseWebhookTime(req.Timestamp)
+	if err != nil {
 		startTime = time.Now()
 	}
 
 	// Create new session
-	session, err := models.CreateSession(deviceID, startTime, req.Metadata)
+	session, err := models.CreateSession(requestTenant(c).ID, deviceID, startTime, req.Metadata)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create session: " + err.Error(),
@@ -99,19 +96,12 @@ func DeviceEnd(c *gin.Context) {
 		deviceID = req.DeviceID
 	}
 	if deviceID == "" {
-		deviceID = config.AppConfig.IotDeviceCode
+		deviceID = services.IotServiceFor(requestTenant(c)).DeviceCode()
 	}
 
 	// Parse timestamp or use current time
-	var endTime time.Time
-	if req.Timestamp != "" {
-		parsed, err := time.Parse(time.RFC3339, req.Timestamp)
-		if err == nil {
-			endTime = parsed
-		} else {
-			endTime = time.Now()
-		}
-	} else {
+	endTime, err := parseWebhookTime(req.Timestamp)
+	if err != nil {
 		endTime = time.Now()
 	}
 
@@ -121,7 +111,7 @@ func DeviceEnd(c *gin.Context) {
 		sessionID = req.SessionID
 	} else {
 		// Find the latest running session for this device
-		sessions, err := models.GetRunningSessions(deviceID)
+		sessions, err := models.GetRunningSessions(requestTenant(c).ID, deviceID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to find running session: " + err.Error(),
@@ -141,7 +131,7 @@ func DeviceEnd(c *gin.Context) {
 	}
 
 	// End the session
-	err := models.EndSession(sessionID, endTime, req.Metadata)
+	err = models.EndSession(requestTenant(c).ID, sessionID, endTime, req.Metadata)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to end session: " + err.Error(),
@@ -149,23 +139,62 @@ func DeviceEnd(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message":   "Device stopped successfully",
 		"sessionId": sessionID,
 		"deviceId":  deviceID,
 		"endTime":   endTime,
-	})
+	}
+
+	// Fold sessions split by short power interruptions back together
+	gap := time.Duration(config.Current().MergeGapSeconds) * time.Second
+	if merged, err := models.AutoMergeSession(requestTenant(c).ID, sessionID, gap); err != nil {
+		log.Printf("Failed to auto-merge session %s: %v", sessionID, err)
+	} else if merged != nil {
+		response["mergedInto"] = merged.SessionID
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parseWebhookTime parses a webhook timestamp. Timestamps with an explicit
+// offset are taken as-is; ones without are interpreted in the site timezone.
+func parseWebhookTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	loc := config.SiteLocation()
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	// Unix timestamps in seconds or milliseconds
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if len(value) == 13 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
 }
 
 // TestWebhookStart handles POST /api/webhooks/test/start
 func TestWebhookStart(c *gin.Context) {
 	deviceID := c.Query("deviceId")
 	if deviceID == "" {
-		deviceID = config.AppConfig.IotDeviceCode
+		deviceID = services.IotServiceFor(requestTenant(c)).DeviceCode()
 	}
 
 	// Create test session
-	session, err := models.CreateSession(deviceID, time.Now(), map[string]interface{}{
+	session, err := models.CreateSession(requestTenant(c).ID, deviceID, time.Now(), map[string]interface{}{
 		"test": true,
 	})
 	if err != nil {
@@ -196,7 +225,7 @@ func TestWebhookEnd(c *gin.Context) {
 
 	// If no session ID provided, find the latest running session
 	if sessionID == "" {
-		sessions, err := models.GetRunningSessions(deviceID)
+		sessions, err := models.GetRunningSessions(requestTenant(c).ID, deviceID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to find running session: " + err.Error(),
@@ -215,7 +244,7 @@ func TestWebhookEnd(c *gin.Context) {
 	}
 
 	// End the session
-	err := models.EndSession(sessionID, time.Now(), map[string]interface{}{
+	err := models.EndSession(requestTenant(c).ID, sessionID, time.Now(), map[string]interface{}{
 		"test": true,
 	})
 	if err != nil {
@@ -229,4 +258,4 @@ func TestWebhookEnd(c *gin.Context) {
 		"message":   "Test device stopped successfully",
 		"sessionId": sessionID,
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"database/sql"
+	"device-monitor-go/models"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantKey holds the request's *models.Tenant in the gin context
+const tenantKey = "tenant"
+
+// Tenant resolves the tenant of an API request from its API key, sent as
+// "X-API-Key: <key>" or "Authorization: Bearer <key>". Requests without a
+// key belong to the default tenant as long as it has no API key itself, so
+// single-tenant installations keep working without keys.
+func Tenant() gin.HandlerFunc {
+	return resolveTenant(false)
+}
+
+// WebhookTenant resolves the tenant of a webhook from its webhook secret,
+// sent as "X-Webhook-Secret: <secret>"; an API key is accepted as well.
+// Secrets are not accepted in the query string, which the request log
+// records.
+// Webhooks without either belong to the default tenant as long as it has
+// neither an API key nor a webhook secret.
+func WebhookTenant() gin.HandlerFunc {
+	return resolveTenant(true)
+}
+
+func resolveTenant(webhook bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind, secret := models.TenantAPIKey, c.GetHeader("X-API-Key")
+		if auth := c.GetHeader("Authorization"); secret == "" && strings.HasPrefix(auth, "Bearer ") {
+			secret = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if secret == "" && webhook {
+			kind, secret = models.TenantWebhookSecret, c.GetHeader("X-Webhook-Secret")
+		}
+
+		var tenant *models.Tenant
+		var err error
+		if secret != "" {
+			tenant, err = models.FindTenantBySecret(kind, secret)
+		} else {
+			tenant, err = models.GetTenantByID(models.DefaultTenantID)
+			if err == nil && (tenant.HasAPIKey || (webhook && tenant.HasWebhookSecret)) {
+				message := "API key required"
+				if webhook {
+					message = "Webhook secret required"
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+				return
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				message := "Invalid API key"
+				if kind == models.TenantWebhookSecret {
+					message = "Invalid webhook secret"
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to resolve tenant: " + err.Error(),
+				})
+			}
+			return
+		}
+
+		c.Set(tenantKey, tenant)
+		c.Next()
+	}
+}
+
+// CurrentTenant returns the tenant resolved by Tenant or WebhookTenant
+func CurrentTenant(c *gin.Context) *models.Tenant {
+	return c.MustGet(tenantKey).(*models.Tenant)
+}
+
+// AdminOnly restricts a route to the default tenant, which administers the
+// instance; it must run after Tenant
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CurrentTenant(c).IsDefault() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Only the default tenant can administer this instance",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"device-monitor-go/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openTenantDB migrates a fresh SQLite database holding only the default
+// tenant
+func openTenantDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "device_monitor.db"))
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+}
+
+// tenantRequest sends a request through the middleware and returns the
+// response status with the resolved tenant ID or error message
+func tenantRequest(t *testing.T, handler gin.HandlerFunc, target string, headers map[string]string) (int, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/*path", handler, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tenant": CurrentTenant(c).ID})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var body struct {
+		Tenant string `json:"tenant"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q: %v", rec.Body.String(), err)
+	}
+	if rec.Code == http.StatusOK {
+		return rec.Code, body.Tenant
+	}
+	return rec.Code, body.Error
+}
+
+type tenantCase struct {
+	name    string
+	handler gin.HandlerFunc
+	target  string
+	headers map[string]string
+	status  int
+	result  string // tenant ID, or error message when rejected
+}
+
+func runTenantCases(t *testing.T, cases []tenantCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := tc.target
+			if target == "" {
+				target = "/api/sessions"
+			}
+			status, result := tenantRequest(t, tc.handler, target, tc.headers)
+			if status != tc.status || result != tc.result {
+				t.Fatalf("got %d %q, want %d %q", status, result, tc.status, tc.result)
+			}
+		})
+	}
+}
+
+func TestTenantWithoutKeys(t *testing.T) {
+	openTenantDB(t)
+
+	runTenantCases(t, []tenantCase{
+		{"keyless request uses the default tenant", Tenant(), "", nil, http.StatusOK, models.DefaultTenantID},
+		{"keyless webhook uses the default tenant", WebhookTenant(), "/webhook", nil, http.StatusOK, models.DefaultTenantID},
+		{"unknown API key", Tenant(), "", map[string]string{"X-API-Key": "dm_unknown"},
+			http.StatusUnauthorized, "Invalid API key"},
+		{"unknown bearer token", Tenant(), "", map[string]string{"Authorization": "Bearer dm_unknown"},
+			http.StatusUnauthorized, "Invalid API key"},
+		{"unknown webhook secret", WebhookTenant(), "/webhook", map[string]string{"X-Webhook-Secret": "dm_unknown"},
+			http.StatusUnauthorized, "Invalid webhook secret"},
+	})
+}
+
+func TestTenantWithKeys(t *testing.T) {
+	openTenantDB(t)
+
+	defaultKey, err := models.CreateTenant(&models.Tenant{ID: "acme", Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acmeKey, err := models.RotateTenantSecret("acme", models.TenantAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acmeSecret, err := models.RotateTenantSecret("acme", models.TenantWebhookSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runTenantCases(t, []tenantCase{
+		{"missing API key", Tenant(), "", nil, http.StatusUnauthorized, "API key required"},
+		{"missing webhook secret", WebhookTenant(), "/webhook", nil, http.StatusUnauthorized, "Webhook secret required"},
+		{"unknown API key", Tenant(), "", map[string]string{"X-API-Key": "dm_unknown"},
+			http.StatusUnauthorized, "Invalid API key"},
+		{"malformed authorization header", Tenant(), "", map[string]string{"Authorization": "Basic " + acmeKey},
+			http.StatusUnauthorized, "API key required"},
+		{"webhook secret is not an API key", Tenant(), "", map[string]string{"X-API-Key": acmeSecret},
+			http.StatusUnauthorized, "Invalid API key"},
+		{"webhook secret in the query string is ignored", WebhookTenant(), "/webhook?secret=" + acmeSecret, nil,
+			http.StatusUnauthorized, "Webhook secret required"},
+		{"unknown webhook secret", WebhookTenant(), "/webhook", map[string]string{"X-Webhook-Secret": "dm_unknown"},
+			http.StatusUnauthorized, "Invalid webhook secret"},
+		{"default tenant API key", Tenant(), "", map[string]string{"X-API-Key": defaultKey},
+			http.StatusOK, models.DefaultTenantID},
+		{"tenant bearer token", Tenant(), "", map[string]string{"Authorization": "Bearer " + acmeKey},
+			http.StatusOK, "acme"},
+		{"tenant webhook secret", WebhookTenant(), "/webhook", map[string]string{"X-Webhook-Secret": acmeSecret},
+			http.StatusOK, "acme"},
+		{"tenant API key on a webhook", WebhookTenant(), "/webhook", map[string]string{"X-API-Key": acmeKey},
+			http.StatusOK, "acme"},
+	})
+}
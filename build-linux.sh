@@ -17,15 +17,8 @@ elif command -v x86_64-linux-musl-gcc &> /dev/null; then
     echo "Using musl-cross for cross-compilation..."
     make build-linux-musl
 else
-    echo "No suitable cross-compiler found!"
-    echo ""
-    echo "Please install one of the following:"
-    echo "1. Docker Desktop (recommended)"
-    echo "2. zig: brew install zig"
-    echo "3. musl-cross: brew install FiloSottile/musl-cross/musl-cross"
-    echo ""
-    echo "Then run 'make build-linux' again."
-    exit 1
+    echo "No cross-compiler found, using the pure-Go SQLite driver..."
+    make build-linux-purego
 fi
 
 # Check if build succeeded
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"database/sql"
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"device-monitor-go/models"
+	"device-monitor-go/services"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runCommand runs a command-line subcommand and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(args[1:])
+	case "backup":
+		return backupCommand(args[1:])
+	case "restore":
+		return restoreCommand(args[1:])
+	case "tenant":
+		return tenantCommand(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\nUsage:\n  %[2]s                 start the server\n  %[2]s migrate ...     manage database migrations\n  %[2]s backup ...      back up the SQLite database\n  %[2]s restore FILE    restore the SQLite database from a backup\n  %[2]s tenant ...      manage tenants and their API keys\n",
+		args[0], os.Args[0])
+	return 2
+}
+
+// migrateCommand handles "migrate status|up|down [-dry-run] [-steps N]"
+func migrateCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the SQL that would run without changing the database")
+	steps := flags.Int("steps", 1, "number of migrations to roll back with down")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s migrate status|up|down [-dry-run] [-steps N]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := database.Open(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer database.Close()
+
+	var err error
+	switch action {
+	case "status":
+		err = printMigrationStatus()
+	case "up":
+		var applied []*database.Migration
+		if applied, err = database.Migrate(*dryRun); err == nil && len(applied) == 0 {
+			fmt.Println("Database schema is up to date")
+		}
+	case "down":
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "-steps must be at least 1")
+			return 2
+		}
+		var reverted []*database.Migration
+		if reverted, err = database.Rollback(*steps, *dryRun); err == nil && len(reverted) == 0 {
+			fmt.Println("No applied migrations to roll back")
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// backupCommand handles "backup [list] [-dir D] [-compress]"
+func backupCommand(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := flags.String("dir", config.Current().BackupDir, "directory to write backups to")
+	compress := flags.Bool("compress", config.Current().BackupCompress, "gzip the backup")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s backup [list] [-dir D] [-compress]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	list := len(args) > 0 && args[0] == "list"
+	if list {
+		args = args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if list {
+		if err := printBackups(*dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := database.Open(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer database.Close()
+
+	backup, err := services.RunBackup(*dir, *compress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(backup.Path)
+	return 0
+}
+
+// restoreCommand handles "restore FILE"; the server must be stopped first
+func restoreCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s restore FILE\n\nStop the server before restoring.\n", os.Args[0])
+		return 2
+	}
+
+	previous, err := database.Restore(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Restored %s from %s\n", config.Current().DatabasePath, args[0])
+	if previous != "" {
+		fmt.Printf("Previous database kept at %s\n", previous)
+	}
+	return 0
+}
+
+// tenantCommand handles "tenant list|add ID [-name N]|key ID". It works
+// without the API, so it can issue the first API key or recover a lost one.
+func tenantCommand(args []string) int {
+	flags := flag.NewFlagSet("tenant", flag.ContinueOnError)
+	name := flags.String("name", "", "display name of a new tenant")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s tenant list|add ID [-name N]|key ID\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	action := args[0]
+	var id string
+	if action == "add" || action == "key" {
+		if len(args) < 2 {
+			flags.Usage()
+			return 2
+		}
+		id, args = args[1], args[2:]
+	} else {
+		args = args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := database.InitDB(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer database.Close()
+
+	var err error
+	switch action {
+	case "list":
+		err = printTenants()
+	case "add":
+		tenant := &models.Tenant{ID: id, Name: *name}
+		var defaultAPIKey string
+		if defaultAPIKey, err = models.CreateTenant(tenant); err == nil {
+			if defaultAPIKey != "" {
+				fmt.Printf("default %s: %s\n", models.TenantAPIKey, defaultAPIKey)
+			}
+			err = printTenantSecrets(id, models.TenantAPIKey, models.TenantWebhookSecret)
+		}
+	case "key":
+		err = printTenantSecrets(id, models.TenantAPIKey)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// printTenantSecrets rotates a tenant's secrets and prints the new values
+func printTenantSecrets(id string, kinds ...string) error {
+	for _, kind := range kinds {
+		secret, err := models.RotateTenantSecret(id, kind)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("tenant %q not found", id)
+			}
+			return err
+		}
+		fmt.Printf("%s: %s\n", kind, secret)
+	}
+	return nil
+}
+
+func printTenants() error {
+	tenants, err := models.GetTenants()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tAPI KEY\tWEBHOOK SECRET\tCREATED")
+	for _, t := range tenants {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\n", t.ID, t.Name, t.HasAPIKey, t.HasWebhookSecret,
+			t.CreatedAt.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func printBackups(dir string) error {
+	backups, err := database.ListBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tCREATED")
+	for _, b := range backups {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", b.Name, b.Size, b.CreatedAt.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func printMigrationStatus() error {
+	statuses, err := database.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
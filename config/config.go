@@ -1,83 +1,491 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	_ "time/tzdata" // Bundle zone data so SITE_TIMEZONE works on minimal hosts
 
 	"github.com/joho/godotenv"
+	"github.com/robfig/cron/v3"
 )
 
+// Config holds every setting. Each field names its environment variables
+// (env, the first one winning), its key in the config file (file) and its
+// default. Fields tagged
+// reload can change on SIGHUP; the others need a restart.
 type Config struct {
 	// Server configuration
-	Port        string
-	Environment string
+	Port        string `env:"PORT" file:"server.port" default:"3000"`
+	Environment string `env:"NODE_ENV" file:"server.environment" default:"development"`
 
-	// Database configuration
-	DatabasePath string
+	// Site timezone used for date filters, daily buckets, IoT query windows
+	// and JSON output, e.g. "Asia/Shanghai"
+	SiteTimezone string `env:"SITE_TIMEZONE" file:"server.site_timezone" default:"Local"`
+	siteLocation *time.Location
+
+	// Planned production shifts, e.g. "mon-fri=08:00-17:00;sat=08:00-12:00"
+	ShiftCalendar string `env:"SHIFT_CALENDAR" file:"server.shift_calendar" reload:"true"`
+
+	// Comma separated session metadata keys to index for filtering
+	MetadataIndexKeys string `env:"METADATA_INDEX_KEYS" file:"server.metadata_index_keys"`
+
+	// Database configuration: DatabaseDriver is sqlite (DatabasePath) or
+	// postgres/timescaledb (DatabaseURL)
+	DatabaseDriver    string `env:"DATABASE_DRIVER" file:"database.driver" default:"sqlite"`
+	DatabasePath      string `env:"DATABASE_PATH" file:"database.path" default:"./database/device_monitor.db"`
+	DatabaseURL       string `env:"DATABASE_URL" file:"database.url"`
+	DatabaseTimescale bool   `env:"DATABASE_TIMESCALE" file:"database.timescale" default:"false"`
+
+	// SQLite connection tuning. Writes go through a single connection and
+	// reads through a pool of SQLiteReadConns read-only connections.
+	// SQLitePragmas holds extra "name=value" pragmas separated by commas.
+	SQLiteJournalMode   string `env:"SQLITE_JOURNAL_MODE" file:"database.sqlite.journal_mode" default:"WAL"`
+	SQLiteSynchronous   string `env:"SQLITE_SYNCHRONOUS" file:"database.sqlite.synchronous" default:"NORMAL"`
+	SQLiteBusyTimeoutMs int    `env:"SQLITE_BUSY_TIMEOUT_MS" file:"database.sqlite.busy_timeout_ms" default:"5000"`
+	SQLiteForeignKeys   bool   `env:"SQLITE_FOREIGN_KEYS" file:"database.sqlite.foreign_keys" default:"true"`
+	SQLiteReadConns     int    `env:"SQLITE_READ_CONNECTIONS" file:"database.sqlite.read_connections" default:"4"`
+	SQLitePragmas       string `env:"SQLITE_PRAGMAS" file:"database.sqlite.pragmas"`
+
+	// Apply pending schema migrations on start; in dry-run mode they are
+	// only logged and startup stops
+	DBAutoMigrate   bool `env:"DB_AUTO_MIGRATE" file:"database.auto_migrate" default:"true"`
+	DBMigrateDryRun bool `env:"DB_MIGRATE_DRY_RUN" file:"database.migrate_dry_run" default:"false"`
 
 	// IoT Platform configuration
-	IotApiBaseURL  string
-	IotAppKey      string
-	IotAppSecret   string
-	IotDeviceCode  string
+	IotApiBaseURL string `env:"IOT_API_BASE_URL" file:"iot.base_url" default:"https://iot.know-act.com" reload:"true"`
+	IotAppKey     string `env:"IOT_APP_KEY" file:"iot.app_key" reload:"true"`
+	IotAppSecret  string `env:"IOT_APP_SECRET" file:"iot.app_secret" reload:"true"`
+	IotDeviceCode string `env:"IOT_DEVICE_CODE" file:"iot.device_code" reload:"true"`
+
+	// Proxies for IoT platform requests, chosen by the request's scheme like
+	// Go's standard environment handling; user:password in a proxy URL
+	// authenticates with the proxy, and hosts matching NoProxy (comma
+	// separated hosts, domains, IPs or CIDRs) are reached directly
+	HttpProxy  string `env:"HTTP_PROXY,http_proxy" file:"iot.http_proxy"`
+	HttpsProxy string `env:"HTTPS_PROXY,https_proxy" file:"iot.https_proxy"`
+	NoProxy    string `env:"NO_PROXY,no_proxy" file:"iot.no_proxy"`
+
+	// TLS for IoT platform requests: server certificates are verified
+	// against the system roots plus the PEM bundle IotTLSCAFile, and
+	// IotTLSCertFile/IotTLSKeyFile present a client certificate (mTLS).
+	// IotTLSInsecure disables verification and is only for testing.
+	IotTLSCAFile   string `env:"IOT_TLS_CA_FILE" file:"iot.tls.ca_file"`
+	IotTLSCertFile string `env:"IOT_TLS_CERT_FILE" file:"iot.tls.cert_file"`
+	IotTLSKeyFile  string `env:"IOT_TLS_KEY_FILE" file:"iot.tls.key_file"`
+	IotTLSInsecure bool   `env:"IOT_TLS_INSECURE_SKIP_VERIFY" file:"iot.tls.insecure_skip_verify" default:"false"`
+
+	// Sessions starting less than this many seconds after the device's
+	// previous session ended are merged into it when they end (0 disables)
+	MergeGapSeconds int `env:"MERGE_GAP_SECONDS" file:"webhooks.merge_gap_seconds" default:"0" reload:"true"`
+
+	// Report configuration; ReportWebhookURL receives generated reports
+	ReportTemplateDir string `env:"REPORT_TEMPLATE_DIR" file:"reports.template_dir" reload:"true"`
+	ReportWebhookURL  string `env:"REPORT_WEBHOOK_URL" file:"webhooks.report_url" reload:"true"`
+
+	// Thresholds for flagging sessions in the fleet overview and reports
+	StaleSessionHours   int `env:"ALERT_STALE_SESSION_HOURS" file:"alerts.stale_session_hours" default:"24" reload:"true"`
+	ShortSessionSeconds int `env:"ALERT_SHORT_SESSION_SECONDS" file:"alerts.short_session_seconds" default:"60" reload:"true"`
+
+	// Background jobs; an empty or "off" schedule disables a job
+	ReportDailyCron      string `env:"REPORT_DAILY_CRON" file:"jobs.report_daily_cron" default:"0 7 * * *" reload:"true"`
+	ReportWeeklyCron     string `env:"REPORT_WEEKLY_CRON" file:"jobs.report_weekly_cron" default:"0 7 * * 1" reload:"true"`
+	TrashPurgeCron       string `env:"TRASH_PURGE_CRON" file:"jobs.trash_purge_cron" default:"30 3 * * *" reload:"true"`
+	BackupCron           string `env:"BACKUP_CRON" file:"jobs.backup_cron" default:"0 2 * * *" reload:"true"`
+	TelemetryCompactCron string `env:"TELEMETRY_COMPACT_CRON" file:"jobs.telemetry_compact_cron" default:"10 * * * *" reload:"true"`
+
+	// Seconds between fleet overview snapshot refreshes
+	FleetRefreshSeconds int `env:"FLEET_REFRESH_SECONDS" file:"jobs.fleet_refresh_seconds" default:"60" reload:"true"`
+
+	// Days deleted sessions stay in the trash before being purged (0 keeps
+	// them forever)
+	TrashRetentionDays int `env:"TRASH_RETENTION_DAYS" file:"retention.trash_days" default:"30" reload:"true"`
+
+	// IoT data retention: TelemetryRetention is the default policy, e.g.
+	// "raw=30d,minute=1y,hour=forever", and TelemetryRetentionPoints
+	// overrides it per point
+	TelemetryRetention       string `env:"TELEMETRY_RETENTION" file:"retention.telemetry" reload:"true"`
+	TelemetryRetentionPoints string `env:"TELEMETRY_RETENTION_POINTS" file:"retention.telemetry_points" reload:"true"`
+
+	// Scheduled SQLite backups into BackupDir, gzipped with BackupCompress,
+	// keeping the newest BackupKeep (0 keeps all)
+	BackupDir      string `env:"BACKUP_DIR" file:"backup.dir" default:"./database/backups" reload:"true"`
+	BackupKeep     int    `env:"BACKUP_KEEP" file:"backup.keep" default:"7" reload:"true"`
+	BackupCompress bool   `env:"BACKUP_COMPRESS" file:"backup.compress" default:"false" reload:"true"`
+}
+
+// current holds the configuration. A reload replaces it with a new value
+// rather than modifying it, so a Config read from it stays consistent.
+var current atomic.Pointer[Config]
+
+// Current returns the current configuration. It is safe to call while a
+// reload is in progress; callers that read several related settings should
+// keep the returned value rather than calling Current again.
+func Current() *Config {
+	return current.Load()
+}
+
+// ReloadResult lists the settings a reload changed and those it left alone
+// because they only take effect on restart
+type ReloadResult struct {
+	Changed []string `json:"changed"`
+	Ignored []string `json:"ignored"`
+}
+
+var (
+	reloadMutex sync.Mutex
 
-	// Proxy configuration (optional)
-	HttpProxy  string
-	HttpsProxy string
+	// Variables set from .env rather than by the process environment, which
+	// a reload may change
+	dotenvVars map[string]bool
+)
+
+// LoadConfig loads the configuration and makes it current
+func LoadConfig() error {
+	c, err := Load()
+	if err != nil {
+		return err
+	}
+	current.Store(c)
+	return nil
 }
 
-var AppConfig *Config
+// Load reads the configuration without installing it: built-in defaults,
+// then the YAML or TOML file named by CONFIG_FILE, then .env, then the
+// process environment, each overriding the one before. All invalid settings
+// are reported together.
+func Load() (*Config, error) {
+	loadDotenv()
+
+	var file map[string]interface{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Config{}
+	var errs []error
+	unparsed := map[string]bool{}
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range settings() {
+		raw, inFile := f.Tag.Get("default"), false
+		if value, ok := file[f.Tag.Get("file")]; ok {
+			raw, inFile = fmt.Sprint(value), true
+			delete(file, f.Tag.Get("file"))
+		}
+		for _, env := range strings.Split(f.Tag.Get("env"), ",") {
+			if value, ok := os.LookupEnv(env); ok && (value != "" || f.Type.Kind() == reflect.String) {
+				raw, inFile = value, false
+				break
+			}
+		}
 
-func LoadConfig() {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+		if err := setField(v.FieldByIndex(f.Index), raw); err != nil {
+			if inFile {
+				err = fmt.Errorf("%w in %s", err, os.Getenv("CONFIG_FILE"))
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", settingName(f), err))
+			unparsed[settingName(f)] = true
+		}
 	}
+	for key := range file {
+		errs = append(errs, fmt.Errorf("%s: unknown setting in %s", key, os.Getenv("CONFIG_FILE")))
+	}
+
+	// Settings that failed to parse are not validated again
+	for _, err := range c.validate() {
+		if name, _, _ := strings.Cut(err.Error(), ":"); !unparsed[name] {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %w", joinErrors(errs))
+	}
+	return c, nil
+}
 
-	AppConfig = &Config{
-		Port:        getEnv("PORT", "3000"),
-		Environment: getEnv("NODE_ENV", "development"),
+// Reload re-reads the configuration and installs the settings tagged
+// reload; the rest keep their current values until restart. An invalid
+// configuration is rejected as a whole. check can veto the new settings.
+func Reload(check func(*Config) error) (*ReloadResult, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
 
-		DatabasePath: getEnv("DATABASE_PATH", "./database/device_monitor.db"),
+	next, err := Load()
+	if err != nil {
+		return nil, err
+	}
 
-		IotApiBaseURL:  getEnv("IOT_API_BASE_URL", "https://iot.know-act.com"),
-		IotAppKey:      getEnv("IOT_APP_KEY", ""),
-		IotAppSecret:   getEnv("IOT_APP_SECRET", ""),
-		IotDeviceCode:  getEnv("IOT_DEVICE_CODE", ""),
+	active := Current()
+	merged := *active
+	result := &ReloadResult{Changed: []string{}, Ignored: []string{}}
+	cur, nxt, out := reflect.ValueOf(active).Elem(), reflect.ValueOf(next).Elem(), reflect.ValueOf(&merged).Elem()
+	for _, f := range settings() {
+		if reflect.DeepEqual(cur.FieldByIndex(f.Index).Interface(), nxt.FieldByIndex(f.Index).Interface()) {
+			continue
+		}
+		if f.Tag.Get("reload") != "true" {
+			result.Ignored = append(result.Ignored, settingName(f))
+			continue
+		}
+		out.FieldByIndex(f.Index).Set(nxt.FieldByIndex(f.Index))
+		result.Changed = append(result.Changed, settingName(f))
+	}
 
-		HttpProxy:  getEnv("HTTP_PROXY", ""),
-		HttpsProxy: getEnv("HTTPS_PROXY", ""),
+	if check != nil {
+		if err := check(&merged); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
 	}
+	current.Store(&merged)
+	return result, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// settings lists the configurable fields of Config
+func settings() []reflect.StructField {
+	t := reflect.TypeOf(Config{})
+	fields := []reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("env") != "" {
+			fields = append(fields, f)
+		}
 	}
-	return defaultValue
+	return fields
+}
+
+// settingName names a setting by its file key and main environment variable
+func settingName(f reflect.StructField) string {
+	return fmt.Sprintf("%s (%s)", f.Tag.Get("file"), envName(f))
+}
+
+// envName is the main environment variable of a setting; the env tag may
+// list lowercase spellings after it
+func envName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+	return name
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+func setField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(strings.TrimSpace(raw))
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Kind())
 	}
-	return defaultValue
+	return nil
 }
 
-func getEnvAsBool(key string, defaultValue bool) bool {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.ParseBool(valueStr); err == nil {
-		return value
+// loadDotenv copies .env into the environment without overriding variables
+// the process was started with, and drops variables removed from .env since
+// the last load
+func loadDotenv() {
+	vars, err := godotenv.Read()
+	if dotenvVars == nil {
+		dotenvVars = map[string]bool{}
+		if err != nil {
+			log.Println("No .env file found, using environment variables")
+		}
+	}
+
+	for key := range dotenvVars {
+		if _, ok := vars[key]; !ok {
+			os.Unsetenv(key)
+			delete(dotenvVars, key)
+		}
+	}
+	for key, value := range vars {
+		if _, ok := os.LookupEnv(key); ok && !dotenvVars[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		dotenvVars[key] = true
 	}
-	return defaultValue
+}
+
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(env, format string, args ...interface{}) {
+		for _, f := range settings() {
+			if envName(f) == env {
+				errs = append(errs, fmt.Errorf("%s: %s", settingName(f), fmt.Sprintf(format, args...)))
+				return
+			}
+		}
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT", "must be a port number, got %q", c.Port)
+	}
+
+	loc, err := time.LoadLocation(c.SiteTimezone)
+	if err != nil {
+		fail("SITE_TIMEZONE", "unknown time zone %q", c.SiteTimezone)
+	}
+	c.siteLocation = loc
+
+	switch c.DatabaseDriver {
+	case "sqlite", "sqlite3":
+		if c.DatabasePath == "" {
+			fail("DATABASE_PATH", "is required for SQLite")
+		}
+	case "postgres", "postgresql", "timescaledb":
+		if c.DatabaseURL == "" {
+			fail("DATABASE_URL", "is required for %s", c.DatabaseDriver)
+		}
+	default:
+		fail("DATABASE_DRIVER", "must be sqlite, postgres or timescaledb, got %q", c.DatabaseDriver)
+	}
+
+	if !oneOf(c.SQLiteJournalMode, "", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF") {
+		fail("SQLITE_JOURNAL_MODE", "must be DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF, got %q", c.SQLiteJournalMode)
+	}
+	if !oneOf(c.SQLiteSynchronous, "", "OFF", "NORMAL", "FULL", "EXTRA", "0", "1", "2", "3") {
+		fail("SQLITE_SYNCHRONOUS", "must be OFF, NORMAL, FULL or EXTRA, got %q", c.SQLiteSynchronous)
+	}
+	if c.SQLiteBusyTimeoutMs < 0 {
+		fail("SQLITE_BUSY_TIMEOUT_MS", "must not be negative")
+	}
+	if c.SQLiteReadConns < 1 {
+		fail("SQLITE_READ_CONNECTIONS", "must be at least 1")
+	}
+
+	if err := checkURL(c.IotApiBaseURL, false); err != nil {
+		fail("IOT_API_BASE_URL", "%v", err)
+	}
+	if (c.IotTLSCertFile == "") != (c.IotTLSKeyFile == "") {
+		fail("IOT_TLS_CERT_FILE", "must be set together with IOT_TLS_KEY_FILE")
+	}
+
+	if err := checkURL(c.ReportWebhookURL, true); err != nil {
+		fail("REPORT_WEBHOOK_URL", "%v", err)
+	}
+	for env, value := range map[string]string{"HTTP_PROXY": c.HttpProxy, "HTTPS_PROXY": c.HttpsProxy} {
+		if err := checkProxyURL(value); err != nil {
+			fail(env, "%v", err)
+		}
+	}
+
+	for env, spec := range map[string]string{
+		"REPORT_DAILY_CRON":      c.ReportDailyCron,
+		"REPORT_WEEKLY_CRON":     c.ReportWeeklyCron,
+		"TRASH_PURGE_CRON":       c.TrashPurgeCron,
+		"BACKUP_CRON":            c.BackupCron,
+		"TELEMETRY_COMPACT_CRON": c.TelemetryCompactCron,
+	} {
+		if spec == "" || spec == "off" {
+			continue
+		}
+		if _, err := cron.ParseStandard(spec); err != nil {
+			fail(env, "invalid schedule %q: %v", spec, err)
+		}
+	}
+
+	for env, n := range map[string]int{
+		"MERGE_GAP_SECONDS":           c.MergeGapSeconds,
+		"ALERT_SHORT_SESSION_SECONDS": c.ShortSessionSeconds,
+		"TRASH_RETENTION_DAYS":        c.TrashRetentionDays,
+		"BACKUP_KEEP":                 c.BackupKeep,
+	} {
+		if n < 0 {
+			fail(env, "must not be negative")
+		}
+	}
+	if c.StaleSessionHours < 1 {
+		fail("ALERT_STALE_SESSION_HOURS", "must be at least 1")
+	}
+	if c.FleetRefreshSeconds < 1 {
+		fail("FLEET_REFRESH_SECONDS", "must be at least 1")
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkURL requires an absolute http or https URL
+func checkURL(value string, optional bool) error {
+	if value == "" {
+		if optional {
+			return nil
+		}
+		return errors.New("is required")
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL, got %q", value)
+	}
+	return nil
+}
+
+// checkProxyURL accepts what Go's proxy selection accepts: an http, https
+// or socks5 URL, or a bare host:port meaning an http proxy
+func checkProxyURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		if u, err = url.Parse("http://" + value); err != nil || u.Host == "" || strings.Contains(value, "://") {
+			// The value is not echoed as it may hold proxy credentials
+			return errors.New("must be an http, https or socks5 proxy URL")
+		}
+	}
+	return nil
+}
+
+// joinErrors puts each error on its own indented line
+func joinErrors(errs []error) error {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "\n  "))
+}
+
+// SiteLocation returns the configured site timezone
+func SiteLocation() *time.Location {
+	c := Current()
+	if c == nil || c.siteLocation == nil {
+		return time.Local
+	}
+	return c.siteLocation
 }
 
 func IsProduction() bool {
-	return AppConfig.Environment == "production"
+	return Current().Environment == "production"
 }
 
 func IsDevelopment() bool {
-	return AppConfig.Environment == "development"
-}
\ No newline at end of file
+	return Current().Environment == "development"
+}
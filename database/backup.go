@@ -0,0 +1,351 @@
+package database
+
+import (
+	"compress/gzip"
+	"device-monitor-go/config"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBackupUnsupported is returned for databases other than SQLite, which
+// are backed up with their own tools such as pg_dump
+var ErrBackupUnsupported = errors.New("backups are only supported for SQLite databases")
+
+// backupTimeFormat names backups so that they sort chronologically
+const backupTimeFormat = "20060102-150405"
+
+// BackupInfo describes one backup file
+type BackupInfo struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// backupPrefix is the file name prefix of backups of the configured database
+func backupPrefix() string {
+	base := filepath.Base(config.Current().DatabasePath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// Backup writes a consistent copy of the live database into dir using
+// VACUUM INTO, which leaves out free pages. It runs on its own connection
+// inside a read transaction, so in WAL mode the server keeps reading and
+// writing meanwhile. With compress the copy is gzipped.
+func Backup(dir string, compress bool) (*BackupInfo, error) {
+	if DB == nil || DB.Dialect.Name() != "sqlite" {
+		return nil, ErrBackupUnsupported
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	name := backupPrefix() + now.Format(backupTimeFormat) + ".db"
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	// Write to a temporary name so a failed backup never looks complete.
+	// The reader pool is query-only, which VACUUM INTO does not allow.
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	cfg := config.Current()
+	conn, err := openSQLitePool(cfg.DatabasePath,
+		[]string{fmt.Sprintf("busy_timeout = %d", cfg.SQLiteBusyTimeoutMs)}, 1)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Exec(`VACUUM INTO ?`, tmp)
+	conn.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+
+	if compress {
+		err = gzipFile(tmp, path+".gz")
+		os.Remove(tmp)
+		path += ".gz"
+	} else {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+
+	return backupInfo(path)
+}
+
+// ListBackups lists the backups in dir, newest first
+func ListBackups(dir string) ([]*BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []*BackupInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := backupInfo(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue // not a backup
+		}
+		backups = append(backups, info)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// PruneBackups deletes all but the newest keep backups in dir and returns
+// the deleted ones; keep <= 0 keeps everything
+func PruneBackups(dir string, keep int) ([]*BackupInfo, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil || len(backups) <= keep {
+		return nil, err
+	}
+
+	pruned := backups[keep:]
+	for _, b := range pruned {
+		if err := os.Remove(b.Path); err != nil {
+			return nil, err
+		}
+	}
+	return pruned, nil
+}
+
+// backupInfo describes a backup file, failing for files not named like one
+func backupInfo(path string) (*BackupInfo, error) {
+	name := filepath.Base(path)
+	stamp := strings.TrimPrefix(name, backupPrefix())
+	compressed := strings.HasSuffix(stamp, ".gz")
+	stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".gz"), ".db")
+	if !strings.HasPrefix(name, backupPrefix()) {
+		return nil, fmt.Errorf("%s is not a backup", name)
+	}
+	created, err := time.Parse(backupTimeFormat, stamp)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a backup", name)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupInfo{Name: name, Path: path, Size: stat.Size(), Compressed: compressed, CreatedAt: created}, nil
+}
+
+// CheckIntegrity runs SQLite's integrity check on a database file and
+// verifies that it holds this application's schema
+func CheckIntegrity(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := openSQLitePool(path, []string{"query_only = ON"}, 1)
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	defer db.Close()
+
+	results := []string{}
+	if err := db.Select(&results, `PRAGMA integrity_check`); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(results, "; "))
+	}
+
+	var tables int
+	err = db.Get(&tables, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('device_sessions', 'schema_migrations')`)
+	if err != nil {
+		return err
+	}
+	if tables != 2 {
+		return errors.New("file is not a device monitor database")
+	}
+	return nil
+}
+
+// ErrDatabaseInUse is returned by Restore while another process, such as a
+// running server, has the database open
+var ErrDatabaseInUse = errors.New("database is in use; stop the server before restoring")
+
+// Restore replaces the configured database file with a backup after
+// checking the backup's integrity. It refuses while a server has the
+// database open. The replaced database is kept next to it and its path
+// returned.
+func Restore(backupPath string) (string, error) {
+	cfg := config.Current()
+	if cfg.DatabaseDriver != "sqlite" && cfg.DatabaseDriver != "sqlite3" {
+		return "", ErrBackupUnsupported
+	}
+	dbPath := cfg.DatabasePath
+
+	unlock, err := lockDatabase(dbPath)
+	if err != nil {
+		return "", err
+	}
+	// Windows cannot rename open files, so the lock is released just
+	// before the database is swapped
+	locked := true
+	defer func() {
+		if locked {
+			unlock()
+		}
+	}()
+
+	// Work on a copy next to the database so the rename below is atomic
+	tmp := dbPath + ".restore"
+	os.Remove(tmp)
+	if strings.HasSuffix(backupPath, ".gz") {
+		err = gunzipFile(backupPath, tmp)
+	} else {
+		err = copyFile(backupPath, tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := CheckIntegrity(tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	locked = false
+	unlock()
+
+	// Keep the current database, including WAL files, until the operator
+	// removes it. A failed rename puts back the files already moved, so the
+	// database is never left missing.
+	previous := ""
+	var moved []string
+	undo := func() {
+		for i := len(moved) - 1; i >= 0; i-- {
+			os.Rename(previous+moved[i], dbPath+moved[i])
+		}
+		os.Remove(tmp)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + ".before-restore-" + time.Now().UTC().Format(backupTimeFormat)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(dbPath+suffix, previous+suffix); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				undo()
+				return "", err
+			}
+			moved = append(moved, suffix)
+		}
+	}
+
+	if err := os.Rename(tmp, dbPath); err != nil {
+		undo()
+		return "", err
+	}
+	return previous, nil
+}
+
+// lockDatabase takes an exclusive lock on a SQLite database, failing with
+// ErrDatabaseInUse while another connection has it open: connections to a
+// WAL database hold a shared lock for as long as they are open. A missing
+// database needs no lock.
+func lockDatabase(path string) (unlock func(), err error) {
+	if _, err := os.Stat(path); err != nil {
+		return func() {}, nil
+	}
+
+	// Exclusive locking mode set before the first access keeps SQLite from
+	// creating the WAL index, so the lock is taken on the database file
+	db, err := openSQLitePool(path, []string{"busy_timeout = 0", "locking_mode = EXCLUSIVE"}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("BEGIN EXCLUSIVE"); err != nil {
+		db.Close()
+		if isSQLiteBusy(err) {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, err
+	}
+	return func() {
+		db.Exec("ROLLBACK")
+		db.Close()
+	}, nil
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("%s is not a gzip file: %w", src, err)
+	}
+	defer zr.Close()
+	return writeFile(dst, zr)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+func writeFile(dst string, r io.Reader) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"device-monitor-go/config"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestSQLite opens a migrated SQLite database in a temporary directory
+func openTestSQLite(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "device_monitor.db"))
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+	return dir
+}
+
+func TestRestoreRefusesOpenDatabase(t *testing.T) {
+	dir := openTestSQLite(t)
+	backup, err := Backup(filepath.Join(dir, "backups"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(backup.Path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("Restore with the database open: got %v, want ErrDatabaseInUse", err)
+	}
+	if _, err := os.Stat(config.Current().DatabasePath); err != nil {
+		t.Fatalf("database moved by a refused restore: %v", err)
+	}
+
+	Close()
+	previous, err := Restore(backup.Path)
+	if err != nil {
+		t.Fatalf("Restore with the database closed: %v", err)
+	}
+	if _, err := os.Stat(previous); err != nil {
+		t.Fatalf("replaced database not kept: %v", err)
+	}
+	if err := CheckIntegrity(config.Current().DatabasePath); err != nil {
+		t.Fatalf("restored database: %v", err)
+	}
+}
@@ -5,99 +5,160 @@ import (
 	"device-monitor-go/config"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/lib/pq"
 )
 
-var DB *sqlx.DB
+var DB *Conn
 
-func InitDB() error {
-	// Ensure database directory exists
-	dbPath := config.AppConfig.DatabasePath
-	dbDir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		return fmt.Errorf("failed to create database directory: %w", err)
+// Conn is the shared connection pool. Its query methods accept ? placeholders
+// and rebind them for the configured driver. Get and Select run on Reader,
+// everything else, including transactions, on the embedded writer pool.
+type Conn struct {
+	*sqlx.DB
+	Reader  *sqlx.DB
+	Dialect Dialect
+}
+
+// Tx is a transaction with the same placeholder handling as Conn
+type Tx struct {
+	*sqlx.Tx
+	Dialect Dialect
+}
+
+func (c *Conn) Get(dest interface{}, query string, args ...interface{}) error {
+	return c.Reader.Get(dest, c.Rebind(query), args...)
+}
+
+func (c *Conn) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.Reader.Select(dest, c.Rebind(query), args...)
+}
+
+// Queryx runs a query on Reader and returns its rows, for results too large
+// to load at once
+func (c *Conn) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.Reader.Queryx(c.Rebind(query), args...)
+}
+
+func (c *Conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.Rebind(query), args...)
+}
+
+// Insert runs an INSERT and returns the new row's id
+func (c *Conn) Insert(query string, args ...interface{}) (int64, error) {
+	return insertID(c.DB, c.Dialect, query, args...)
+}
+
+func (tx *Tx) Get(dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.Get(dest, tx.Rebind(query), args...)
+}
+
+func (tx *Tx) Select(dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.Select(dest, tx.Rebind(query), args...)
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Rebind(query), args...)
+}
+
+// Insert runs an INSERT and returns the new row's id
+func (tx *Tx) Insert(query string, args ...interface{}) (int64, error) {
+	return insertID(tx.Tx, tx.Dialect, query, args...)
+}
+
+// insertID returns the generated id; PostgreSQL has no LastInsertId and
+// reports it with RETURNING instead
+func insertID(q sqlx.Queryer, d Dialect, query string, args ...interface{}) (int64, error) {
+	if d.Name() == "postgres" {
+		var id int64
+		err := sqlx.Get(q, &id, sqlx.Rebind(sqlx.DOLLAR, query)+" RETURNING id", args...)
+		return id, err
+	}
+
+	result, err := q.(sqlx.Execer).Exec(query, args...)
+	if err != nil {
+		return 0, err
 	}
+	return result.LastInsertId()
+}
 
-	// Open database connection
-	db, err := sqlx.Connect("sqlite3", dbPath)
+// Open connects to the configured database without touching its schema
+func Open() error {
+	var (
+		db, reader *sqlx.DB
+		dialect    Dialect
+		err        error
+	)
+	cfg := config.Current()
+
+	switch cfg.DatabaseDriver {
+	case "sqlite", "sqlite3":
+		db, reader, err = openSQLite(cfg.DatabasePath)
+		dialect = sqliteDialect{}
+	case DriverPostgres, "postgresql", "timescaledb":
+		db, err = sqlx.Connect(DriverPostgres, cfg.DatabaseURL)
+		if err == nil {
+			// PostgreSQL handles concurrent writers itself
+			db.SetMaxOpenConns(25)
+			db.SetMaxIdleConns(25)
+			reader = db
+		}
+		dialect = postgresDialect{
+			timescale: cfg.DatabaseDriver == "timescaledb" || cfg.DatabaseTimescale,
+		}
+	default:
+		return fmt.Errorf("unsupported DATABASE_DRIVER %q", cfg.DatabaseDriver)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Set database configurations
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
+	DB = &Conn{DB: db, Reader: reader, Dialect: dialect}
+	return nil
+}
 
-	DB = db
+// InitDB opens the database and brings its schema up to date. With
+// automatic migration disabled, or in dry-run mode, pending migrations
+// prevent startup instead of being applied.
+func InitDB() error {
+	if err := Open(); err != nil {
+		return err
+	}
 
-	// Initialize schema
-	if err := createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
+	if cfg := config.Current(); !cfg.DBAutoMigrate || cfg.DBMigrateDryRun {
+		pending, err := Migrate(true)
+		if err != nil {
+			return fmt.Errorf("failed to check migrations: %w", err)
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations not applied; run \"migrate up\" or enable DB_AUTO_MIGRATE", len(pending))
+		}
+	} else if _, err := Migrate(false); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	log.Println("Database initialized successfully")
 	return nil
 }
 
-func createTables() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS device_sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		device_id VARCHAR(100) NOT NULL,
-		session_id VARCHAR(100) NOT NULL UNIQUE,
-		start_time DATETIME NOT NULL,
-		end_time DATETIME,
-		duration INTEGER DEFAULT 0,
-		status VARCHAR(20) DEFAULT 'running',
-		metadata TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_device_id ON device_sessions(device_id);
-	CREATE INDEX IF NOT EXISTS idx_session_id ON device_sessions(session_id);
-	CREATE INDEX IF NOT EXISTS idx_status ON device_sessions(status);
-	CREATE INDEX IF NOT EXISTS idx_start_time ON device_sessions(start_time);
-
-	-- IoT data points table (kept for compatibility but not used for storage)
-	CREATE TABLE IF NOT EXISTS iot_data_points (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		session_id VARCHAR(100) NOT NULL,
-		point_name VARCHAR(100) NOT NULL,
-		point_value REAL,
-		unit VARCHAR(20),
-		timestamp DATETIME NOT NULL,
-		raw_data TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (session_id) REFERENCES device_sessions(session_id)
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_iot_session_id ON iot_data_points(session_id);
-	CREATE INDEX IF NOT EXISTS idx_iot_point_name ON iot_data_points(point_name);
-	CREATE INDEX IF NOT EXISTS idx_iot_timestamp ON iot_data_points(timestamp);
-	`
-
-	_, err := DB.Exec(schema)
-	return err
-}
-
 func Close() error {
-	if DB != nil {
-		return DB.Close()
+	if DB == nil {
+		return nil
 	}
-	return nil
+	if DB.Reader != DB.DB {
+		DB.Reader.Close()
+	}
+	return DB.Close()
 }
 
 // Transaction helper
-func WithTx(fn func(*sqlx.Tx) error) error {
-	tx, err := DB.Beginx()
+func WithTx(fn func(*Tx) error) error {
+	sqlTx, err := DB.Beginx()
 	if err != nil {
 		return err
 	}
+	tx := &Tx{Tx: sqlTx, Dialect: DB.Dialect}
 
 	defer func() {
 		if p := recover(); p != nil {
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Dialect holds the SQL that differs between the supported databases.
+// Queries are otherwise written once with ? placeholders.
+type Dialect interface {
+	// Name identifies the dialect and its migrations directory
+	Name() string
+
+	// Time wraps a timestamp column or placeholder so that it compares
+	// chronologically; TimeArg converts a time into a matching argument
+	Time(expr string) string
+	TimeArg(t time.Time) interface{}
+
+	// JSONValue extracts the value at a path of object keys from a JSON
+	// text column. Keys must already be validated as safe to inline.
+	JSONValue(column string, keys []string) string
+
+	// JSONValuesLike matches any scalar value inside a JSON text column
+	// against one LIKE pattern placeholder escaped with a backslash
+	JSONValuesLike(column string) string
+
+	// Like is the case-insensitive LIKE operator
+	Like() string
+
+	// InsertIgnore turns an INSERT into one that skips conflicting rows
+	InsertIgnore(query string) string
+
+	// TimeBucket truncates a timestamp to a minute, hour or day in UTC and
+	// formats it as "YYYY-MM-DD HH:MM:SS"
+	TimeBucket(expr, unit string) (string, error)
+
+	// LocalDate formats a timestamp shifted by offset seconds as its day
+	// ("YYYY-MM-DD"), ISO week ("YYYY-Www") or month ("YYYY-MM")
+	LocalDate(expr string, offset int, unit string) (string, error)
+
+	// TableExists returns a query yielding true when the table given as its
+	// single argument exists
+	TableExists() string
+
+	// IsUniqueViolation reports whether err is a unique constraint failure
+	IsUniqueViolation(err error) bool
+}
+
+// DriverPostgres is the PostgreSQL driver name; the SQLite driver depends on
+// the build (see sqlite_cgo.go and sqlite_purego.go)
+const DriverPostgres = "postgres"
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+// SQLite stores timestamps as text in several formats (Node.js-era rows
+// included); julianday normalises them
+func (sqliteDialect) Time(expr string) string { return "julianday(" + expr + ")" }
+
+// TimeArg keeps fractional seconds so that a stored time compares equal to
+// itself, as keyset cursors require
+func (sqliteDialect) TimeArg(t time.Time) interface{} {
+	return t.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
+func (sqliteDialect) JSONValue(column string, keys []string) string {
+	path := "$"
+	for _, key := range keys {
+		path += `."` + key + `"`
+	}
+	return fmt.Sprintf("json_extract(%s, '%s')", column, path)
+}
+
+func (sqliteDialect) JSONValuesLike(column string) string {
+	return fmt.Sprintf(`CASE WHEN json_valid(%[1]s) THEN EXISTS (
+		SELECT 1 FROM json_tree(%[1]s)
+		WHERE atom IS NOT NULL AND CAST(atom AS TEXT) LIKE ? ESCAPE '\'
+	) END`, column)
+}
+
+// SQLite's LIKE is already case-insensitive for ASCII
+func (sqliteDialect) Like() string { return "LIKE" }
+
+func (sqliteDialect) InsertIgnore(query string) string {
+	return strings.Replace(query, "INSERT INTO", "INSERT OR IGNORE INTO", 1)
+}
+
+func (sqliteDialect) TimeBucket(expr, unit string) (string, error) {
+	formats := map[string]string{
+		"minute": "%Y-%m-%d %H:%M:00",
+		"hour":   "%Y-%m-%d %H:00:00",
+		"day":    "%Y-%m-%d 00:00:00",
+	}
+	format, ok := formats[unit]
+	if !ok {
+		return "", fmt.Errorf("unsupported time bucket %q", unit)
+	}
+	return fmt.Sprintf("strftime('%s', %s)", format, expr), nil
+}
+
+func (sqliteDialect) LocalDate(expr string, offset int, unit string) (string, error) {
+	shift := fmt.Sprintf("'%+d seconds'", offset)
+	switch unit {
+	case "day":
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s, %s)", expr, shift), nil
+	case "month":
+		return fmt.Sprintf("strftime('%%Y-%%m', %s, %s)", expr, shift), nil
+	case "week":
+		// The ISO week is numbered by the year and day of its Thursday
+		thursday := fmt.Sprintf("date(%s, %s, '-3 days', 'weekday 4')", expr, shift)
+		return fmt.Sprintf("strftime('%%Y', %[1]s) || '-W' || printf('%%02d', (strftime('%%j', %[1]s) - 1) / 7 + 1)", thursday), nil
+	}
+	return "", fmt.Errorf("unsupported local date unit %q", unit)
+}
+
+func (sqliteDialect) TableExists() string {
+	return `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+func (sqliteDialect) IsUniqueViolation(err error) bool {
+	return isSQLiteUniqueViolation(err)
+}
+
+// postgresDialect also serves TimescaleDB, whose time_bucket is used for
+// bucketing when enabled
+type postgresDialect struct {
+	timescale bool
+}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+// Timestamps are TIMESTAMPTZ columns and compare directly
+func (postgresDialect) Time(expr string) string { return expr }
+
+func (postgresDialect) TimeArg(t time.Time) interface{} { return t.UTC() }
+
+func (postgresDialect) JSONValue(column string, keys []string) string {
+	return fmt.Sprintf("(%s::jsonb #>> '{%s}')", column, strings.Join(keys, ","))
+}
+
+func (postgresDialect) JSONValuesLike(column string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM jsonb_path_query(%s::jsonb, 'strict $.**') AS v
+		WHERE jsonb_typeof(v) NOT IN ('object', 'array') AND v #>> '{}' ILIKE ? ESCAPE '\'
+	)`, column)
+}
+
+func (postgresDialect) Like() string { return "ILIKE" }
+
+func (postgresDialect) InsertIgnore(query string) string {
+	return query + " ON CONFLICT DO NOTHING"
+}
+
+func (d postgresDialect) TimeBucket(expr, unit string) (string, error) {
+	if unit != "minute" && unit != "hour" && unit != "day" {
+		return "", fmt.Errorf("unsupported time bucket %q", unit)
+	}
+	bucket := fmt.Sprintf("date_trunc('%s', %s AT TIME ZONE 'UTC')", unit, expr)
+	if d.timescale {
+		bucket = fmt.Sprintf("time_bucket('1 %s', %s) AT TIME ZONE 'UTC'", unit, expr)
+	}
+	return fmt.Sprintf("to_char(%s, 'YYYY-MM-DD HH24:MI:SS')", bucket), nil
+}
+
+func (postgresDialect) LocalDate(expr string, offset int, unit string) (string, error) {
+	formats := map[string]string{
+		"day":   "YYYY-MM-DD",
+		"week":  `IYYY-"W"IW`,
+		"month": "YYYY-MM",
+	}
+	format, ok := formats[unit]
+	if !ok {
+		return "", fmt.Errorf("unsupported local date unit %q", unit)
+	}
+	return fmt.Sprintf("to_char(%s AT TIME ZONE 'UTC' + interval '%d seconds', '%s')", expr, offset, format), nil
+}
+
+func (postgresDialect) TableExists() string {
+	return `SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+}
+
+func (postgresDialect) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
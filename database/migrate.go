@@ -0,0 +1,271 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Each dialect has its own migrations directory with the same versions
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationFile matches names like 0002_report_snapshots.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int        `db:"version"`
+	Name      string     `db:"name"`
+	AppliedAt *time.Time `db:"applied_at"`
+}
+
+// legacyProbes detect migrations already reflected in SQLite databases
+// created before schema_migrations existed, including Node.js-era files; each
+// query returns 1 when the migration's objects are all present
+var legacyProbes = map[int]string{
+	1: `SELECT COUNT(*) = 9 FROM sqlite_master WHERE name IN (
+		'device_sessions', 'idx_device_id', 'idx_session_id', 'idx_status', 'idx_start_time',
+		'iot_data_points', 'idx_iot_session_id', 'idx_iot_point_name', 'idx_iot_timestamp')`,
+	2: `SELECT COUNT(*) = 2 FROM sqlite_master WHERE name IN ('report_snapshots', 'idx_report_period')`,
+	3: `SELECT COUNT(*) = 2 FROM sqlite_master WHERE name IN ('idx_device_start_time', 'idx_duration')`,
+	4: `SELECT COUNT(*) = 4 FROM sqlite_master WHERE name IN (
+		'session_annotations', 'idx_annotation_session', 'tags', 'session_tags')`,
+	5: `SELECT COUNT(*) = 3 FROM sqlite_master WHERE name IN (
+		'session_audit_log', 'audit_log_no_update', 'audit_log_no_delete')`,
+	6: `SELECT COUNT(*) = 1 FROM pragma_table_info('device_sessions') WHERE name = 'deleted_at'`,
+}
+
+// loadMigrations reads the embedded migrations of the connected database's
+// dialect ordered by version
+func loadMigrations() ([]*Migration, error) {
+	dir := "migrations/" + DB.Dialect.Name()
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file name: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates schema_migrations, adopting a database that
+// predates it by recording the migrations its schema already contains
+func ensureMigrationsTable() error {
+	var exists bool
+	err := DB.Get(&exists, DB.Dialect.TableExists(), "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+
+	// Only SQLite databases predate schema_migrations
+	legacy := false
+	if DB.Dialect.Name() == "sqlite" {
+		if err := DB.Get(&legacy, DB.Dialect.TableExists(), "device_sessions"); err != nil {
+			return err
+		}
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return WithTx(func(tx *Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)
+		`)
+		if err != nil || !legacy {
+			return err
+		}
+
+		// Stop at the first missing migration so later ones still run in order
+		for _, m := range migrations {
+			probe, ok := legacyProbes[m.Version]
+			if !ok {
+				break
+			}
+			var applied bool
+			if err := tx.Get(&applied, probe); err != nil {
+				return err
+			}
+			if !applied {
+				break
+			}
+			if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+				return err
+			}
+			log.Printf("Adopted existing schema as migration %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// GetMigrationStatus lists every known migration and when it was applied
+func GetMigrationStatus() ([]*MigrationStatus, error) {
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []*MigrationStatus{}
+	if err := DB.Select(&applied, `SELECT version, name, applied_at FROM schema_migrations`); err != nil {
+		return nil, err
+	}
+	appliedAt := map[int]*time.Time{}
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		statuses = append(statuses, &MigrationStatus{Version: m.Version, Name: m.Name, AppliedAt: appliedAt[m.Version]})
+	}
+	return statuses, nil
+}
+
+// pendingMigrations returns the migrations not yet applied, oldest first
+func pendingMigrations() ([]*Migration, error) {
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []*Migration{}
+	for i, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, migrations[i])
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies all pending migrations, each in its own transaction. With
+// dryRun it only logs what would run. It returns the pending migrations.
+func Migrate(dryRun bool) ([]*Migration, error) {
+	pending, err := pendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range pending {
+		if dryRun {
+			log.Printf("Would apply migration %04d_%s:\n%s", m.Version, m.Name, m.Up)
+			continue
+		}
+
+		err := WithTx(func(tx *Tx) error {
+			// Migration scripts run verbatim, without placeholder rebinding
+			if _, err := tx.Tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+
+	return pending, nil
+}
+
+// Rollback reverts the given number of most recently applied migrations.
+// With dryRun it only logs what would run. It returns the reverted migrations.
+func Rollback(steps int, dryRun bool) ([]*Migration, error) {
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []*Migration{}
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		m := migrations[i]
+		reverted = append(reverted, m)
+
+		if dryRun {
+			log.Printf("Would revert migration %04d_%s:\n%s", m.Version, m.Name, m.Down)
+			continue
+		}
+
+		err := WithTx(func(tx *Tx) error {
+			if _, err := tx.Tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+	}
+
+	return reverted, nil
+}
@@ -0,0 +1,32 @@
+-- Schema of the SQLite version with PostgreSQL types
+CREATE TABLE IF NOT EXISTS device_sessions (
+	id BIGSERIAL PRIMARY KEY,
+	device_id VARCHAR(100) NOT NULL,
+	session_id VARCHAR(100) NOT NULL UNIQUE,
+	start_time TIMESTAMPTZ NOT NULL,
+	end_time TIMESTAMPTZ,
+	duration BIGINT DEFAULT 0,
+	status VARCHAR(20) DEFAULT 'running',
+	metadata TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_id ON device_sessions(device_id);
+CREATE INDEX IF NOT EXISTS idx_status ON device_sessions(status);
+CREATE INDEX IF NOT EXISTS idx_start_time ON device_sessions(start_time);
+
+CREATE TABLE IF NOT EXISTS iot_data_points (
+	id BIGSERIAL PRIMARY KEY,
+	session_id VARCHAR(100) NOT NULL REFERENCES device_sessions(session_id),
+	point_name VARCHAR(100) NOT NULL,
+	point_value DOUBLE PRECISION,
+	unit VARCHAR(20),
+	timestamp TIMESTAMPTZ NOT NULL,
+	raw_data TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_iot_session_id ON iot_data_points(session_id);
+CREATE INDEX IF NOT EXISTS idx_iot_point_name ON iot_data_points(point_name);
+CREATE INDEX IF NOT EXISTS idx_iot_timestamp ON iot_data_points(timestamp);
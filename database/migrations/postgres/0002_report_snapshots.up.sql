@@ -0,0 +1,12 @@
+-- Scheduled summary report snapshots
+CREATE TABLE IF NOT EXISTS report_snapshots (
+	id BIGSERIAL PRIMARY KEY,
+	period VARCHAR(20) NOT NULL,
+	period_start TIMESTAMPTZ NOT NULL,
+	period_end TIMESTAMPTZ NOT NULL,
+	content TEXT NOT NULL,
+	delivered_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_period ON report_snapshots(period, period_start);
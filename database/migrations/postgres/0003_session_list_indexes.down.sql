@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_duration;
+DROP INDEX IF EXISTS idx_device_start_time;
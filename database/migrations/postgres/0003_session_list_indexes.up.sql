@@ -0,0 +1,3 @@
+-- Indexes for filtering and sorting session lists
+CREATE INDEX IF NOT EXISTS idx_device_start_time ON device_sessions(device_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_duration ON device_sessions(duration);
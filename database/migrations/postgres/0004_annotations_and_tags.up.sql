@@ -0,0 +1,32 @@
+-- Operator notes and timeline markers on sessions
+CREATE TABLE IF NOT EXISTS session_annotations (
+	id BIGSERIAL PRIMARY KEY,
+	session_id VARCHAR(100) NOT NULL REFERENCES device_sessions(session_id),
+	kind VARCHAR(20) NOT NULL DEFAULT 'note',
+	body TEXT NOT NULL,
+	marker_time TIMESTAMPTZ,
+	author VARCHAR(100) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotation_session ON session_annotations(session_id);
+
+-- Managed tag vocabulary and tag assignments
+CREATE TABLE IF NOT EXISTS tags (
+	id BIGSERIAL PRIMARY KEY,
+	name VARCHAR(50) NOT NULL UNIQUE,
+	color VARCHAR(20) NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS session_tags (
+	session_id VARCHAR(100) NOT NULL REFERENCES device_sessions(session_id),
+	tag_id BIGINT NOT NULL REFERENCES tags(id),
+	author VARCHAR(100) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (session_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags(tag_id);
@@ -0,0 +1,26 @@
+-- Append-only history of manual session changes
+CREATE TABLE IF NOT EXISTS session_audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	session_id VARCHAR(100) NOT NULL,
+	action VARCHAR(20) NOT NULL,
+	actor VARCHAR(100) NOT NULL DEFAULT '',
+	reason TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '[]',
+	before_data TEXT,
+	after_data TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_session ON session_audit_log(session_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON session_audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON session_audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,4 @@
+-- Sessions in the trash
+ALTER TABLE device_sessions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_deleted_at ON device_sessions(deleted_at);
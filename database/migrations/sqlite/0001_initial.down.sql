@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS iot_data_points;
+DROP TABLE IF EXISTS device_sessions;
@@ -0,0 +1,35 @@
+-- Schema inherited from the Node.js version
+CREATE TABLE IF NOT EXISTS device_sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	device_id VARCHAR(100) NOT NULL,
+	session_id VARCHAR(100) NOT NULL UNIQUE,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME,
+	duration INTEGER DEFAULT 0,
+	status VARCHAR(20) DEFAULT 'running',
+	metadata TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_id ON device_sessions(device_id);
+CREATE INDEX IF NOT EXISTS idx_session_id ON device_sessions(session_id);
+CREATE INDEX IF NOT EXISTS idx_status ON device_sessions(status);
+CREATE INDEX IF NOT EXISTS idx_start_time ON device_sessions(start_time);
+
+-- IoT data points table (kept for compatibility but not used for storage)
+CREATE TABLE IF NOT EXISTS iot_data_points (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id VARCHAR(100) NOT NULL,
+	point_name VARCHAR(100) NOT NULL,
+	point_value REAL,
+	unit VARCHAR(20),
+	timestamp DATETIME NOT NULL,
+	raw_data TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (session_id) REFERENCES device_sessions(session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_iot_session_id ON iot_data_points(session_id);
+CREATE INDEX IF NOT EXISTS idx_iot_point_name ON iot_data_points(point_name);
+CREATE INDEX IF NOT EXISTS idx_iot_timestamp ON iot_data_points(timestamp);
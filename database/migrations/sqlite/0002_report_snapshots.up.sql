@@ -0,0 +1,12 @@
+-- Scheduled summary report snapshots
+CREATE TABLE IF NOT EXISTS report_snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	period VARCHAR(20) NOT NULL,
+	period_start DATETIME NOT NULL,
+	period_end DATETIME NOT NULL,
+	content TEXT NOT NULL,
+	delivered_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_period ON report_snapshots(period, period_start);
@@ -0,0 +1,35 @@
+-- Operator notes and timeline markers on sessions
+CREATE TABLE IF NOT EXISTS session_annotations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id VARCHAR(100) NOT NULL,
+	kind VARCHAR(20) NOT NULL DEFAULT 'note',
+	body TEXT NOT NULL,
+	marker_time DATETIME,
+	author VARCHAR(100) NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (session_id) REFERENCES device_sessions(session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotation_session ON session_annotations(session_id);
+
+-- Managed tag vocabulary and tag assignments
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) NOT NULL UNIQUE,
+	color VARCHAR(20) NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS session_tags (
+	session_id VARCHAR(100) NOT NULL,
+	tag_id INTEGER NOT NULL,
+	author VARCHAR(100) NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (session_id, tag_id),
+	FOREIGN KEY (session_id) REFERENCES device_sessions(session_id),
+	FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags(tag_id);
@@ -0,0 +1,24 @@
+-- Append-only history of manual session changes
+CREATE TABLE IF NOT EXISTS session_audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id VARCHAR(100) NOT NULL,
+	action VARCHAR(20) NOT NULL,
+	actor VARCHAR(100) NOT NULL DEFAULT '',
+	reason TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '[]',
+	before_data TEXT,
+	after_data TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_session ON session_audit_log(session_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON session_audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON session_audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
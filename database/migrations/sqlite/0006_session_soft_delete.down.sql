@@ -0,0 +1,3 @@
+-- Trashed sessions become live again
+DROP INDEX IF EXISTS idx_deleted_at;
+ALTER TABLE device_sessions DROP COLUMN deleted_at;
@@ -0,0 +1,2 @@
+-- Rolled-up IoT data is lost
+DROP TABLE IF EXISTS iot_data_rollups;
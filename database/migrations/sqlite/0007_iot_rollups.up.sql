@@ -0,0 +1,18 @@
+-- Per-minute and per-hour aggregates of expired IoT data points.
+-- bucket_start is UTC text "YYYY-MM-DD HH:MM:SS" so that it compares
+-- and re-buckets the same way on every database.
+CREATE TABLE IF NOT EXISTS iot_data_rollups (
+	resolution VARCHAR(10) NOT NULL,
+	session_id VARCHAR(100) NOT NULL,
+	point_name VARCHAR(100) NOT NULL,
+	bucket_start VARCHAR(19) NOT NULL,
+	unit VARCHAR(20),
+	sample_count INTEGER NOT NULL,
+	value_sum REAL NOT NULL,
+	min_value REAL NOT NULL,
+	max_value REAL NOT NULL,
+	PRIMARY KEY (resolution, session_id, point_name, bucket_start),
+	FOREIGN KEY (session_id) REFERENCES device_sessions(session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_iot_rollups_bucket ON iot_data_rollups(resolution, bucket_start);
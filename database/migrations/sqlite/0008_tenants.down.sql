@@ -0,0 +1,9 @@
+-- Everything returns to a single tenant; other tenants' sessions stay
+-- mixed in with the default tenant's
+DROP INDEX IF EXISTS idx_report_tenant_period;
+DROP INDEX IF EXISTS idx_audit_tenant;
+DROP INDEX IF EXISTS idx_tenant_device_start;
+ALTER TABLE report_snapshots DROP COLUMN tenant_id;
+ALTER TABLE session_audit_log DROP COLUMN tenant_id;
+ALTER TABLE device_sessions DROP COLUMN tenant_id;
+DROP TABLE IF EXISTS tenants;
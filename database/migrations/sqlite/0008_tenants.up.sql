@@ -0,0 +1,26 @@
+-- Tenants own sessions, their audit history and summary reports. The
+-- default tenant owns everything recorded before tenants existed and uses
+-- the IOT_* settings; API keys and webhook secrets are stored as SHA-256.
+CREATE TABLE IF NOT EXISTS tenants (
+	id VARCHAR(50) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL DEFAULT '',
+	api_key_hash VARCHAR(64) UNIQUE,
+	webhook_secret_hash VARCHAR(64) UNIQUE,
+	iot_api_base_url VARCHAR(255) NOT NULL DEFAULT '',
+	iot_app_key VARCHAR(255) NOT NULL DEFAULT '',
+	iot_app_secret VARCHAR(255) NOT NULL DEFAULT '',
+	iot_device_code VARCHAR(100) NOT NULL DEFAULT '',
+	report_webhook_url VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tenants (id, name) VALUES ('default', 'Default');
+
+ALTER TABLE device_sessions ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+ALTER TABLE session_audit_log ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+ALTER TABLE report_snapshots ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_tenant_device_start ON device_sessions(tenant_id, device_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_audit_tenant ON session_audit_log(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_report_tenant_period ON report_snapshots(tenant_id, period, period_start);
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"device-monitor-go/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// pragmaConnector opens driver connections and applies pragmas to each, so
+// that every pooled connection is configured the same way whichever SQLite
+// driver the build uses
+type pragmaConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+}
+
+func (c *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("sqlite driver %s cannot execute pragmas", sqliteDriver)
+	}
+	for _, pragma := range c.pragmas {
+		if _, err := execer.ExecContext(ctx, "PRAGMA "+pragma, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("PRAGMA %s: %w", pragma, err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *pragmaConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// sqlitePragmas returns the configured pragmas; busy_timeout comes first so
+// that the remaining ones wait for locks too
+func sqlitePragmas() []string {
+	cfg := config.Current()
+	pragmas := []string{fmt.Sprintf("busy_timeout = %d", cfg.SQLiteBusyTimeoutMs)}
+	if cfg.SQLiteJournalMode != "" {
+		pragmas = append(pragmas, "journal_mode = "+cfg.SQLiteJournalMode)
+	}
+	if cfg.SQLiteSynchronous != "" {
+		pragmas = append(pragmas, "synchronous = "+cfg.SQLiteSynchronous)
+	}
+	if cfg.SQLiteForeignKeys {
+		pragmas = append(pragmas, "foreign_keys = ON")
+	} else {
+		pragmas = append(pragmas, "foreign_keys = OFF")
+	}
+	for _, pragma := range strings.Split(cfg.SQLitePragmas, ",") {
+		if pragma = strings.TrimSpace(pragma); pragma != "" {
+			pragmas = append(pragmas, pragma)
+		}
+	}
+	return pragmas
+}
+
+// openSQLitePool opens a pool of up to conns connections to a database file,
+// each configured with the given pragmas
+func openSQLitePool(path string, pragmas []string, conns int) (*sqlx.DB, error) {
+	probe, err := sql.Open(sqliteDriver, "")
+	if err != nil {
+		return nil, err
+	}
+	drv := probe.Driver()
+	probe.Close()
+
+	db := sqlx.NewDb(sql.OpenDB(&pragmaConnector{driver: drv, dsn: sqliteDSN(path), pragmas: pragmas}), sqliteDriver)
+	db.SetMaxOpenConns(conns)
+	db.SetMaxIdleConns(conns)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openSQLite opens the database file as a single-connection writer pool, so
+// concurrent writes queue in Go instead of failing with "database is
+// locked", and a pool of query-only reader connections, which WAL lets run
+// alongside the writer
+func openSQLite(path string) (*sqlx.DB, *sqlx.DB, error) {
+	// Ensure database directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	pragmas := sqlitePragmas()
+
+	// The writer connects first so the journal mode is set before readers open
+	writer, err := openSQLitePool(path, pragmas, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	readConns := config.Current().SQLiteReadConns
+	if readConns < 1 {
+		readConns = 1
+	}
+	reader, err := openSQLitePool(path, append(pragmas, "query_only = ON"), readConns)
+	if err != nil {
+		writer.Close()
+		return nil, nil, err
+	}
+
+	return writer, reader, nil
+}
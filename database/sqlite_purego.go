@@ -0,0 +1,35 @@
+//go:build purego
+
+package database
+
+import (
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDriver is the pure-Go SQLite driver selected by -tags purego
+const sqliteDriver = "sqlite"
+
+// sqliteDSN makes the driver store times in the same text format as
+// mattn/go-sqlite3 so that both builds read each other's files and SQLite's
+// date functions can parse the values
+func sqliteDSN(path string) string {
+	return "file:" + path + "?_time_format=sqlite"
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+func isSQLiteBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
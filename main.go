@@ -5,6 +5,8 @@ import (
 	"device-monitor-go/api/middleware"
 	"device-monitor-go/config"
 	"device-monitor-go/database"
+	"device-monitor-go/models"
+	"device-monitor-go/services"
 	"embed"
 	"fmt"
 	"io"
@@ -13,7 +15,10 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,7 +28,17 @@ var staticFiles embed.FS
 
 func main() {
 	// Load configuration
-	config.LoadConfig()
+	if err := config.LoadConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := services.ValidateConfig(config.Current()); err != nil {
+		log.Fatalf("invalid configuration:\n  %v", err)
+	}
+
+	// Subcommands such as "migrate" run instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
 	// Initialize database
 	if err := database.InitDB(); err != nil {
@@ -31,6 +46,45 @@ func main() {
 	}
 	defer database.Close()
 
+	// Index frequently filtered metadata keys
+	if err := models.EnsureMetadataIndexes(strings.Split(config.Current().MetadataIndexKeys, ",")); err != nil {
+		log.Fatalf("Failed to create metadata indexes: %v", err)
+	}
+
+	// Start scheduled summary reports
+	if err := services.StartReportScheduler(); err != nil {
+		log.Fatalf("Failed to start report scheduler: %v", err)
+	}
+	defer services.StopReportScheduler()
+
+	// Purge sessions that have been in the trash past the retention period
+	if err := services.StartTrashPurge(); err != nil {
+		log.Fatalf("Failed to start trash purge: %v", err)
+	}
+	defer services.StopTrashPurge()
+
+	// Back up the SQLite database on schedule
+	if err := services.StartBackupScheduler(); err != nil {
+		log.Fatalf("Failed to start backup scheduler: %v", err)
+	}
+	defer services.StopBackupScheduler()
+
+	// Downsample and expire IoT data past its retention
+	if err := services.StartTelemetryCompaction(); err != nil {
+		log.Fatalf("Failed to start telemetry compaction: %v", err)
+	}
+	defer services.StopTelemetryCompaction()
+
+	// Keep the fleet overview snapshot fresh
+	services.StartFleetMonitor()
+	defer services.StopFleetMonitor()
+
+	// Build the IoT client up front so its proxy and TLS settings are logged
+	services.GetIotService()
+
+	// Reload non-structural settings on SIGHUP
+	go reloadOnSignal()
+
 	// Set Gin mode
 	if config.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
@@ -50,25 +104,96 @@ func main() {
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{
 				"status": "healthy",
-				"environment": config.AppConfig.Environment,
+				"environment": config.Current().Environment,
 			})
 		})
 
+		// Webhook routes authenticate with the tenant's webhook secret
+		webhooks := api.Group("/webhooks", middleware.WebhookTenant())
+		{
+			webhooks.POST("/device/start", handlers.DeviceStart)
+			webhooks.POST("/device/end", handlers.DeviceEnd)
+			webhooks.POST("/test/start", handlers.TestWebhookStart)
+			webhooks.POST("/test/end", handlers.TestWebhookEnd)
+		}
+
+		// Routes registered from here on belong to the tenant of the
+		// request's API key
+		api.Use(middleware.Tenant())
+
 		// Session routes
 		api.GET("/sessions", handlers.GetSessions)
+		api.POST("/sessions", handlers.CreateSession)
+		api.DELETE("/sessions", handlers.DeleteSessions)
+		api.GET("/sessions/trash", handlers.GetTrash)
+		api.POST("/sessions/merge", handlers.MergeSessions)
 		api.GET("/sessions/statistics", handlers.GetStatistics)
+		api.GET("/sessions/statistics/utilization", handlers.GetUtilization)
+		api.GET("/sessions/statistics/runtime", handlers.GetRuntimeHistogram)
+		api.GET("/sessions/statistics/heatmap", handlers.GetRuntimeHeatmap)
 		api.GET("/sessions/device/:deviceId/statistics", handlers.GetDeviceStatistics)
+		api.GET("/sessions/compare", handlers.CompareSessions)
+		api.GET("/sessions/export", handlers.ExportSessions)
 		api.GET("/sessions/:id", handlers.GetSessionByID)
 		api.GET("/sessions/:id/report", handlers.GetSessionReport)
+		api.GET("/sessions/:id/report.pdf", handlers.GetSessionReportPDF)
+		api.GET("/sessions/:id/report.html", handlers.GetSessionReportHTML)
+		api.GET("/sessions/:id/export", handlers.ExportSession)
+		api.PATCH("/sessions/:id", handlers.UpdateSession)
 		api.DELETE("/sessions/:id", handlers.DeleteSession)
+		api.GET("/sessions/:id/history", handlers.GetSessionHistory)
+		api.POST("/sessions/:id/restore", handlers.RestoreSession)
+		api.POST("/sessions/:id/split", handlers.SplitSession)
+
+		// Session annotations and tags
+		api.GET("/sessions/:id/annotations", handlers.GetSessionAnnotations)
+		api.POST("/sessions/:id/annotations", handlers.CreateSessionAnnotation)
+		api.PUT("/sessions/:id/annotations/:annotationId", handlers.UpdateSessionAnnotation)
+		api.DELETE("/sessions/:id/annotations/:annotationId", handlers.DeleteSessionAnnotation)
+		api.GET("/sessions/:id/tags", handlers.GetSessionTags)
+		api.POST("/sessions/:id/tags", handlers.AddSessionTag)
+		api.DELETE("/sessions/:id/tags/:tag", handlers.RemoveSessionTag)
+
+		// Tag vocabulary
+		// The vocabulary is shared by all tenants, so only the default tenant edits it
+		api.GET("/tags", handlers.GetTags)
+		api.POST("/tags", middleware.AdminOnly(), handlers.CreateTag)
+		api.PUT("/tags/:tagId", middleware.AdminOnly(), handlers.UpdateTag)
+		api.DELETE("/tags/:tagId", middleware.AdminOnly(), handlers.DeleteTag)
+
+		// Audit log of manual session changes
+		api.GET("/audit", handlers.GetAuditLog)
+
+		// Fleet overview
+		api.GET("/fleet", handlers.GetFleet)
+
+		// Summary report routes
+		api.GET("/reports", handlers.GetReports)
+		api.POST("/reports/generate", handlers.GenerateReport)
+		api.GET("/reports/:id", handlers.GetReport)
+		api.GET("/reports/:id/download", handlers.DownloadReport)
 
-		// Webhook routes
-		webhooks := api.Group("/webhooks")
+		// Instance administration is reserved for the default tenant
+		admin := api.Group("/admin", middleware.AdminOnly())
 		{
-			webhooks.POST("/device/start", handlers.DeviceStart)
-			webhooks.POST("/device/end", handlers.DeviceEnd)
-			webhooks.POST("/test/start", handlers.TestWebhookStart)
-			webhooks.POST("/test/end", handlers.TestWebhookEnd)
+			// Configuration and database backups
+			admin.POST("/reload", handlers.ReloadConfig)
+			admin.POST("/backup", handlers.CreateBackup)
+			admin.GET("/backups", handlers.GetBackups)
+
+			// IoT data retention
+			admin.GET("/retention", handlers.GetRetention)
+			admin.POST("/retention/compact", handlers.CompactTelemetry)
+
+			// Tenants and their credentials
+			admin.GET("/tenants", handlers.GetTenants)
+			admin.POST("/tenants", handlers.CreateTenant)
+			admin.PATCH("/tenants/:tenantId", handlers.UpdateTenant)
+			admin.DELETE("/tenants/:tenantId", handlers.DeleteTenant)
+			admin.POST("/tenants/:tenantId/api-key", handlers.RotateTenantAPIKey)
+			admin.DELETE("/tenants/:tenantId/api-key", handlers.RevokeTenantAPIKey)
+			admin.POST("/tenants/:tenantId/webhook-secret", handlers.RotateTenantWebhookSecret)
+			admin.DELETE("/tenants/:tenantId/webhook-secret", handlers.RevokeTenantWebhookSecret)
 		}
 
 		// IoT routes
@@ -176,14 +301,28 @@ func main() {
 	}
 
 	// Start server
-	port := config.AppConfig.Port
-	log.Printf("Server starting on port %s in %s mode", port, config.AppConfig.Environment)
+	cfg := config.Current()
+	port := cfg.Port
+	log.Printf("Server starting on port %s in %s mode", port, cfg.Environment)
 	
 	if err := r.Run(":" + port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
+// reloadOnSignal reloads the configuration each time the process receives
+// SIGHUP; an invalid configuration is logged and the current one kept
+func reloadOnSignal() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Println("Received SIGHUP, reloading configuration")
+		if _, err := services.ReloadConfig(); err != nil {
+			log.Printf("Configuration not reloaded: %v", err)
+		}
+	}
+}
+
 // formatJSON helper for pretty printing JSON in development
 func formatJSON(data interface{}) string {
 	if config.IsDevelopment() {
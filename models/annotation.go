@@ -0,0 +1,323 @@
+package models
+
+import (
+	"database/sql"
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Annotation kinds
+const (
+	AnnotationNote   = "note"   // free text about the whole session
+	AnnotationMarker = "marker" // free text pinned to a point in the session timeline
+)
+
+var (
+	// ErrInvalidAnnotation is returned when an annotation fails validation
+	ErrInvalidAnnotation = errors.New("invalid annotation")
+	// ErrUnknownTag is returned when assigning a tag missing from the vocabulary
+	ErrUnknownTag = errors.New("unknown tag")
+	// ErrInvalidTag is returned when a tag fails validation
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrTagExists is returned when a tag name is already in the vocabulary
+	ErrTagExists = errors.New("tag already exists")
+)
+
+// SessionAnnotation is an operator note or timeline marker on a session
+type SessionAnnotation struct {
+	ID         int        `db:"id" json:"id"`
+	SessionID  string     `db:"session_id" json:"session_id"`
+	Kind       string     `db:"kind" json:"kind"`
+	Body       string     `db:"body" json:"body"`
+	MarkerTime *time.Time `db:"marker_time" json:"marker_time"`
+	Author     string     `db:"author" json:"author"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// Tag is an entry of the managed tag vocabulary
+type Tag struct {
+	ID          int       `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Color       string    `db:"color" json:"color"`
+	Description string    `db:"description" json:"description"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// SessionTag is a tag assigned to a session
+type SessionTag struct {
+	Name      string    `db:"name" json:"name"`
+	Color     string    `db:"color" json:"color"`
+	Author    string    `db:"author" json:"author"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// AfterFind presents annotation timestamps in the site timezone
+func (a *SessionAnnotation) AfterFind() {
+	a.In(config.SiteLocation())
+}
+
+// In converts the annotation's timestamps to the given location for output
+func (a *SessionAnnotation) In(loc *time.Location) {
+	if a.MarkerTime != nil {
+		t := a.MarkerTime.In(loc)
+		a.MarkerTime = &t
+	}
+	a.CreatedAt = a.CreatedAt.In(loc)
+	a.UpdatedAt = a.UpdatedAt.In(loc)
+}
+
+// Validate checks the annotation against the session it belongs to; markers
+// must fall within the session's running time
+func (a *SessionAnnotation) Validate(session *DeviceSession) error {
+	a.Body = strings.TrimSpace(a.Body)
+	if a.Body == "" {
+		return fmt.Errorf("%w: body is required", ErrInvalidAnnotation)
+	}
+
+	switch a.Kind {
+	case AnnotationNote:
+	case AnnotationMarker:
+		if a.MarkerTime == nil {
+			return fmt.Errorf("%w: marker_time is required for markers", ErrInvalidAnnotation)
+		}
+	default:
+		return fmt.Errorf("%w: kind must be %s or %s", ErrInvalidAnnotation, AnnotationNote, AnnotationMarker)
+	}
+
+	if a.MarkerTime != nil {
+		end := time.Now()
+		if session.EndTime != nil {
+			end = *session.EndTime
+		}
+		if a.MarkerTime.Before(session.StartTime) || a.MarkerTime.After(end) {
+			return fmt.Errorf("%w: marker_time is outside the session", ErrInvalidAnnotation)
+		}
+	}
+	return nil
+}
+
+// GetSessionAnnotations lists a session's annotations in timeline order;
+// notes without a marker time are placed by creation time
+func GetSessionAnnotations(sessionID string) ([]*SessionAnnotation, error) {
+	query := `
+		SELECT * FROM session_annotations
+		WHERE session_id = ?
+		ORDER BY COALESCE(` + timeExpr("marker_time") + `, ` + timeExpr("created_at") + `), id
+	`
+
+	annotations := []*SessionAnnotation{}
+	if err := database.DB.Select(&annotations, query, sessionID); err != nil {
+		return nil, err
+	}
+	for _, a := range annotations {
+		a.AfterFind()
+	}
+	return annotations, nil
+}
+
+// GetAnnotationByID retrieves one annotation of a session
+func GetAnnotationByID(sessionID string, id int) (*SessionAnnotation, error) {
+	a := &SessionAnnotation{}
+	err := database.DB.Get(a, `SELECT * FROM session_annotations WHERE id = ? AND session_id = ?`, id, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	a.AfterFind()
+	return a, nil
+}
+
+// CreateAnnotation stores a new annotation
+func CreateAnnotation(a *SessionAnnotation) error {
+	query := `
+		INSERT INTO session_annotations (session_id, kind, body, marker_time, author)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	id, err := database.DB.Insert(query, a.SessionID, a.Kind, a.Body, utcTime(a.MarkerTime), a.Author)
+	if err != nil {
+		return err
+	}
+
+	a.ID = int(id)
+	a.CreatedAt = time.Now().In(config.SiteLocation())
+	a.UpdatedAt = a.CreatedAt
+	return nil
+}
+
+// UpdateAnnotation saves changes to an annotation's kind, body and marker time
+func UpdateAnnotation(a *SessionAnnotation) error {
+	query := `
+		UPDATE session_annotations
+		SET kind = ?, body = ?, marker_time = ?, author = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND session_id = ?
+	`
+
+	_, err := database.DB.Exec(query, a.Kind, a.Body, utcTime(a.MarkerTime), a.Author, a.ID, a.SessionID)
+	if err != nil {
+		return err
+	}
+	a.UpdatedAt = time.Now().In(config.SiteLocation())
+	return nil
+}
+
+// DeleteAnnotation deletes an annotation; sql.ErrNoRows means it did not exist
+func DeleteAnnotation(sessionID string, id int) error {
+	result, err := database.DB.Exec(`DELETE FROM session_annotations WHERE id = ? AND session_id = ?`, id, sessionID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// utcTime converts an optional time to UTC for storage
+func utcTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// normalizeTagName trims a tag name and checks it is usable
+func normalizeTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 50 {
+		return "", fmt.Errorf("%w: name must be 1-50 characters", ErrInvalidTag)
+	}
+	return name, nil
+}
+
+// GetTags lists the tag vocabulary
+func GetTags() ([]*Tag, error) {
+	tags := []*Tag{}
+	err := database.DB.Select(&tags, `SELECT * FROM tags ORDER BY name`)
+	return tags, err
+}
+
+// GetTagByID retrieves a tag
+func GetTagByID(id int) (*Tag, error) {
+	tag := &Tag{}
+	if err := database.DB.Get(tag, `SELECT * FROM tags WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// CreateTag adds a tag to the vocabulary
+func CreateTag(tag *Tag) error {
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+
+	id, err := database.DB.Insert(`INSERT INTO tags (name, color, description) VALUES (?, ?, ?)`,
+		tag.Name, tag.Color, tag.Description)
+	if err != nil {
+		return tagError(err)
+	}
+	tag.ID = int(id)
+	tag.CreatedAt = time.Now()
+	return nil
+}
+
+// UpdateTag renames or recolours a tag; assignments follow the tag
+func UpdateTag(tag *Tag) error {
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+
+	_, err = database.DB.Exec(`UPDATE tags SET name = ?, color = ?, description = ? WHERE id = ?`,
+		tag.Name, tag.Color, tag.Description, tag.ID)
+	return tagError(err)
+}
+
+// tagError reports a duplicate tag name as ErrTagExists
+func tagError(err error) error {
+	if err != nil && database.DB.Dialect.IsUniqueViolation(err) {
+		return fmt.Errorf("%w: %v", ErrTagExists, err)
+	}
+	return err
+}
+
+// DeleteTag removes a tag from the vocabulary and from every session
+func DeleteTag(id int) error {
+	return database.WithTx(func(tx *database.Tx) error {
+		// Assignments go first so the foreign key is never violated
+		if _, err := tx.Exec(`DELETE FROM session_tags WHERE tag_id = ?`, id); err != nil {
+			return err
+		}
+		result, err := tx.Exec(`DELETE FROM tags WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// GetSessionTags lists the tags assigned to a session
+func GetSessionTags(sessionID string) ([]*SessionTag, error) {
+	query := `
+		SELECT t.name, t.color, st.author, st.created_at
+		FROM session_tags st
+		JOIN tags t ON t.id = st.tag_id
+		WHERE st.session_id = ?
+		ORDER BY t.name
+	`
+
+	tags := []*SessionTag{}
+	if err := database.DB.Select(&tags, query, sessionID); err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		t.CreatedAt = t.CreatedAt.In(config.SiteLocation())
+	}
+	return tags, nil
+}
+
+// AddSessionTag assigns a vocabulary tag to a session; assigning it again
+// is a no-op
+func AddSessionTag(sessionID, name, author string) error {
+	var tagID int
+	err := database.DB.Get(&tagID, `SELECT id FROM tags WHERE name = ?`, strings.TrimSpace(name))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrUnknownTag, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	query := database.DB.Dialect.InsertIgnore(`INSERT INTO session_tags (session_id, tag_id, author) VALUES (?, ?, ?)`)
+	_, err = database.DB.Exec(query, sessionID, tagID, author)
+	return err
+}
+
+// RemoveSessionTag removes a tag from a session; sql.ErrNoRows means the
+// session did not have it
+func RemoveSessionTag(sessionID, name string) error {
+	query := `
+		DELETE FROM session_tags
+		WHERE session_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)
+	`
+
+	result, err := database.DB.Exec(query, sessionID, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
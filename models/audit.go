@@ -0,0 +1,190 @@
+package models
+
+import (
+	"database/sql"
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Audited session actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	AuditMerge   = "merge"
+	AuditSplit   = "split"
+)
+
+// AuditEntry is one append-only record of a manual change to a session.
+// Before and After are session snapshots; Before is null for creations and
+// After is null for deletions.
+type AuditEntry struct {
+	ID        int             `db:"id" json:"id"`
+	TenantID  string          `db:"tenant_id" json:"tenant_id"`
+	SessionID string          `db:"session_id" json:"session_id"`
+	Action    string          `db:"action" json:"action"`
+	Actor     string          `db:"actor" json:"actor"`
+	Reason    string          `db:"reason" json:"reason"`
+	Changes   string          `db:"changes" json:"-"`
+	Before    sql.NullString  `db:"before_data" json:"-"`
+	After     sql.NullString  `db:"after_data" json:"-"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	Fields    []string        `json:"changes"`
+	BeforeObj json.RawMessage `json:"before"`
+	AfterObj  json.RawMessage `json:"after"`
+}
+
+// AuditFilter selects one tenant's audit entries; other empty fields match
+// everything
+type AuditFilter struct {
+	TenantID  string
+	SessionID string
+	Action    string
+	Actor     string
+	Limit     int
+	Offset    int
+}
+
+// AfterFind decodes the stored snapshots and changed field list
+func (e *AuditEntry) AfterFind() error {
+	e.Fields = []string{}
+	if e.Changes != "" {
+		if err := json.Unmarshal([]byte(e.Changes), &e.Fields); err != nil {
+			return err
+		}
+	}
+	e.BeforeObj = json.RawMessage("null")
+	if e.Before.Valid {
+		e.BeforeObj = json.RawMessage(e.Before.String)
+	}
+	e.AfterObj = json.RawMessage("null")
+	if e.After.Valid {
+		e.AfterObj = json.RawMessage(e.After.String)
+	}
+	e.CreatedAt = e.CreatedAt.In(config.SiteLocation())
+	return nil
+}
+
+// sessionSnapshot serialises a session with UTC timestamps for the audit log
+func sessionSnapshot(s *DeviceSession) (sql.NullString, error) {
+	if s == nil {
+		return sql.NullString{}, nil
+	}
+	snapshot := *s
+	snapshot.In(time.UTC)
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// sessionChanges lists the editable fields that differ between two versions
+func sessionChanges(before, after *DeviceSession) []string {
+	if before == nil || after == nil {
+		return []string{}
+	}
+
+	changes := []string{}
+	if before.DeviceID != after.DeviceID {
+		changes = append(changes, "device_id")
+	}
+	if !before.StartTime.Equal(after.StartTime) {
+		changes = append(changes, "start_time")
+	}
+	if (before.EndTime == nil) != (after.EndTime == nil) ||
+		(before.EndTime != nil && !before.EndTime.Equal(*after.EndTime)) {
+		changes = append(changes, "end_time")
+	}
+	if !reflect.DeepEqual(before.DurationInt, after.DurationInt) {
+		changes = append(changes, "duration")
+	}
+	if before.Status != after.Status {
+		changes = append(changes, "status")
+	}
+	if !reflect.DeepEqual(before.MetadataObj, after.MetadataObj) {
+		changes = append(changes, "metadata")
+	}
+	return changes
+}
+
+// recordAudit appends an audit entry within the caller's transaction; it
+// belongs to the tenant of the audited session
+func recordAudit(tx *database.Tx, action, sessionID, actor, reason string, before, after *DeviceSession) error {
+	beforeData, err := sessionSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterData, err := sessionSnapshot(after)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(sessionChanges(before, after))
+	if err != nil {
+		return err
+	}
+
+	tenantID := DefaultTenantID
+	if after != nil {
+		tenantID = after.TenantID
+	} else if before != nil {
+		tenantID = before.TenantID
+	}
+
+	query := `
+		INSERT INTO session_audit_log (tenant_id, session_id, action, actor, reason, changes, before_data, after_data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(query, tenantID, sessionID, action, actor, reason, string(changes), beforeData, afterData)
+	return err
+}
+
+// GetAuditLog lists audit entries, newest first
+func GetAuditLog(filter AuditFilter) ([]*AuditEntry, int, error) {
+	where := " AND tenant_id = ?"
+	args := []interface{}{filter.TenantID}
+
+	if filter.SessionID != "" {
+		where += " AND session_id = ?"
+		args = append(args, filter.SessionID)
+	}
+	if filter.Action != "" {
+		where += " AND action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.Actor != "" {
+		where += " AND actor = ?"
+		args = append(args, filter.Actor)
+	}
+
+	var total int
+	if err := database.DB.Get(&total, `SELECT COUNT(*) FROM session_audit_log WHERE 1=1`+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT * FROM session_audit_log WHERE 1=1` + where + ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, filter.Offset)
+	}
+
+	entries := []*AuditEntry{}
+	if err := database.DB.Select(&entries, query, args...); err != nil {
+		return nil, 0, err
+	}
+	for _, e := range entries {
+		if err := e.AfterFind(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return entries, total, nil
+}
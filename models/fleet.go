@@ -0,0 +1,144 @@
+package models
+
+import (
+	"device-monitor-go/config"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Device states shown in the fleet overview
+const (
+	DeviceStateRunning = "running"
+	DeviceStateIdle    = "idle"
+)
+
+// Fleet alert types
+const (
+	AlertStaleSession   = "stale_session"
+	AlertAbnormalEnd    = "abnormal_end"
+	AlertIotUnavailable = "iot_unavailable"
+)
+
+// FleetReading is the latest value of one IoT data point
+type FleetReading struct {
+	Value float64   `json:"value"`
+	Unit  string    `json:"unit"`
+	Time  time.Time `json:"time"`
+}
+
+// FleetAlert is a condition on a device that needs attention
+type FleetAlert struct {
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// DeviceStatus is the current state of one device in the fleet overview
+type DeviceStatus struct {
+	DeviceID       string        `json:"device_id"`
+	State          string        `json:"state"`
+	SessionID      string        `json:"session_id,omitempty"` // the running session, if any
+	RunningSince   *time.Time    `json:"running_since"`
+	LastSessionEnd *time.Time    `json:"last_session_end"`
+	TodayRuntime   int64         `json:"today_runtime"`  // seconds of running time since local midnight
+	TodaySessions  int           `json:"today_sessions"` // sessions started since local midnight
+	Temperature    *FleetReading `json:"temperature"`
+	Speed          *FleetReading `json:"speed"`
+	Alerts         []FleetAlert  `json:"alerts"`
+}
+
+// GetDeviceStatuses builds the session-derived state of every known device
+// of a tenant: devices with any recorded session plus the given extra
+// device IDs. IoT readings are left for the caller to fill in.
+func GetDeviceStatuses(tenantID string, now time.Time, loc *time.Location, extra ...string) ([]*DeviceStatus, error) {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	// Sessions running today, including ones still open from earlier days
+	sessions, err := getOverlappingSessions(tenantID, "", today, tomorrow)
+	if err != nil {
+		return nil, err
+	}
+
+	lastEnded, err := Devices.LastEnded(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]*DeviceStatus{}
+	status := func(deviceID string) *DeviceStatus {
+		s, ok := statuses[deviceID]
+		if !ok {
+			s = &DeviceStatus{DeviceID: deviceID, State: DeviceStateIdle, Alerts: []FleetAlert{}}
+			statuses[deviceID] = s
+		}
+		return s
+	}
+
+	for _, id := range extra {
+		if id != "" {
+			status(id)
+		}
+	}
+
+	for deviceID, s := range lastEnded {
+		st := status(deviceID)
+		st.LastSessionEnd = s.EndTime
+		if s.IsAbnormalEnd() {
+			st.Alerts = append(st.Alerts, FleetAlert{
+				Type:    AlertAbnormalEnd,
+				Message: fmt.Sprintf("Last session %s ended abnormally", s.SessionID),
+				Since:   *s.EndTime,
+			})
+		}
+	}
+
+	for _, s := range sessions {
+		st := status(s.DeviceID)
+		if from, to, ok := sessionInterval(s, today, tomorrow, now); ok {
+			st.TodayRuntime += int64(to.Sub(from).Seconds())
+		}
+		if !s.StartTime.Before(today) {
+			st.TodaySessions++
+		}
+
+		if s.Status == "running" && (st.RunningSince == nil || s.StartTime.After(*st.RunningSince)) {
+			start := s.StartTime
+			st.State = DeviceStateRunning
+			st.SessionID = s.SessionID
+			st.RunningSince = &start
+		}
+	}
+
+	result := make([]*DeviceStatus, 0, len(statuses))
+	for _, st := range statuses {
+		if st.State == DeviceStateRunning {
+			// A fault on the previous run is no longer open once the device restarted
+			alerts := []FleetAlert{}
+			for _, a := range st.Alerts {
+				if a.Type != AlertAbnormalEnd || a.Since.After(*st.RunningSince) {
+					alerts = append(alerts, a)
+				}
+			}
+			st.Alerts = alerts
+
+			staleHours := config.Current().StaleSessionHours
+			staleAfter := time.Duration(staleHours) * time.Hour
+			if now.Sub(*st.RunningSince) > staleAfter {
+				st.Alerts = append(st.Alerts, FleetAlert{
+					Type:    AlertStaleSession,
+					Message: fmt.Sprintf("Session %s has been running for more than %d hours", st.SessionID, staleHours),
+					Since:   st.RunningSince.Add(staleAfter),
+				})
+			}
+		}
+		result = append(result, st)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeviceID < result[j].DeviceID
+	})
+	return result, nil
+}
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"device-monitor-go/database"
+	"fmt"
+	"time"
+)
+
 // IotPointSummary represents aggregated statistics for a data point
 type IotPointSummary struct {
 	PointName string  `db:"point_name" json:"point_name"`
@@ -19,23 +25,330 @@ type IotTimeSeries struct {
 	DataCount  int     `db:"data_count" json:"data_count"`
 }
 
+// IotSample is one stored value of a point. Raw points keep their own
+// timestamp and unit; expired points are represented by the average of
+// their rollup, stamped with the start of its minute or hour. Value is nil
+// for non-numeric values, which are only available in RawData.
+type IotSample struct {
+	PointName string    `db:"point_name"`
+	Timestamp time.Time `db:"timestamp"`
+	Value     *float64  `db:"point_value"`
+	RawData   string    `db:"raw_data"`
+	Unit      string    `db:"unit"`
+}
+
+// samplePageSize is the number of rows EachSample reads per query
+const samplePageSize = 1000
+
 // GetIotDataPointNames returns summary statistics for each unique point name in a session
-// Note: In the Go version, we don't store IoT data locally, so this returns empty results
 func GetIotDataPointNames(sessionID string) ([]IotPointSummary, error) {
-	// Return empty array as we don't store IoT data locally
-	return []IotPointSummary{}, nil
+	return Telemetry.PointSummaries(sessionID)
 }
 
 // GetAggregatedIotData returns time-bucketed aggregated data for a specific point
-// Note: In the Go version, we don't store IoT data locally, so this returns empty results
 func GetAggregatedIotData(sessionID string, pointName string, interval string) ([]IotTimeSeries, error) {
-	// Return empty array as we don't store IoT data locally
-	return []IotTimeSeries{}, nil
+	return Telemetry.Buckets(sessionID, pointName, interval)
+}
+
+// EachIotDataBucket streams time-bucketed aggregated data of one point, or
+// of every point when pointName is empty
+func EachIotDataBucket(sessionID, pointName, interval string, fn func(pointName string, bucket IotTimeSeries) error) error {
+	return Telemetry.EachBucket(sessionID, pointName, interval, fn)
+}
+
+// EachIotDataSample streams the stored samples of one point, or of every
+// point when pointName is empty, in time order
+func EachIotDataSample(sessionID, pointName string, fn func(IotSample) error) error {
+	return Telemetry.EachSample(sessionID, pointName, fn)
 }
 
 // GetIotDataBySessionId returns all raw IoT data points for a session
-// Note: In the Go version, we don't store IoT data locally, so this returns empty results
 func GetIotDataBySessionId(sessionID string) ([]IotDataPoint, error) {
-	// Return empty array as we don't store IoT data locally
-	return []IotDataPoint{}, nil
-}
\ No newline at end of file
+	return Telemetry.Points(sessionID)
+}
+
+type sqlTelemetryRepository struct{}
+
+func (sqlTelemetryRepository) PointSummaries(sessionID string) ([]IotPointSummary, error) {
+	// Expired points only survive as rollups, so both are combined; the
+	// average is weighted by the number of values behind each row
+	query := `
+		SELECT point_name,
+			COALESCE(MAX(unit), '') AS unit,
+			SUM(n) AS count,
+			COALESCE(MIN(min_value), 0) AS min_value,
+			COALESCE(MAX(max_value), 0) AS max_value,
+			COALESCE(SUM(value_sum) / NULLIF(SUM(value_count), 0), 0) AS avg_value
+		FROM (
+			SELECT point_name, unit, COUNT(*) AS n, COUNT(point_value) AS value_count,
+				SUM(point_value) AS value_sum, MIN(point_value) AS min_value, MAX(point_value) AS max_value
+			FROM iot_data_points
+			WHERE session_id = ?
+			GROUP BY point_name, unit
+			UNION ALL
+			SELECT point_name, unit, SUM(sample_count), SUM(sample_count),
+				SUM(value_sum), MIN(min_value), MAX(max_value)
+			FROM iot_data_rollups
+			WHERE session_id = ?
+			GROUP BY point_name, unit
+		) AS t
+		GROUP BY point_name
+		ORDER BY point_name
+	`
+
+	summaries := []IotPointSummary{}
+	if err := database.DB.Select(&summaries, query, sessionID, sessionID); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (r sqlTelemetryRepository) Buckets(sessionID, pointName, interval string) ([]IotTimeSeries, error) {
+	series := []IotTimeSeries{}
+	err := r.EachBucket(sessionID, pointName, interval, func(_ string, bucket IotTimeSeries) error {
+		series = append(series, bucket)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// pointBucket is one time bucket of one point
+type pointBucket struct {
+	PointName string `db:"point_name"`
+	IotTimeSeries
+}
+
+func (sqlTelemetryRepository) EachBucket(sessionID, pointName, interval string, fn func(string, IotTimeSeries) error) error {
+	bucket, err := database.DB.Dialect.TimeBucket("timestamp", interval)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	rollup, err := rollupBucket(interval)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+
+	where := "session_id = ?"
+	args := []interface{}{sessionID}
+	if pointName != "" {
+		where += " AND point_name = ?"
+		args = append(args, pointName)
+	}
+
+	// Where raw points have expired the rollups stand in for them, at hourly
+	// resolution once minute rollups have expired too
+	query := fmt.Sprintf(`
+		SELECT point_name, time_bucket,
+			COALESCE(SUM(value_sum) / NULLIF(SUM(value_count), 0), 0) AS avg_value,
+			COALESCE(MIN(min_value), 0) AS min_value,
+			COALESCE(MAX(max_value), 0) AS max_value,
+			SUM(n) AS data_count
+		FROM (
+			SELECT point_name, %s AS time_bucket, COUNT(*) AS n, COUNT(point_value) AS value_count,
+				SUM(point_value) AS value_sum, MIN(point_value) AS min_value, MAX(point_value) AS max_value
+			FROM iot_data_points
+			WHERE %s
+			GROUP BY 1, 2
+			UNION ALL
+			SELECT point_name, %s, SUM(sample_count), SUM(sample_count),
+				SUM(value_sum), MIN(min_value), MAX(max_value)
+			FROM iot_data_rollups
+			WHERE %s
+			GROUP BY 1, 2
+		) AS t
+		GROUP BY point_name, time_bucket
+		ORDER BY time_bucket, point_name
+	`, bucket, where, rollup, where)
+
+	rows, err := database.DB.Queryx(query, append(args, args...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b pointBucket
+		if err := rows.StructScan(&b); err != nil {
+			return err
+		}
+		if err := fn(b.PointName, b.IotTimeSeries); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (sqlTelemetryRepository) Points(sessionID string) ([]IotDataPoint, error) {
+	query := `
+		SELECT id, session_id, point_name, COALESCE(point_value, 0) AS point_value,
+			COALESCE(unit, '') AS unit, timestamp, COALESCE(raw_data, '') AS raw_data, created_at
+		FROM iot_data_points
+		WHERE session_id = ?
+		ORDER BY ` + timeExpr("timestamp") + `, id
+	`
+
+	points := []IotDataPoint{}
+	if err := database.DB.Select(&points, query, sessionID); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (r sqlTelemetryRepository) EachSample(sessionID, pointName string, fn func(IotSample) error) error {
+	nextRaw := r.rawSamplePages(sessionID, pointName)
+	nextRollup := r.rollupSamplePages(sessionID, pointName)
+
+	// Both sources are read in time order and merged; rollups only cover
+	// expired stretches, which precede the raw points of the same point
+	var raw, rollups []IotSample
+	for {
+		var err error
+		if len(raw) == 0 {
+			if raw, err = nextRaw(); err != nil {
+				return err
+			}
+		}
+		if len(rollups) == 0 {
+			if rollups, err = nextRollup(); err != nil {
+				return err
+			}
+		}
+
+		var sample IotSample
+		switch {
+		case len(raw) == 0 && len(rollups) == 0:
+			return nil
+		case len(raw) == 0 || (len(rollups) > 0 && !raw[0].Timestamp.Before(rollups[0].Timestamp)):
+			sample, rollups = rollups[0], rollups[1:]
+		default:
+			sample, raw = raw[0], raw[1:]
+		}
+		if err := fn(sample); err != nil {
+			return err
+		}
+	}
+}
+
+// rawSample is a raw point along with its id, which breaks timestamp ties
+// in the page cursor
+type rawSample struct {
+	ID int `db:"id"`
+	IotSample
+}
+
+// rawSamplePages returns a function reading the next page of a session's
+// raw points in (timestamp, id) order; it returns an empty page at the end
+func (sqlTelemetryRepository) rawSamplePages(sessionID, pointName string) func() ([]IotSample, error) {
+	var last *rawSample
+	done := false
+
+	return func() ([]IotSample, error) {
+		if done {
+			return nil, nil
+		}
+
+		query := `
+			SELECT id, point_name, point_value, COALESCE(unit, '') AS unit, timestamp,
+				COALESCE(raw_data, '') AS raw_data
+			FROM iot_data_points
+			WHERE session_id = ?`
+		args := []interface{}{sessionID}
+		if pointName != "" {
+			query += " AND point_name = ?"
+			args = append(args, pointName)
+		}
+		if last != nil {
+			query += " AND (" + timeExpr("timestamp") + " > " + timeExpr("?") +
+				" OR (" + timeExpr("timestamp") + " = " + timeExpr("?") + " AND id > ?))"
+			args = append(args, timeArg(last.Timestamp), timeArg(last.Timestamp), last.ID)
+		}
+		query += " ORDER BY " + timeExpr("timestamp") + ", id LIMIT ?"
+		args = append(args, samplePageSize)
+
+		rows := []rawSample{}
+		if err := database.DB.Select(&rows, query, args...); err != nil {
+			return nil, err
+		}
+		done = len(rows) < samplePageSize
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		last = &rows[len(rows)-1]
+
+		samples := make([]IotSample, len(rows))
+		for i, row := range rows {
+			samples[i] = row.IotSample
+		}
+		return samples, nil
+	}
+}
+
+// rollupSample is a minute or hour rollup of expired points
+type rollupSample struct {
+	Resolution  string  `db:"resolution"`
+	PointName   string  `db:"point_name"`
+	BucketStart string  `db:"bucket_start"`
+	Unit        string  `db:"unit"`
+	AvgValue    float64 `db:"avg_value"`
+}
+
+// rollupSamplePages returns a function reading the next page of a session's
+// rollups in (bucket_start, point_name, resolution) order; it returns an
+// empty page at the end
+func (sqlTelemetryRepository) rollupSamplePages(sessionID, pointName string) func() ([]IotSample, error) {
+	var last *rollupSample
+	done := false
+
+	return func() ([]IotSample, error) {
+		if done {
+			return nil, nil
+		}
+
+		query := `
+			SELECT resolution, point_name, bucket_start, COALESCE(unit, '') AS unit,
+				value_sum / sample_count AS avg_value
+			FROM iot_data_rollups
+			WHERE session_id = ?`
+		args := []interface{}{sessionID}
+		if pointName != "" {
+			query += " AND point_name = ?"
+			args = append(args, pointName)
+		}
+		if last != nil {
+			query += ` AND (bucket_start > ? OR (bucket_start = ? AND
+				(point_name > ? OR (point_name = ? AND resolution > ?))))`
+			args = append(args, last.BucketStart, last.BucketStart, last.PointName, last.PointName, last.Resolution)
+		}
+		query += " ORDER BY bucket_start, point_name, resolution LIMIT ?"
+		args = append(args, samplePageSize)
+
+		rows := []rollupSample{}
+		if err := database.DB.Select(&rows, query, args...); err != nil {
+			return nil, err
+		}
+		done = len(rows) < samplePageSize
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		last = &rows[len(rows)-1]
+
+		samples := make([]IotSample, 0, len(rows))
+		for _, row := range rows {
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", row.BucketStart, time.UTC)
+			if err != nil {
+				return nil, fmt.Errorf("rollup bucket %q: %w", row.BucketStart, err)
+			}
+			value := row.AvgValue
+			samples = append(samples, IotSample{
+				PointName: row.PointName,
+				Timestamp: t,
+				Value:     &value,
+				Unit:      row.Unit,
+			})
+		}
+		return samples, nil
+	}
+}
@@ -0,0 +1,277 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MergeSessions combines adjacent sessions of one device into the earliest
+// of them. The merged session spans from the first start to the last end,
+// later sessions' metadata overrides earlier keys, and IoT data, annotations
+// and tags of the absorbed sessions move to the merged one.
+func MergeSessions(tenantID string, sessionIDs []string, actor, reason string) (*DeviceSession, error) {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, id := range sessionIDs {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("%w: at least two sessions are required to merge", ErrInvalidSession)
+	}
+
+	var merged *DeviceSession
+	err := database.WithTx(func(tx *database.Tx) error {
+		sessions := make([]*DeviceSession, 0, len(ids))
+		for _, id := range ids {
+			session, err := getSessionTx(tx, tenantID, id)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, session)
+		}
+
+		result, err := mergeSessionsTx(tx, sessions, actor, reason)
+		merged = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// mergeSessionsTx merges loaded sessions within a transaction
+func mergeSessionsTx(tx *database.Tx, sessions []*DeviceSession, actor, reason string) (*DeviceSession, error) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].StartTime.Equal(sessions[j].StartTime) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].StartTime.Before(sessions[j].StartTime)
+	})
+
+	first, last := sessions[0], sessions[len(sessions)-1]
+	ids := []interface{}{}
+	for i, s := range sessions {
+		if s.DeviceID != first.DeviceID {
+			return nil, fmt.Errorf("%w: sessions belong to different devices", ErrInvalidSession)
+		}
+		// Only the last session may still be running
+		if s.EndTime == nil && i < len(sessions)-1 {
+			return nil, fmt.Errorf("%w: session %s is still running", ErrInvalidSession, s.SessionID)
+		}
+		ids = append(ids, s.SessionID)
+	}
+
+	// Adjacent means no other session of the device starts in between
+	var between int
+	query := `
+		SELECT COUNT(*) FROM device_sessions
+		WHERE tenant_id = ? AND device_id = ? AND deleted_at IS NULL
+			AND ` + timeExpr("start_time") + ` > ` + timeExpr("?") + ` AND ` + timeExpr("start_time") + ` < ` + timeExpr("?") + `
+			AND session_id NOT IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + `)
+	`
+	args := append([]interface{}{first.TenantID, first.DeviceID, timeArg(first.StartTime), timeArg(last.StartTime)}, ids...)
+	if err := tx.Get(&between, query, args...); err != nil {
+		return nil, err
+	}
+	if between > 0 {
+		return nil, fmt.Errorf("%w: sessions are not adjacent", ErrInvalidSession)
+	}
+
+	merged := *first
+	merged.EndTime = last.EndTime
+	metadata := map[string]interface{}{}
+	for _, s := range sessions {
+		for k, v := range s.MetadataObj {
+			metadata[k] = v
+		}
+	}
+	merged.MetadataObj = metadata
+	if err := merged.normalize(); err != nil {
+		return nil, err
+	}
+	if err := updateSessionTx(tx, &merged); err != nil {
+		return nil, err
+	}
+
+	for _, s := range sessions[1:] {
+		for _, query := range []string{
+			`UPDATE iot_data_points SET session_id = ? WHERE session_id = ?`,
+			// Both sessions may have a rollup for the same bucket
+			`INSERT INTO iot_data_rollups (resolution, session_id, point_name, bucket_start, unit, sample_count, value_sum, min_value, max_value)
+				SELECT resolution, ?, point_name, bucket_start, unit, sample_count, value_sum, min_value, max_value
+				FROM iot_data_rollups WHERE session_id = ?` + rollupUpsert,
+			`UPDATE session_annotations SET session_id = ? WHERE session_id = ?`,
+			tx.Dialect.InsertIgnore(`INSERT INTO session_tags (session_id, tag_id, author, created_at)
+				SELECT ?, tag_id, author, created_at FROM session_tags WHERE session_id = ?`),
+		} {
+			if _, err := tx.Exec(query, merged.SessionID, s.SessionID); err != nil {
+				return nil, err
+			}
+		}
+		for _, query := range []string{
+			`DELETE FROM iot_data_rollups WHERE session_id = ?`,
+			`DELETE FROM session_tags WHERE session_id = ?`,
+			`DELETE FROM device_sessions WHERE session_id = ?`,
+		} {
+			if _, err := tx.Exec(query, s.SessionID); err != nil {
+				return nil, err
+			}
+		}
+		if err := recordAudit(tx, AuditMerge, s.SessionID, actor, reason, s, &merged); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recordAudit(tx, AuditMerge, merged.SessionID, actor, reason, first, &merged); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// AutoMergeSession merges an ended session into the device's previous
+// session when the gap between them is shorter than maxGap, as happens when
+// a power blip splits one job. It returns nil when nothing was merged.
+func AutoMergeSession(tenantID, sessionID string, maxGap time.Duration) (*DeviceSession, error) {
+	if maxGap <= 0 {
+		return nil, nil
+	}
+
+	var merged *DeviceSession
+	err := database.WithTx(func(tx *database.Tx) error {
+		session, err := getSessionTx(tx, tenantID, sessionID)
+		if err != nil {
+			return err
+		}
+
+		previous := []*DeviceSession{}
+		query := `
+			SELECT * FROM device_sessions
+			WHERE tenant_id = ? AND device_id = ? AND session_id != ? AND deleted_at IS NULL AND end_time IS NOT NULL
+				AND ` + timeExpr("start_time") + ` <= ` + timeExpr("?") + `
+			ORDER BY ` + timeExpr("start_time") + ` DESC, id DESC
+			LIMIT 1
+		`
+		if err := tx.Select(&previous, query, tenantID, session.DeviceID, sessionID, timeArg(session.StartTime)); err != nil {
+			return err
+		}
+		if len(previous) == 0 {
+			return nil
+		}
+		prev := previous[0]
+		if err := prev.AfterFind(); err != nil {
+			return err
+		}
+
+		gap := session.StartTime.Sub(*prev.EndTime)
+		if gap < 0 || gap >= maxGap {
+			return nil
+		}
+
+		reason := fmt.Sprintf("automatic merge: gap of %ds is shorter than %ds",
+			int64(gap.Seconds()), int64(maxGap.Seconds()))
+		merged, err = mergeSessionsTx(tx, []*DeviceSession{prev, session}, "system", reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// SplitSession splits a session at the given time into two consecutive
+// sessions. The first keeps the session ID; the second gets a new ID and
+// takes the IoT data and timeline markers from the split time onwards. Both
+// keep the metadata, notes stay with the first and tags are copied.
+func SplitSession(tenantID, sessionID string, at time.Time, actor, reason string) (*DeviceSession, *DeviceSession, error) {
+	var first, second *DeviceSession
+
+	err := database.WithTx(func(tx *database.Tx) error {
+		original, err := getSessionTx(tx, tenantID, sessionID)
+		if err != nil {
+			return err
+		}
+
+		end := time.Now()
+		if original.EndTime != nil {
+			end = *original.EndTime
+		}
+		if !at.After(original.StartTime) || !at.Before(end) {
+			return fmt.Errorf("%w: split time must fall inside the session", ErrInvalidSession)
+		}
+
+		head := *original
+		head.EndTime = &at
+		if err := head.normalize(); err != nil {
+			return err
+		}
+
+		tail := *original
+		tail.SessionID = uuid.New().String()
+		tail.StartTime = at
+		tail.MetadataObj = map[string]interface{}{}
+		for k, v := range original.MetadataObj {
+			tail.MetadataObj[k] = v
+		}
+		if err := tail.normalize(); err != nil {
+			return err
+		}
+
+		if err := updateSessionTx(tx, &head); err != nil {
+			return err
+		}
+		if err := insertSessionTx(tx, &tail); err != nil {
+			return err
+		}
+
+		moves := []struct {
+			query string
+			args  []interface{}
+		}{
+			{`UPDATE iot_data_points SET session_id = ?
+				WHERE session_id = ? AND ` + timeExpr("timestamp") + ` >= ` + timeExpr("?"),
+				[]interface{}{tail.SessionID, sessionID, timeArg(at)}},
+			// The rollup bucket containing the split time stays with the head
+			{`UPDATE iot_data_rollups SET session_id = ?
+				WHERE session_id = ? AND bucket_start >= ?`,
+				[]interface{}{tail.SessionID, sessionID, bucketArg(at)}},
+			{`UPDATE session_annotations SET session_id = ?
+				WHERE session_id = ? AND marker_time IS NOT NULL AND ` + timeExpr("marker_time") + ` >= ` + timeExpr("?"),
+				[]interface{}{tail.SessionID, sessionID, timeArg(at)}},
+			{`INSERT INTO session_tags (session_id, tag_id, author, created_at)
+				SELECT ?, tag_id, author, created_at FROM session_tags WHERE session_id = ?`,
+				[]interface{}{tail.SessionID, sessionID}},
+		}
+		for _, m := range moves {
+			if _, err := tx.Exec(m.query, m.args...); err != nil {
+				return err
+			}
+		}
+
+		if err := recordAudit(tx, AuditSplit, sessionID, actor, reason, original, &head); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditSplit, tail.SessionID, actor, reason, original, &tail); err != nil {
+			return err
+		}
+
+		first, second = &head, &tail
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return first, second, nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cursor directions
+const (
+	cursorNext = "next"
+	cursorPrev = "prev"
+)
+
+// SessionPage is one page of a keyset paginated session list
+type SessionPage struct {
+	Sessions   []*DeviceSession
+	Total      *int   // nil when counting was skipped
+	NextCursor string // empty on the last page
+	PrevCursor string // empty on the first page
+}
+
+// sessionCursor is the decoded form of an opaque page cursor. Time is the
+// instant of the page's key column, compared through timeExpr so that rows
+// stored in any of the database's timestamp formats order chronologically.
+type sessionCursor struct {
+	Time      time.Time `json:"t"`
+	ID        int       `json:"i"`
+	Direction string    `json:"d"`
+}
+
+// pageKey returns the time a session is ordered by in a page sorted by sort
+func pageKey(session *DeviceSession, sort string) time.Time {
+	if sort == SortDeletedAt && session.DeletedAt != nil {
+		return *session.DeletedAt
+	}
+	return session.StartTime
+}
+
+func encodeCursor(session *DeviceSession, sort, direction string) string {
+	data, _ := json.Marshal(sessionCursor{Time: pageKey(session, sort).UTC(), ID: session.ID, Direction: direction})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*sessionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor", ErrInvalidFilter)
+	}
+	cursor := &sessionCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.Time.IsZero() ||
+		(cursor.Direction != cursorNext && cursor.Direction != cursorPrev) {
+		return nil, fmt.Errorf("%w: cursor", ErrInvalidFilter)
+	}
+	return cursor, nil
+}
+
+// GetSessionPage retrieves a page of sessions ordered by (start_time, id),
+// or by (deleted_at, id) in the trash, continuing from the given cursor; an
+// empty cursor returns the first page. Unlike GetSessions it does not use
+// OFFSET, so deep pages stay cheap.
+func GetSessionPage(filter SessionFilter, token string) (*SessionPage, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = SortStartTime
+	}
+	if sort != SortStartTime && (sort != SortDeletedAt || !filter.Deleted) {
+		return nil, fmt.Errorf("%w: cursor pagination only supports sort=%s, or sort=%s in the trash",
+			ErrInvalidFilter, SortStartTime, SortDeletedAt)
+	}
+
+	descending := true
+	switch strings.ToLower(filter.Order) {
+	case "", "desc":
+	case "asc":
+		descending = false
+	default:
+		return nil, fmt.Errorf("%w: order %q, expected asc or desc", ErrInvalidFilter, filter.Order)
+	}
+
+	var cursor *sessionCursor
+	if token != "" {
+		c, err := decodeCursor(token)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	where, args, err := sessionConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SessionPage{}
+	if !filter.SkipCount {
+		var total int
+		if err := database.DB.Get(&total, `SELECT COUNT(*) FROM device_sessions WHERE 1=1`+where, args...); err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	// Walking backwards reads the rows before the cursor in reverse order
+	backwards := cursor != nil && cursor.Direction == cursorPrev
+	scanDescending := descending != backwards
+
+	key := timeExpr(sortColumns[sort])
+	query := `SELECT * FROM device_sessions WHERE 1=1` + where
+	if cursor != nil {
+		op := ">"
+		if scanDescending {
+			op = "<"
+		}
+		query += fmt.Sprintf(" AND (%s %s %s OR (%s = %s AND id %s ?))", key, op, timeExpr("?"), key, timeExpr("?"), op)
+		args = append(args, timeArg(cursor.Time), timeArg(cursor.Time), cursor.ID)
+	}
+	direction := "ASC"
+	if scanDescending {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", key, direction, direction)
+	args = append(args, limit+1)
+
+	rows := []*DeviceSession{}
+	if err := database.DB.Select(&rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	// The extra row only tells whether another page exists
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+	if backwards {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	for _, session := range rows {
+		if err := session.AfterFind(); err != nil {
+			return nil, err
+		}
+	}
+	page.Sessions = rows
+
+	if len(rows) > 0 {
+		first, last := rows[0], rows[len(rows)-1]
+		if backwards {
+			page.NextCursor = encodeCursor(last, sort, cursorNext)
+			if hasMore {
+				page.PrevCursor = encodeCursor(first, sort, cursorPrev)
+			}
+		} else {
+			if hasMore {
+				page.NextCursor = encodeCursor(last, sort, cursorNext)
+			}
+			if cursor != nil {
+				page.PrevCursor = encodeCursor(first, sort, cursorPrev)
+			}
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Report periods
+const (
+	ReportPeriodDaily  = "daily"
+	ReportPeriodWeekly = "weekly"
+)
+
+// DeviceSummary holds aggregated runtime figures for one device (or the fleet)
+type DeviceSummary struct {
+	DeviceID          string  `db:"device_id" json:"device_id"`
+	SessionCount      int     `db:"session_count" json:"session_count"`
+	CompletedSessions int     `db:"completed_sessions" json:"completed_sessions"`
+	RuntimeSeconds    int64   `db:"runtime_seconds" json:"runtime_seconds"`
+	RuntimeHours      float64 `db:"-" json:"runtime_hours"`
+	AvgDuration       float64 `db:"avg_duration" json:"avg_duration"`
+	ShortSessions     int     `db:"short_sessions" json:"short_sessions"`
+	StaleSessions     int     `db:"stale_sessions" json:"stale_sessions"`
+	Anomalies         int     `db:"-" json:"anomalies"`
+}
+
+// SummaryReport is the content of a periodic report snapshot
+type SummaryReport struct {
+	TenantID    string           `json:"tenant_id"`
+	Period      string           `json:"period"`
+	PeriodStart time.Time        `json:"period_start"`
+	PeriodEnd   time.Time        `json:"period_end"`
+	Fleet       DeviceSummary    `json:"fleet"`
+	Devices     []*DeviceSummary `json:"devices"`
+}
+
+// ReportSnapshot is a stored summary report
+type ReportSnapshot struct {
+	ID          int            `db:"id" json:"id"`
+	TenantID    string         `db:"tenant_id" json:"tenant_id"`
+	Period      string         `db:"period" json:"period"`
+	PeriodStart time.Time      `db:"period_start" json:"period_start"`
+	PeriodEnd   time.Time      `db:"period_end" json:"period_end"`
+	Content     string         `db:"content" json:"-"`
+	Report      *SummaryReport `db:"-" json:"report,omitempty"`
+	DeliveredAt *time.Time     `db:"delivered_at" json:"delivered_at"`
+	CreatedAt   time.Time      `db:"created_at" json:"created_at"`
+}
+
+// AfterFind decodes the stored report content
+func (r *ReportSnapshot) AfterFind() error {
+	if r.Content == "" {
+		return nil
+	}
+	r.Report = &SummaryReport{}
+	return json.Unmarshal([]byte(r.Content), r.Report)
+}
+
+// BuildSummaryReport aggregates a tenant's sessions that started within
+// [start, end). Runtime is what the devices ran within the window, so it
+// includes sessions started earlier and stops at the window's end.
+func BuildSummaryReport(tenantID, period string, start, end time.Time) (*SummaryReport, error) {
+	query := fmt.Sprintf(`
+		SELECT device_id,
+			COUNT(*) AS session_count,
+			SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END) AS completed_sessions,
+			COALESCE(AVG(CASE WHEN status = 'completed' THEN duration END), 0) AS avg_duration,
+			SUM(CASE WHEN status = 'completed' AND duration < ? THEN 1 ELSE 0 END) AS short_sessions,
+			SUM(CASE WHEN status = 'running' AND %[1]s < %[2]s THEN 1 ELSE 0 END) AS stale_sessions
+		FROM device_sessions
+		WHERE tenant_id = ? AND %[1]s >= %[2]s AND %[1]s < %[2]s
+			AND deleted_at IS NULL
+		GROUP BY device_id
+		ORDER BY device_id
+	`, timeExpr("start_time"), timeExpr("?"))
+
+	cfg := config.Current()
+	staleBefore := time.Now().Add(-time.Duration(cfg.StaleSessionHours) * time.Hour)
+	devices := []*DeviceSummary{}
+	err := database.DB.Select(&devices, query, cfg.ShortSessionSeconds,
+		timeArg(staleBefore), tenantID, timeArg(start), timeArg(end))
+	if err != nil {
+		return nil, err
+	}
+	if devices, err = addReportRuntime(devices, tenantID, start, end); err != nil {
+		return nil, err
+	}
+
+	report := &SummaryReport{
+		TenantID:    tenantID,
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Fleet:       DeviceSummary{DeviceID: "*"},
+		Devices:     devices,
+	}
+
+	var completedDuration float64
+	for _, d := range devices {
+		d.RuntimeHours = float64(d.RuntimeSeconds) / 3600
+		d.Anomalies = d.ShortSessions + d.StaleSessions
+
+		report.Fleet.SessionCount += d.SessionCount
+		report.Fleet.CompletedSessions += d.CompletedSessions
+		report.Fleet.RuntimeSeconds += d.RuntimeSeconds
+		report.Fleet.ShortSessions += d.ShortSessions
+		report.Fleet.StaleSessions += d.StaleSessions
+		completedDuration += d.AvgDuration * float64(d.CompletedSessions)
+	}
+	report.Fleet.RuntimeHours = float64(report.Fleet.RuntimeSeconds) / 3600
+	report.Fleet.Anomalies = report.Fleet.ShortSessions + report.Fleet.StaleSessions
+	if report.Fleet.CompletedSessions > 0 {
+		report.Fleet.AvgDuration = completedDuration / float64(report.Fleet.CompletedSessions)
+	}
+
+	return report, nil
+}
+
+// addReportRuntime sets each device's runtime within [start, end), adding
+// devices that only ran sessions started before the window
+func addReportRuntime(devices []*DeviceSummary, tenantID string, start, end time.Time) ([]*DeviceSummary, error) {
+	now := time.Now()
+	runtime := map[string]*runtimeAccumulator{}
+	err := Sessions.EachOverlapping(tenantID, "", start, end, func(s *DeviceSession) error {
+		acc, ok := runtime[s.DeviceID]
+		if !ok {
+			acc = newRuntimeAccumulator(start, end, now, start.Location(), BucketDay)
+			runtime[s.DeviceID] = acc
+		}
+		acc.add(s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*DeviceSummary{}
+	for _, d := range devices {
+		byID[d.DeviceID] = d
+	}
+	for deviceID, acc := range runtime {
+		d, ok := byID[deviceID]
+		if !ok {
+			d = &DeviceSummary{DeviceID: deviceID}
+			devices = append(devices, d)
+		}
+		for _, b := range acc.result() {
+			d.RuntimeSeconds += b.Runtime
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].DeviceID < devices[j].DeviceID
+	})
+	return devices, nil
+}
+
+// SaveReportSnapshot stores a summary report
+func SaveReportSnapshot(report *SummaryReport) (*ReportSnapshot, error) {
+	content, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO report_snapshots (tenant_id, period, period_start, period_end, content)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	id, err := database.DB.Insert(query, report.TenantID, report.Period, report.PeriodStart.UTC(), report.PeriodEnd.UTC(), string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReportSnapshot{
+		ID:          int(id),
+		TenantID:    report.TenantID,
+		Period:      report.Period,
+		PeriodStart: report.PeriodStart,
+		PeriodEnd:   report.PeriodEnd,
+		Content:     string(content),
+		Report:      report,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// GetReportSnapshotByID retrieves a tenant's stored report
+func GetReportSnapshotByID(tenantID string, id int) (*ReportSnapshot, error) {
+	snapshot := &ReportSnapshot{}
+	err := database.DB.Get(snapshot, `SELECT * FROM report_snapshots WHERE id = ? AND tenant_id = ?`, id, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := snapshot.AfterFind(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// GetReportSnapshots lists a tenant's stored reports, newest first, without
+// their content
+func GetReportSnapshots(tenantID, period string, limit, offset int) ([]*ReportSnapshot, int, error) {
+	query := `SELECT id, tenant_id, period, period_start, period_end, '' AS content, delivered_at, created_at FROM report_snapshots WHERE tenant_id = ?`
+	countQuery := `SELECT COUNT(*) FROM report_snapshots WHERE tenant_id = ?`
+	args := []interface{}{tenantID}
+
+	if period != "" {
+		query += " AND period = ?"
+		countQuery += " AND period = ?"
+		args = append(args, period)
+	}
+
+	var total int
+	if err := database.DB.Get(&total, countQuery, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query += " ORDER BY period_start DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	if offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	snapshots := []*ReportSnapshot{}
+	if err := database.DB.Select(&snapshots, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	return snapshots, total, nil
+}
+
+// MarkReportDelivered records when a report was sent to the outbound channel
+func MarkReportDelivered(id int, deliveredAt time.Time) error {
+	_, err := database.DB.Exec(`UPDATE report_snapshots SET delivered_at = ? WHERE id = ?`, deliveredAt.UTC(), id)
+	return err
+}
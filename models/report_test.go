@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummaryReportClipsRuntimeToWindow(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tenantID := testTenant()
+		start, end := testBase, testBase.Add(24*time.Hour)
+		addSession(t, tenantID, "early", start.Add(-2*time.Hour), 3*time.Hour) // 1h within the window
+		addSession(t, tenantID, "late", end.Add(-time.Hour), 3*time.Hour)      // 1h within the window
+		addSession(t, tenantID, "late", start.Add(time.Hour), 30*time.Minute)
+
+		report, err := BuildSummaryReport(tenantID, ReportPeriodDaily, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Devices) != 2 {
+			t.Fatalf("report devices = %+v, want early and late", report.Devices)
+		}
+		early, late := report.Devices[0], report.Devices[1]
+		if early.DeviceID != "early" || early.SessionCount != 0 || early.RuntimeSeconds != 3600 {
+			t.Fatalf("early device = %+v, want no sessions and 3600s runtime", early)
+		}
+		if late.DeviceID != "late" || late.SessionCount != 2 || late.RuntimeSeconds != 5400 {
+			t.Fatalf("late device = %+v, want 2 sessions and 5400s runtime", late)
+		}
+		if report.Fleet.RuntimeSeconds != 9000 || report.Fleet.RuntimeHours != 2.5 {
+			t.Fatalf("fleet runtime = %ds (%vh), want 9000s", report.Fleet.RuntimeSeconds, report.Fleet.RuntimeHours)
+		}
+	})
+}
+
+func TestMarkReportDelivered(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tenantID := testTenant()
+		report, err := BuildSummaryReport(tenantID, ReportPeriodDaily, testBase, testBase.Add(24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshot, err := SaveReportSnapshot(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		delivered := testBase.Add(25 * time.Hour).In(time.FixedZone("UTC+2", 2*3600))
+		if err := MarkReportDelivered(snapshot.ID, delivered); err != nil {
+			t.Fatal(err)
+		}
+		got, err := GetReportSnapshotByID(tenantID, snapshot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DeliveredAt == nil || !got.DeliveredAt.Equal(delivered) {
+			t.Fatalf("delivered_at = %v, want %v", got.DeliveredAt, delivered)
+		}
+		if _, offset := got.DeliveredAt.Zone(); offset != 0 {
+			t.Fatalf("delivered_at = %v, want %v in UTC", got.DeliveredAt, delivered.UTC())
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"time"
+)
+
+// SessionRepository stores device sessions. Sessions in the trash are only
+// returned by List with SessionFilter.Deleted.
+type SessionRepository interface {
+	// Create inserts a new running session and sets its ID
+	Create(session *DeviceSession) error
+	// End saves a session's end time, duration, status and metadata
+	End(session *DeviceSession) error
+	// Get loads one of a tenant's sessions; sql.ErrNoRows means it does
+	// not exist or belongs to another tenant
+	Get(tenantID, sessionID string) (*DeviceSession, error)
+	// Running lists a tenant's device's running sessions, newest first
+	Running(tenantID, deviceID string) ([]*DeviceSession, error)
+	// List returns one page of sessions matching the filter and their total
+	List(filter SessionFilter) ([]*DeviceSession, int, error)
+	// Each calls fn with every session matching the filter in list order,
+	// reading one row at a time; Limit, Offset and SkipCount are ignored
+	Each(filter SessionFilter, fn func(*DeviceSession) error) error
+	// Overlapping lists a tenant's sessions running at any time within
+	// [start, end); zero bounds leave that side open and an empty deviceID
+	// means all of the tenant's devices
+	Overlapping(tenantID, deviceID string, start, end time.Time) ([]*DeviceSession, error)
+	// EachOverlapping calls fn with the device, start and end time of every session
+	// Overlapping would return, reading one row at a time
+	EachOverlapping(tenantID, deviceID string, start, end time.Time, fn func(*DeviceSession) error) error
+}
+
+// DeviceRepository answers per-device questions across sessions. Devices
+// are identified by their device ID within a tenant.
+type DeviceRepository interface {
+	// LastEnded returns the most recently ended session of every device of a tenant
+	LastEnded(tenantID string) (map[string]*DeviceSession, error)
+}
+
+// TelemetryRepository reads the IoT data points recorded during sessions
+type TelemetryRepository interface {
+	// PointSummaries returns statistics for each point name in a session
+	PointSummaries(sessionID string) ([]IotPointSummary, error)
+	// Buckets aggregates one point of a session per minute, hour or day
+	Buckets(sessionID, pointName, interval string) ([]IotTimeSeries, error)
+	// EachBucket calls fn with the buckets Buckets would return, reading one
+	// row at a time; an empty pointName covers every point, ordered by
+	// bucket and then point name
+	EachBucket(sessionID, pointName, interval string, fn func(pointName string, bucket IotTimeSeries) error) error
+	// EachSample calls fn with a session's stored samples of one point, or
+	// of every point when pointName is empty, in time order. Raw points are
+	// read a page at a time; where they have expired, rollups stand in.
+	EachSample(sessionID, pointName string, fn func(IotSample) error) error
+	// Points returns a session's raw data points in time order; points
+	// past their raw retention are only available through the aggregates
+	Points(sessionID string) ([]IotDataPoint, error)
+}
+
+// The repositories used by the package functions. The SQL implementations
+// work on the connection opened by database.Open, whose dialect (SQLite or
+// PostgreSQL/TimescaleDB, chosen by DATABASE_DRIVER) supplies the SQL that
+// differs between databases.
+var (
+	Sessions  SessionRepository   = sqlSessionRepository{}
+	Devices   DeviceRepository    = sqlDeviceRepository{}
+	Telemetry TelemetryRepository = sqlTelemetryRepository{}
+)
+
+type sqlSessionRepository struct{}
+
+func (sqlSessionRepository) Create(session *DeviceSession) error {
+	query := `
+		INSERT INTO device_sessions (tenant_id, device_id, session_id, start_time, status, metadata)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	// Store instants in UTC so stored values sort and compare consistently
+	id, err := database.DB.Insert(query, session.TenantID, session.DeviceID, session.SessionID,
+		session.StartTime.UTC(), session.Status, session.Metadata)
+	if err != nil {
+		return err
+	}
+
+	session.ID = int(id)
+	return nil
+}
+
+func (sqlSessionRepository) End(session *DeviceSession) error {
+	query := `
+		UPDATE device_sessions
+		SET end_time = ?, duration = ?, status = ?, metadata = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE session_id = ?
+	`
+
+	_, err := database.DB.Exec(query, utcTime(session.EndTime), session.Duration,
+		session.Status, session.Metadata, session.SessionID)
+	return err
+}
+
+func (sqlSessionRepository) Get(tenantID, sessionID string) (*DeviceSession, error) {
+	session := &DeviceSession{}
+	query := `SELECT * FROM device_sessions WHERE session_id = ? AND tenant_id = ? AND deleted_at IS NULL`
+
+	if err := database.DB.Get(session, query, sessionID, tenantID); err != nil {
+		return nil, err
+	}
+	if err := session.AfterFind(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (sqlSessionRepository) Running(tenantID, deviceID string) ([]*DeviceSession, error) {
+	sessions := []*DeviceSession{}
+	query := `SELECT * FROM device_sessions WHERE tenant_id = ? AND device_id = ? AND status = 'running' AND deleted_at IS NULL ORDER BY ` +
+		timeExpr("start_time") + ` DESC`
+
+	if err := database.DB.Select(&sessions, query, tenantID, deviceID); err != nil {
+		return nil, err
+	}
+	return afterFindAll(sessions)
+}
+
+func (sqlSessionRepository) List(filter SessionFilter) ([]*DeviceSession, int, error) {
+	where, args, err := sessionConditions(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order, err := sessionOrder(filter.Sort, filter.Order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Get total count
+	var total int
+	if !filter.SkipCount {
+		err = database.DB.Get(&total, `SELECT COUNT(*) FROM device_sessions WHERE 1=1`+where, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// Add ordering and pagination
+	query := `SELECT * FROM device_sessions WHERE 1=1` + where + order
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	if filter.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, filter.Offset)
+	}
+
+	sessions := []*DeviceSession{}
+	if err := database.DB.Select(&sessions, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	sessions, err = afterFindAll(sessions)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sessions, total, nil
+}
+
+func (sqlSessionRepository) Each(filter SessionFilter, fn func(*DeviceSession) error) error {
+	where, args, err := sessionConditions(filter)
+	if err != nil {
+		return err
+	}
+
+	order, err := sessionOrder(filter.Sort, filter.Order)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.DB.Queryx(`SELECT * FROM device_sessions WHERE 1=1`+where+order, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session := &DeviceSession{}
+		if err := rows.StructScan(session); err != nil {
+			return err
+		}
+		if err := session.AfterFind(); err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (sqlSessionRepository) Overlapping(tenantID, deviceID string, start, end time.Time) ([]*DeviceSession, error) {
+	where, args := overlapWhere(tenantID, deviceID, start, end)
+	query := `SELECT * FROM device_sessions` + where + " ORDER BY device_id, " + timeExpr("start_time")
+
+	sessions := []*DeviceSession{}
+	if err := database.DB.Select(&sessions, query, args...); err != nil {
+		return nil, err
+	}
+	return afterFindAll(sessions)
+}
+
+func (sqlSessionRepository) EachOverlapping(tenantID, deviceID string, start, end time.Time, fn func(*DeviceSession) error) error {
+	where, args := overlapWhere(tenantID, deviceID, start, end)
+	rows, err := database.DB.Queryx(`SELECT device_id, start_time, end_time FROM device_sessions`+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s DeviceSession
+		if err := rows.StructScan(&s); err != nil {
+			return err
+		}
+		if err := fn(&s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// overlapWhere builds the WHERE clause selecting the sessions running at
+// any time within [start, end)
+func overlapWhere(tenantID, deviceID string, start, end time.Time) (string, []interface{}) {
+	query := ` WHERE tenant_id = ? AND deleted_at IS NULL`
+	args := []interface{}{tenantID}
+
+	if !end.IsZero() {
+		query += " AND " + timeExpr("start_time") + " < " + timeExpr("?")
+		args = append(args, timeArg(end))
+	}
+	if !start.IsZero() {
+		query += " AND (end_time IS NULL OR " + timeExpr("end_time") + " > " + timeExpr("?") + ")"
+		args = append(args, timeArg(start))
+	}
+	if deviceID != "" {
+		query += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+	return query, args
+}
+
+type sqlDeviceRepository struct{}
+
+func (sqlDeviceRepository) LastEnded(tenantID string) (map[string]*DeviceSession, error) {
+	query := `
+		SELECT s.* FROM device_sessions s
+		JOIN (
+			SELECT device_id, MAX(` + timeExpr("end_time") + `) AS last_end
+			FROM device_sessions
+			WHERE tenant_id = ? AND end_time IS NOT NULL AND deleted_at IS NULL
+			GROUP BY device_id
+		) l ON s.device_id = l.device_id AND ` + timeExpr("s.end_time") + ` = l.last_end
+		WHERE s.tenant_id = ? AND s.deleted_at IS NULL
+	`
+
+	sessions := []*DeviceSession{}
+	if err := database.DB.Select(&sessions, query, tenantID, tenantID); err != nil {
+		return nil, err
+	}
+
+	result := map[string]*DeviceSession{}
+	for _, s := range sessions {
+		if err := s.AfterFind(); err != nil {
+			return nil, err
+		}
+		// Several sessions may end at the same instant; keep the latest row
+		if prev, ok := result[s.DeviceID]; !ok || s.ID > prev.ID {
+			result[s.DeviceID] = s
+		}
+	}
+	return result, nil
+}
+
+// afterFindAll runs AfterFind on loaded sessions
+func afterFindAll(sessions []*DeviceSession) ([]*DeviceSession, error) {
+	for _, s := range sessions {
+		if err := s.AfterFind(); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
@@ -0,0 +1,522 @@
+package models
+
+import (
+	"database/sql"
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBackend is a database the model tests run against
+type testBackend struct {
+	name string
+	env  map[string]string
+}
+
+// testBackends returns SQLite in a temporary file and, when DATABASE_URL is
+// set, the PostgreSQL database it points at
+func testBackends(t *testing.T) []testBackend {
+	backends := []testBackend{{
+		name: "sqlite",
+		env: map[string]string{
+			"DATABASE_DRIVER": "sqlite",
+			"DATABASE_PATH":   filepath.Join(t.TempDir(), "device_monitor.db"),
+		},
+	}}
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		backends = append(backends, testBackend{
+			name: "postgres",
+			env: map[string]string{
+				"DATABASE_DRIVER": database.DriverPostgres,
+				"DATABASE_URL":    url,
+			},
+		})
+	}
+	return backends
+}
+
+// forEachBackend opens and migrates every test backend through
+// database.InitDB and runs fn against it as a subtest
+func forEachBackend(t *testing.T, fn func(t *testing.T)) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			for k, v := range b.env {
+				t.Setenv(k, v)
+			}
+			if err := config.LoadConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.InitDB(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { database.Close() })
+			fn(t)
+		})
+	}
+}
+
+var testTenantSeq atomic.Int64
+
+// testTenant returns a tenant ID no other test uses, so tests can share a
+// PostgreSQL database between runs
+func testTenant() string {
+	return fmt.Sprintf("test-%d-%d", time.Now().UnixNano(), testTenantSeq.Add(1))
+}
+
+// addSession creates a session of a tenant's device; a positive duration
+// also ends it
+func addSession(t *testing.T, tenantID, deviceID string, start time.Time, duration time.Duration) *DeviceSession {
+	t.Helper()
+	s, err := CreateSession(tenantID, deviceID, start, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duration > 0 {
+		if err := EndSession(tenantID, s.SessionID, start.Add(duration), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err = Sessions.Get(tenantID, s.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// addPoint stores a raw telemetry point of a session
+func addPoint(t *testing.T, sessionID, pointName string, value float64, at time.Time) {
+	t.Helper()
+	_, err := database.DB.Exec(`INSERT INTO iot_data_points (session_id, point_name, point_value, unit, timestamp) VALUES (?, ?, ?, ?, ?)`,
+		sessionID, pointName, value, "u", at.UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addRollup stores a minute rollup standing in for expired raw points
+func addRollup(t *testing.T, sessionID, pointName, bucket string, count int, sum, min, max float64) {
+	t.Helper()
+	_, err := database.DB.Exec(`INSERT INTO iot_data_rollups (resolution, session_id, point_name, bucket_start, unit, sample_count, value_sum, min_value, max_value) VALUES ('minute', ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionID, pointName, bucket, "u", count, sum, min, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sessionIDs(sessions []*DeviceSession) []string {
+	ids := []string{}
+	for _, s := range sessions {
+		ids = append(ids, s.SessionID)
+	}
+	return ids
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+var testBase = time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+// repositoryCases exercise the repository interfaces; every backend must
+// pass all of them
+var repositoryCases = []struct {
+	name string
+	run  func(t *testing.T, tenantID string)
+}{
+	{"sessions/get is scoped to the tenant", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, time.Hour)
+		if s.Status != "completed" || s.DurationInt == nil || *s.DurationInt != 3600 {
+			t.Fatalf("ended session: status %q, duration %v", s.Status, s.DurationInt)
+		}
+		if !s.StartTime.Equal(testBase) || s.EndTime == nil || !s.EndTime.Equal(testBase.Add(time.Hour)) {
+			t.Fatalf("ended session times: %v - %v", s.StartTime, s.EndTime)
+		}
+		if _, err := Sessions.Get(testTenant(), s.SessionID); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("Get of another tenant's session: got %v, want sql.ErrNoRows", err)
+		}
+	}},
+	{"sessions/other tenants cannot read, change or delete a session", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, 0)
+		other := testTenant()
+		device, end := "stolen", testBase.Add(time.Hour)
+
+		if _, err := GetSessionByID(other, s.SessionID); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetSessionByID: got %v, want sql.ErrNoRows", err)
+		}
+		if _, err := UpdateSession(other, s.SessionID, SessionPatch{DeviceID: &device}, "test", ""); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("UpdateSession: got %v, want sql.ErrNoRows", err)
+		}
+		if err := EndSession(other, s.SessionID, end, nil); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("EndSession: got %v, want sql.ErrNoRows", err)
+		}
+		if err := DeleteSession(other, s.SessionID, "test", ""); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("DeleteSession: got %v, want sql.ErrNoRows", err)
+		}
+
+		got, err := GetSessionByID(tenantID, s.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DeviceID != "dev" || got.Status != "running" || got.DeletedAt != nil {
+			t.Fatalf("session after another tenant's changes: device %q, status %q, deleted %v", got.DeviceID, got.Status, got.DeletedAt)
+		}
+
+		if err := DeleteSession(tenantID, s.SessionID, "test", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RestoreSession(other, s.SessionID, "test", ""); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("RestoreSession: got %v, want sql.ErrNoRows", err)
+		}
+	}},
+	{"sessions/running lists a device's running sessions newest first", func(t *testing.T, tenantID string) {
+		older := addSession(t, tenantID, "dev", testBase, 0)
+		newer := addSession(t, tenantID, "dev", testBase.Add(time.Hour), 0)
+		addSession(t, tenantID, "dev", testBase.Add(2*time.Hour), 30*time.Minute)
+		addSession(t, tenantID, "other", testBase, 0)
+
+		running, err := Sessions.Running(tenantID, "dev")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sessionIDs(running), []string{newer.SessionID, older.SessionID}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Running = %v, want %v", got, want)
+		}
+	}},
+	{"sessions/list filters, orders and counts", func(t *testing.T, tenantID string) {
+		a := addSession(t, tenantID, "d1", testBase, time.Minute)
+		b := addSession(t, tenantID, "d1", testBase.Add(time.Hour), time.Minute)
+		c := addSession(t, tenantID, "d1", testBase.Add(2*time.Hour), 0)
+		addSession(t, tenantID, "d2", testBase.Add(3*time.Hour), 0)
+
+		sessions, total, err := Sessions.List(SessionFilter{TenantID: tenantID, DeviceID: "d1", Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sessionIDs(sessions), []string{c.SessionID, b.SessionID}; total != 3 || !reflect.DeepEqual(got, want) {
+			t.Fatalf("List = %v (total %d), want %v (total 3)", got, total, want)
+		}
+
+		sessions, total, err = Sessions.List(SessionFilter{TenantID: tenantID, DeviceID: "d1", Status: "completed", Order: "asc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sessionIDs(sessions), []string{a.SessionID, b.SessionID}; total != 2 || !reflect.DeepEqual(got, want) {
+			t.Fatalf("List completed = %v (total %d), want %v (total 2)", got, total, want)
+		}
+	}},
+	{"sessions/each reads what list returns", func(t *testing.T, tenantID string) {
+		for i := 0; i < 5; i++ {
+			addSession(t, tenantID, fmt.Sprintf("d%d", i%2), testBase.Add(time.Duration(i)*time.Hour), time.Minute)
+		}
+		filter := SessionFilter{TenantID: tenantID, Sort: SortDuration, Order: "asc"}
+
+		listed, _, err := Sessions.List(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		each := []*DeviceSession{}
+		if err := Sessions.Each(filter, func(s *DeviceSession) error {
+			each = append(each, s)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sessionIDs(each), sessionIDs(listed); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Each = %v, want %v", got, want)
+		}
+	}},
+	{"sessions/pages walk start times chronologically in both directions", func(t *testing.T, tenantID string) {
+		a := addSession(t, tenantID, "dev", testBase, 0)
+		b := addSession(t, tenantID, "dev", testBase.Add(250*time.Millisecond), 0)
+		c := addSession(t, tenantID, "dev", testBase.Add(250*time.Millisecond), 0)
+		d := addSession(t, tenantID, "dev", testBase.Add(time.Hour), 0)
+		// Node.js-era rows store their start time as ISO text
+		legacy := addSession(t, tenantID, "dev", testBase, 0)
+		if _, err := database.DB.Exec(`UPDATE device_sessions SET start_time = ? WHERE session_id = ?`,
+			"2026-03-02T08:30:00.000Z", legacy.SessionID); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{a.SessionID, b.SessionID, c.SessionID, legacy.SessionID, d.SessionID}
+
+		filter := SessionFilter{TenantID: tenantID, Order: "asc", Limit: 2, SkipCount: true}
+		var forward []string
+		var page *SessionPage
+		for token := ""; ; token = page.NextCursor {
+			var err error
+			if page, err = GetSessionPage(filter, token); err != nil {
+				t.Fatal(err)
+			}
+			forward = append(forward, sessionIDs(page.Sessions)...)
+			if page.NextCursor == "" {
+				break
+			}
+		}
+		if !reflect.DeepEqual(forward, want) {
+			t.Fatalf("pages forward = %v, want %v", forward, want)
+		}
+
+		backward := sessionIDs(page.Sessions)
+		for page.PrevCursor != "" {
+			var err error
+			if page, err = GetSessionPage(filter, page.PrevCursor); err != nil {
+				t.Fatal(err)
+			}
+			backward = append(sessionIDs(page.Sessions), backward...)
+		}
+		if !reflect.DeepEqual(backward, want) {
+			t.Fatalf("pages backward = %v, want %v", backward, want)
+		}
+	}},
+	{"sessions/trash pages walk deletion times newest first", func(t *testing.T, tenantID string) {
+		var want []string
+		for i := 0; i < 3; i++ {
+			s := addSession(t, tenantID, "dev", testBase.Add(time.Duration(i)*time.Hour), time.Minute)
+			if err := DeleteSession(tenantID, s.SessionID, "test", ""); err != nil {
+				t.Fatal(err)
+			}
+			want = append([]string{s.SessionID}, want...)
+		}
+		addSession(t, tenantID, "dev", testBase, time.Minute)
+
+		filter := SessionFilter{TenantID: tenantID, Deleted: true, Sort: SortDeletedAt, Limit: 2}
+		var got []string
+		for token := ""; ; {
+			page, err := GetSessionPage(filter, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Total == nil || *page.Total != 3 {
+				t.Fatalf("trash page total = %v, want 3", page.Total)
+			}
+			got = append(got, sessionIDs(page.Sessions)...)
+			if token = page.NextCursor; token == "" {
+				break
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("trash pages = %v, want %v", got, want)
+		}
+
+		filter.Deleted = false
+		if _, err := GetSessionPage(filter, ""); !errors.Is(err, ErrInvalidFilter) {
+			t.Fatalf("live pages by deletion time: got %v, want ErrInvalidFilter", err)
+		}
+	}},
+	{"sessions/overlapping selects sessions running within the range", func(t *testing.T, tenantID string) {
+		start, end := testBase.Add(time.Hour), testBase.Add(2*time.Hour)
+		addSession(t, tenantID, "dev", testBase, time.Hour) // ends as the range starts
+		runsInto := addSession(t, tenantID, "dev", testBase.Add(30*time.Minute), time.Hour)
+		inside := addSession(t, tenantID, "dev", testBase.Add(70*time.Minute), 10*time.Minute)
+		addSession(t, tenantID, "dev", end, 10*time.Minute) // starts as the range ends
+		running := addSession(t, tenantID, "dev", testBase.Add(-time.Hour), 0)
+
+		sessions, err := Sessions.Overlapping(tenantID, "", start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sessionIDs(sessions), []string{running.SessionID, runsInto.SessionID, inside.SessionID}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Overlapping = %v, want %v", got, want)
+		}
+
+		var starts []time.Time
+		if err := Sessions.EachOverlapping(tenantID, "dev", start, end, func(s *DeviceSession) error {
+			starts = append(starts, s.StartTime)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(starts) != len(sessions) {
+			t.Fatalf("EachOverlapping read %d sessions, want %d", len(starts), len(sessions))
+		}
+	}},
+	{"devices/last ended returns each device's latest ended session", func(t *testing.T, tenantID string) {
+		addSession(t, tenantID, "d1", testBase, time.Hour)
+		latest := addSession(t, tenantID, "d1", testBase.Add(2*time.Hour), time.Hour)
+		addSession(t, tenantID, "d1", testBase.Add(4*time.Hour), 0)
+		other := addSession(t, tenantID, "d2", testBase, time.Minute)
+		addSession(t, tenantID, "d3", testBase, 0)
+
+		last, err := Devices.LastEnded(tenantID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(last) != 2 || last["d1"] == nil || last["d1"].SessionID != latest.SessionID ||
+			last["d2"] == nil || last["d2"].SessionID != other.SessionID {
+			t.Fatalf("LastEnded = %v, want d1 %s and d2 %s", last, latest.SessionID, other.SessionID)
+		}
+	}},
+	{"telemetry/point summaries combine raw points and rollups", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, time.Hour)
+		addPoint(t, s.SessionID, "volume", 1, testBase)
+		addPoint(t, s.SessionID, "volume", 2, testBase.Add(10*time.Second))
+		addPoint(t, s.SessionID, "volume", 3, testBase.Add(70*time.Second))
+		addPoint(t, s.SessionID, "temperature", 10, testBase)
+		addRollup(t, s.SessionID, "volume", "2026-03-02 07:59:00", 2, 10, 4, 6)
+
+		summaries, err := Telemetry.PointSummaries(s.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summaries) != 2 {
+			t.Fatalf("PointSummaries = %+v, want temperature and volume", summaries)
+		}
+		temperature, volume := summaries[0], summaries[1]
+		if temperature.PointName != "temperature" || temperature.Count != 1 || !approxEqual(temperature.AvgValue, 10) {
+			t.Fatalf("temperature summary = %+v", temperature)
+		}
+		if volume.PointName != "volume" || volume.Count != 5 || volume.MinValue != 1 || volume.MaxValue != 6 ||
+			!approxEqual(volume.AvgValue, 16.0/5) {
+			t.Fatalf("volume summary = %+v", volume)
+		}
+	}},
+	{"telemetry/buckets aggregate one point per interval", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, time.Hour)
+		addPoint(t, s.SessionID, "volume", 1, testBase)
+		addPoint(t, s.SessionID, "volume", 2, testBase.Add(10*time.Second))
+		addPoint(t, s.SessionID, "volume", 3, testBase.Add(70*time.Second))
+		addPoint(t, s.SessionID, "temperature", 10, testBase)
+		addRollup(t, s.SessionID, "volume", "2026-03-02 07:59:00", 2, 10, 4, 6)
+
+		buckets, err := Telemetry.Buckets(s.SessionID, "volume", "minute")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []IotTimeSeries{
+			{TimeBucket: "2026-03-02 07:59:00", AvgValue: 5, MinValue: 4, MaxValue: 6, DataCount: 2},
+			{TimeBucket: "2026-03-02 08:00:00", AvgValue: 1.5, MinValue: 1, MaxValue: 2, DataCount: 2},
+			{TimeBucket: "2026-03-02 08:01:00", AvgValue: 3, MinValue: 3, MaxValue: 3, DataCount: 1},
+		}
+		if !reflect.DeepEqual(buckets, want) {
+			t.Fatalf("minute Buckets = %+v, want %+v", buckets, want)
+		}
+
+		buckets, err = Telemetry.Buckets(s.SessionID, "volume", "hour")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buckets) != 2 || buckets[1].TimeBucket != "2026-03-02 08:00:00" || buckets[1].DataCount != 3 {
+			t.Fatalf("hour Buckets = %+v", buckets)
+		}
+
+		if _, err := Telemetry.Buckets(s.SessionID, "volume", "week"); !errors.Is(err, ErrInvalidFilter) {
+			t.Fatalf("Buckets by week: got %v, want ErrInvalidFilter", err)
+		}
+	}},
+	{"telemetry/each bucket reads every point in bucket order", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, time.Hour)
+		addPoint(t, s.SessionID, "volume", 1, testBase)
+		addPoint(t, s.SessionID, "volume", 3, testBase.Add(70*time.Second))
+		addPoint(t, s.SessionID, "temperature", 10, testBase)
+		addRollup(t, s.SessionID, "volume", "2026-03-02 07:59:00", 2, 10, 4, 6)
+
+		var got []string
+		if err := Telemetry.EachBucket(s.SessionID, "", "minute", func(name string, b IotTimeSeries) error {
+			got = append(got, b.TimeBucket+" "+name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			"2026-03-02 07:59:00 volume",
+			"2026-03-02 08:00:00 temperature",
+			"2026-03-02 08:00:00 volume",
+			"2026-03-02 08:01:00 volume",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("EachBucket = %v, want %v", got, want)
+		}
+	}},
+	{"telemetry/each sample merges rollups and raw points in time order", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, time.Hour)
+		addRollup(t, s.SessionID, "volume", "2026-03-02 07:59:00", 2, 10, 4, 6)
+		addPoint(t, s.SessionID, "volume", -1, testBase)
+
+		// More points than fit a page share one fractional timestamp, so
+		// the page cursor has to break the tie by id
+		at := testBase.Add(500 * time.Millisecond)
+		err := database.WithTx(func(tx *database.Tx) error {
+			for i := 0; i <= samplePageSize; i++ {
+				if _, err := tx.Exec(`INSERT INTO iot_data_points (session_id, point_name, point_value, unit, timestamp) VALUES (?, ?, ?, ?, ?)`,
+					s.SessionID, "volume", i, "l", at.UTC()); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(`INSERT INTO iot_data_points (session_id, point_name, unit, timestamp, raw_data) VALUES (?, ?, ?, ?, ?)`,
+				s.SessionID, "state", "", testBase.Add(time.Minute).UTC(), "ERR")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var samples []IotSample
+		if err := Telemetry.EachSample(s.SessionID, "", func(sample IotSample) error {
+			samples = append(samples, sample)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != samplePageSize+4 {
+			t.Fatalf("EachSample read %d samples, want %d", len(samples), samplePageSize+4)
+		}
+
+		first, second, last := samples[0], samples[1], samples[len(samples)-1]
+		if first.PointName != "volume" || !first.Timestamp.Equal(testBase.Add(-time.Minute)) ||
+			first.Value == nil || *first.Value != 5 || first.Unit != "u" {
+			t.Fatalf("rollup sample = %+v", first)
+		}
+		if !second.Timestamp.Equal(testBase) || second.Value == nil || *second.Value != -1 {
+			t.Fatalf("first raw sample = %+v", second)
+		}
+		for i, sample := range samples[2 : len(samples)-1] {
+			if !sample.Timestamp.Equal(at) || sample.Value == nil || *sample.Value != float64(i) || sample.Unit != "l" {
+				t.Fatalf("sample %d at the shared timestamp = %+v", i, sample)
+			}
+		}
+		if last.PointName != "state" || last.Value != nil || last.RawData != "ERR" {
+			t.Fatalf("non-numeric sample = %+v", last)
+		}
+
+		var volume int
+		if err := Telemetry.EachSample(s.SessionID, "volume", func(IotSample) error {
+			volume++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if volume != samplePageSize+3 {
+			t.Fatalf("EachSample of volume read %d samples, want %d", volume, samplePageSize+3)
+		}
+	}},
+	{"telemetry/points are returned in time order", func(t *testing.T, tenantID string) {
+		s := addSession(t, tenantID, "dev", testBase, time.Hour)
+		addPoint(t, s.SessionID, "volume", 2, testBase.Add(time.Minute))
+		addPoint(t, s.SessionID, "volume", 1, testBase)
+
+		points, err := Telemetry.Points(s.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 2 || points[0].PointValue != 1 || !points[0].Timestamp.Equal(testBase) || points[1].PointValue != 2 {
+			t.Fatalf("Points = %+v", points)
+		}
+	}},
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		for _, tc := range repositoryCases {
+			t.Run(tc.name, func(t *testing.T) {
+				tc.run(t, testTenant())
+			})
+		}
+	})
+}
@@ -0,0 +1,336 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Telemetry resolutions, finest first. Raw points older than the raw
+// retention are aggregated into minute rollups, and minute rollups older
+// than the minute retention into hour rollups, so each resolution covers a
+// different, older stretch of time and queries combine all three.
+const (
+	ResolutionRaw    = "raw"
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+)
+
+// RetentionPolicy is how long data is kept at each resolution, measured from
+// the data's timestamp; zero keeps it forever
+type RetentionPolicy struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// MarshalJSON writes the retentions in the notation they are configured in
+func (p RetentionPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		ResolutionRaw:    formatRetention(p.Raw),
+		ResolutionMinute: formatRetention(p.Minute),
+		ResolutionHour:   formatRetention(p.Hour),
+	})
+}
+
+// RetentionPolicies holds the policy for all points and per-point overrides
+type RetentionPolicies struct {
+	Default RetentionPolicy            `json:"default"`
+	Points  map[string]RetentionPolicy `json:"points"`
+}
+
+// CompactionResult counts the rows removed from each resolution
+type CompactionResult struct {
+	RawRolledUp    int64 `json:"raw_rolled_up"`
+	MinuteRolledUp int64 `json:"minute_rolled_up"`
+	HourDeleted    int64 `json:"hour_deleted"`
+	// RawDeleted counts points without a value, which are deleted once
+	// the hour retention expires instead of being rolled up
+	RawDeleted int64 `json:"raw_deleted"`
+}
+
+// Enabled reports whether any data ever expires under the policies
+func (p *RetentionPolicies) Enabled() bool {
+	if p.Default.Raw > 0 {
+		return true
+	}
+	for _, policy := range p.Points {
+		if policy.Raw > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRetentionPolicies parses a default policy such as
+// "raw=30d,minute=1y,hour=forever" and per-point overrides such as
+// "vibration:raw=7d,minute=90d;temperature:raw=90d". Overrides inherit the
+// resolutions they leave out from the default. Durations take d, w and y
+// suffixes as well as Go durations; "forever" or 0 keeps data forever.
+func ParseRetentionPolicies(defaults, points string) (*RetentionPolicies, error) {
+	policies := &RetentionPolicies{Points: map[string]RetentionPolicy{}}
+	if err := parseRetentionPolicy(defaults, &policies.Default); err != nil {
+		return nil, err
+	}
+	if err := policies.Default.validate(); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range strings.Split(points, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid retention entry %q", entry)
+		}
+		policy := policies.Default
+		if err := parseRetentionPolicy(parts[1], &policy); err != nil {
+			return nil, err
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("point %s: %w", name, err)
+		}
+		policies.Points[name] = policy
+	}
+
+	return policies, nil
+}
+
+func parseRetentionPolicy(spec string, policy *RetentionPolicy) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid retention %q", item)
+		}
+		d, err := parseRetention(parts[1])
+		if err != nil {
+			return err
+		}
+
+		switch strings.TrimSpace(parts[0]) {
+		case ResolutionRaw:
+			policy.Raw = d
+		case ResolutionMinute:
+			policy.Minute = d
+		case ResolutionHour:
+			policy.Hour = d
+		default:
+			return fmt.Errorf("invalid retention resolution %q (expected raw, minute or hour)", parts[0])
+		}
+	}
+	return nil
+}
+
+func parseRetention(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "forever" || s == "0" {
+		return 0, nil
+	}
+
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	if s != "" {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid retention %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid retention %q", s)
+	}
+	return d, nil
+}
+
+func formatRetention(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d == 0:
+		return "forever"
+	case d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+// validate rejects policies whose coarser data would expire no later than
+// the finer data it is built from
+func (p RetentionPolicy) validate() error {
+	if p.Raw > 0 && p.Minute > 0 && p.Minute <= p.Raw {
+		return fmt.Errorf("minute retention %s must be longer than raw retention %s", formatRetention(p.Minute), formatRetention(p.Raw))
+	}
+	if p.Raw > 0 && p.Minute > 0 && p.Hour > 0 && p.Hour <= p.Minute {
+		return fmt.Errorf("hour retention %s must be longer than minute retention %s", formatRetention(p.Hour), formatRetention(p.Minute))
+	}
+	return nil
+}
+
+// rollupUpsert inserts rollup rows selected by the query it is appended to,
+// folding them into rows already present for the same bucket
+const rollupUpsert = `
+	ON CONFLICT (resolution, session_id, point_name, bucket_start) DO UPDATE SET
+		unit = COALESCE(iot_data_rollups.unit, excluded.unit),
+		sample_count = iot_data_rollups.sample_count + excluded.sample_count,
+		value_sum = iot_data_rollups.value_sum + excluded.value_sum,
+		min_value = CASE WHEN excluded.min_value < iot_data_rollups.min_value
+			THEN excluded.min_value ELSE iot_data_rollups.min_value END,
+		max_value = CASE WHEN excluded.max_value > iot_data_rollups.max_value
+			THEN excluded.max_value ELSE iot_data_rollups.max_value END`
+
+// rollupBucket truncates a rollup's bucket_start text to a minute, hour or
+// day, matching the output of the dialect's TimeBucket
+func rollupBucket(unit string) (string, error) {
+	switch unit {
+	case "minute":
+		return "bucket_start", nil
+	case "hour":
+		return "SUBSTR(bucket_start, 1, 13) || ':00:00'", nil
+	case "day":
+		return "SUBSTR(bucket_start, 1, 10) || ' 00:00:00'", nil
+	}
+	return "", fmt.Errorf("unsupported time bucket %q", unit)
+}
+
+// bucketArg formats a time like rollup bucket_start values
+func bucketArg(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// CompactTelemetry applies the retention policies as of now: expired raw
+// points become minute rollups, expired minute rollups become hour rollups
+// and expired hour rollups are deleted. Points without an override follow
+// the default policy.
+func CompactTelemetry(policies *RetentionPolicies, now time.Time) (*CompactionResult, error) {
+	result := &CompactionResult{}
+
+	names := make([]string, 0, len(policies.Points))
+	for name := range policies.Points {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The default policy covers every point not listed in an override
+	filter, args := "1 = 1", []interface{}{}
+	if len(names) > 0 {
+		filter = "point_name NOT IN (?" + strings.Repeat(", ?", len(names)-1) + ")"
+		for _, name := range names {
+			args = append(args, name)
+		}
+	}
+	if err := compactPoints(policies.Default, filter, args, now, result); err != nil {
+		return result, err
+	}
+
+	for _, name := range names {
+		if err := compactPoints(policies.Points[name], "point_name = ?", []interface{}{name}, now, result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func compactPoints(policy RetentionPolicy, filter string, filterArgs []interface{}, now time.Time, result *CompactionResult) error {
+	if policy.Raw <= 0 {
+		return nil
+	}
+
+	// Only whole minutes are rolled up, so a bucket is never split between
+	// raw points and its rollup
+	rawCutoff := now.Add(-policy.Raw).Truncate(time.Minute)
+	err := database.WithTx(func(tx *database.Tx) error {
+		bucket, err := tx.Dialect.TimeBucket("timestamp", "minute")
+		if err != nil {
+			return err
+		}
+		expired := timeExpr("timestamp") + ` < ` + timeExpr("?") + ` AND ` + filter
+		args := append([]interface{}{timeArg(rawCutoff)}, filterArgs...)
+
+		insert := fmt.Sprintf(`
+			INSERT INTO iot_data_rollups (resolution, session_id, point_name, bucket_start, unit, sample_count, value_sum, min_value, max_value)
+			SELECT 'minute', session_id, point_name, %s, MAX(unit), COUNT(*), SUM(point_value), MIN(point_value), MAX(point_value)
+			FROM iot_data_points
+			WHERE point_value IS NOT NULL AND %s
+			GROUP BY session_id, point_name, 4
+		`, bucket, expired) + rollupUpsert
+		if _, err := tx.Exec(insert, args...); err != nil {
+			return err
+		}
+
+		// Values without a number have nothing to roll up; they stay raw
+		// until the hour retention expires
+		res, err := tx.Exec(`DELETE FROM iot_data_points WHERE point_value IS NOT NULL AND `+expired, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		result.RawRolledUp += n
+		return nil
+	})
+	if err != nil || policy.Minute <= 0 {
+		return err
+	}
+
+	minuteCutoff := now.Add(-policy.Minute).Truncate(time.Hour)
+	err = database.WithTx(func(tx *database.Tx) error {
+		expired := `resolution = 'minute' AND bucket_start < ? AND ` + filter
+		args := append([]interface{}{bucketArg(minuteCutoff)}, filterArgs...)
+
+		insert := `
+			INSERT INTO iot_data_rollups (resolution, session_id, point_name, bucket_start, unit, sample_count, value_sum, min_value, max_value)
+			SELECT 'hour', session_id, point_name, SUBSTR(bucket_start, 1, 13) || ':00:00', MAX(unit),
+				SUM(sample_count), SUM(value_sum), MIN(min_value), MAX(max_value)
+			FROM iot_data_rollups
+			WHERE ` + expired + `
+			GROUP BY session_id, point_name, 4
+		` + rollupUpsert
+		if _, err := tx.Exec(insert, args...); err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(`DELETE FROM iot_data_rollups WHERE `+expired, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		result.MinuteRolledUp += n
+		return nil
+	})
+	if err != nil || policy.Hour <= 0 {
+		return err
+	}
+
+	hourCutoff := now.Add(-policy.Hour).Truncate(time.Hour)
+	res, err := database.DB.Exec(`DELETE FROM iot_data_rollups WHERE resolution = 'hour' AND bucket_start < ? AND `+filter,
+		append([]interface{}{bucketArg(hourCutoff)}, filterArgs...)...)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	result.HourDeleted += n
+
+	res, err = database.DB.Exec(`DELETE FROM iot_data_points WHERE point_value IS NULL AND `+
+		timeExpr("timestamp")+` < `+timeExpr("?")+` AND `+filter,
+		append([]interface{}{timeArg(hourCutoff)}, filterArgs...)...)
+	if err != nil {
+		return err
+	}
+	n, _ = res.RowsAffected()
+	result.RawDeleted += n
+	return nil
+}
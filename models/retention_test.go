@@ -0,0 +1,55 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"testing"
+	"time"
+)
+
+func TestCompactionKeepsPointsWithoutValue(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		s := addSession(t, testTenant(), "dev", testBase, time.Hour)
+		addPoint(t, s.SessionID, "temp", 20, testBase.Add(10*time.Second))
+		addPoint(t, s.SessionID, "temp", 30, testBase.Add(20*time.Second))
+		_, err := database.DB.Exec(`INSERT INTO iot_data_points (session_id, point_name, raw_data, timestamp) VALUES (?, ?, ?, ?)`,
+			s.SessionID, "state", "RUNNING", testBase.Add(15*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		policies := &RetentionPolicies{Default: RetentionPolicy{Raw: time.Hour, Minute: 24 * time.Hour, Hour: 7 * 24 * time.Hour}}
+		result, err := CompactTelemetry(policies, testBase.Add(2*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RawRolledUp != 2 || result.RawDeleted != 0 {
+			t.Fatalf("compaction = %+v, want the 2 numeric points rolled up", result)
+		}
+
+		points, err := Telemetry.Points(s.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 1 || points[0].PointName != "state" || points[0].RawData != "RUNNING" {
+			t.Fatalf("raw points after compaction = %+v, want only the state point", points)
+		}
+		summaries, err := Telemetry.PointSummaries(s.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summaries) != 2 || summaries[1].PointName != "temp" || summaries[1].Count != 2 || !approxEqual(summaries[1].AvgValue, 25) {
+			t.Fatalf("summaries after compaction = %+v, want temp averaging 25 over 2 points", summaries)
+		}
+
+		result, err = CompactTelemetry(policies, testBase.Add(8*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.HourDeleted != 1 || result.RawDeleted != 1 {
+			t.Fatalf("compaction = %+v, want the hour rollup and the state point deleted", result)
+		}
+		if points, err := Telemetry.Points(s.SessionID); err != nil || len(points) != 0 {
+			t.Fatalf("raw points after hour retention = %+v (%v), want none", points, err)
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"device-monitor-go/config"
+	"sort"
+	"time"
+)
+
+// Runtime histogram bucket sizes
+const (
+	BucketDay   = "day"
+	BucketHour  = "hour"
+	BucketShift = "shift"
+)
+
+// RuntimeBucket holds the runtime that fell within one bucket
+type RuntimeBucket struct {
+	Bucket  string    `json:"bucket"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Count   int       `json:"count"`   // sessions started within the bucket
+	Runtime int64     `json:"runtime"` // seconds of running time within the bucket
+}
+
+// HeatmapRow holds runtime seconds per hour of one local calendar day
+type HeatmapRow struct {
+	Date  string    `json:"date"`
+	Hours [24]int64 `json:"hours"`
+}
+
+// Heatmap is an hour-of-day runtime heatmap
+type Heatmap struct {
+	Days      []*HeatmapRow `json:"days"`
+	ByWeekday [7][24]int64  `json:"by_weekday"` // indexed Sunday = 0
+}
+
+// getOverlappingSessions loads a tenant's sessions running at any time
+// within [start, end); zero bounds leave that side open
+func getOverlappingSessions(tenantID, deviceID string, start, end time.Time) ([]*DeviceSession, error) {
+	return Sessions.Overlapping(tenantID, deviceID, start, end)
+}
+
+// sessionInterval returns the running interval of a session clipped to
+// [start, end); running sessions run until now
+func sessionInterval(s *DeviceSession, start, end, now time.Time) (time.Time, time.Time, bool) {
+	from, to := s.StartTime, now
+	if s.EndTime != nil {
+		to = *s.EndTime
+	}
+	if !start.IsZero() && from.Before(start) {
+		from = start
+	}
+	if !end.IsZero() && to.After(end) {
+		to = end
+	}
+	return from, to, to.After(from)
+}
+
+// bucketFloor returns the start of the day or hour containing t, in loc
+func bucketFloor(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	if bucket == BucketHour {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// bucketNext returns the start of the following bucket; computed from the
+// calendar so DST days are 23 or 25 hours long
+func bucketNext(t time.Time, bucket string, loc *time.Location) time.Time {
+	if bucket == BucketHour {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+}
+
+func bucketLabel(t time.Time, bucket string) string {
+	if bucket == BucketHour {
+		return t.Format("2006-01-02 15:00")
+	}
+	return t.Format("2006-01-02")
+}
+
+// GetRuntimeHistogram apportions session runtime across local days, hours or
+// planned shifts. Sessions crossing a bucket boundary contribute to every
+// bucket they overlap. The calendar is only used for shift buckets.
+func GetRuntimeHistogram(tenantID, deviceID, startDate, endDate string, loc *time.Location, bucket string, calendar ShiftCalendar) ([]*RuntimeBucket, error) {
+	if loc == nil {
+		loc = config.SiteLocation()
+	}
+
+	start, end, err := parseDateRange(startDate, endDate, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := getOverlappingSessions(tenantID, deviceID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if bucket == BucketShift {
+		return shiftHistogram(sessions, start, end, now, loc, calendar), nil
+	}
+	return runtimeHistogram(sessions, start, end, now, loc, bucket), nil
+}
+
+// runtimeHistogram apportions runtime of already loaded sessions across day
+// or hour buckets within [start, end)
+func runtimeHistogram(sessions []*DeviceSession, start, end, now time.Time, loc *time.Location, bucket string) []*RuntimeBucket {
+	acc := newRuntimeAccumulator(start, end, now, loc, bucket)
+	for _, s := range sessions {
+		acc.add(s)
+	}
+	return acc.result()
+}
+
+// runtimeAccumulator apportions session runtime across day or hour buckets
+// within [start, end) one session at a time, so sessions can be streamed
+type runtimeAccumulator struct {
+	start, end, now time.Time
+	loc             *time.Location
+	bucket          string
+	buckets         map[int64]*RuntimeBucket
+}
+
+func newRuntimeAccumulator(start, end, now time.Time, loc *time.Location, bucket string) *runtimeAccumulator {
+	acc := &runtimeAccumulator{
+		start:   start,
+		end:     end,
+		now:     now,
+		loc:     loc,
+		bucket:  bucket,
+		buckets: map[int64]*RuntimeBucket{},
+	}
+
+	// With a bounded range, include empty buckets so histograms have no holes
+	if !start.IsZero() && !end.IsZero() {
+		for t := bucketFloor(start, bucket, loc); t.Before(end); t = bucketNext(t, bucket, loc) {
+			acc.get(t)
+		}
+	}
+	return acc
+}
+
+func (acc *runtimeAccumulator) get(bStart time.Time) *RuntimeBucket {
+	b, ok := acc.buckets[bStart.Unix()]
+	if !ok {
+		b = &RuntimeBucket{
+			Bucket: bucketLabel(bStart, acc.bucket),
+			Start:  bStart,
+			End:    bucketNext(bStart, acc.bucket, acc.loc),
+		}
+		acc.buckets[bStart.Unix()] = b
+	}
+	return b
+}
+
+// add counts a session's start and apportions its runtime
+func (acc *runtimeAccumulator) add(s *DeviceSession) {
+	if (acc.start.IsZero() || !s.StartTime.Before(acc.start)) && (acc.end.IsZero() || s.StartTime.Before(acc.end)) {
+		acc.get(bucketFloor(s.StartTime, acc.bucket, acc.loc)).Count++
+	}
+
+	from, to, ok := sessionInterval(s, acc.start, acc.end, acc.now)
+	if !ok {
+		return
+	}
+	for t := from; t.Before(to); {
+		bStart := bucketFloor(t, acc.bucket, acc.loc)
+		segEnd := bucketNext(bStart, acc.bucket, acc.loc)
+		if segEnd.After(to) {
+			segEnd = to
+		}
+		acc.get(bStart).Runtime += int64(segEnd.Sub(t).Seconds())
+		t = segEnd
+	}
+}
+
+// result returns the buckets in time order
+func (acc *runtimeAccumulator) result() []*RuntimeBucket {
+	result := make([]*RuntimeBucket, 0, len(acc.buckets))
+	for _, b := range acc.buckets {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// shiftHistogram apportions runtime across planned shift windows
+func shiftHistogram(sessions []*DeviceSession, start, end, now time.Time, loc *time.Location, calendar ShiftCalendar) []*RuntimeBucket {
+	// Open ranges are bounded by the sessions themselves
+	if start.IsZero() {
+		for _, s := range sessions {
+			if start.IsZero() || s.StartTime.Before(start) {
+				start = s.StartTime
+			}
+		}
+		if start.IsZero() {
+			return []*RuntimeBucket{}
+		}
+		start = bucketFloor(start, BucketDay, loc)
+	}
+	if end.IsZero() {
+		end = now
+	}
+
+	result := []*RuntimeBucket{}
+	for _, p := range calendar.plannedIntervals(start.In(loc), end.In(loc)) {
+		b := &RuntimeBucket{
+			Bucket: p[0].Format("2006-01-02 15:04") + "-" + p[1].Format("15:04"),
+			Start:  p[0],
+			End:    p[1],
+		}
+		for _, s := range sessions {
+			if !s.StartTime.Before(p[0]) && s.StartTime.Before(p[1]) {
+				b.Count++
+			}
+			from, to, ok := sessionInterval(s, p[0], p[1], now)
+			if ok {
+				b.Runtime += int64(to.Sub(from).Seconds())
+			}
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// GetHourlyHeatmap returns runtime per local day and hour of day, plus the
+// same figures summed by weekday
+func GetHourlyHeatmap(tenantID, deviceID, startDate, endDate string, loc *time.Location) (*Heatmap, error) {
+	if loc == nil {
+		loc = config.SiteLocation()
+	}
+
+	buckets, err := GetRuntimeHistogram(tenantID, deviceID, startDate, endDate, loc, BucketHour, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	heatmap := &Heatmap{Days: []*HeatmapRow{}}
+	var row *HeatmapRow
+	for _, b := range buckets {
+		date := b.Start.Format("2006-01-02")
+		if row == nil || row.Date != date {
+			row = &HeatmapRow{Date: date}
+			heatmap.Days = append(heatmap.Days, row)
+		}
+		row.Hours[b.Start.Hour()] += b.Runtime
+		heatmap.ByWeekday[b.Start.Weekday()][b.Start.Hour()] += b.Runtime
+	}
+	return heatmap, nil
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFilter is returned for malformed metadata keys or sort options
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Session sort fields; metadata values sort with "metadata.<key>"
+const (
+	SortStartTime = "start_time"
+	SortEndTime   = "end_time"
+	SortDuration  = "duration"
+	SortDeviceID  = "device_id"
+	SortStatus    = "status"
+	SortDeletedAt = "deleted_at"
+	SortMetadata  = "metadata."
+)
+
+var sortColumns = map[string]string{
+	SortStartTime: "start_time",
+	SortEndTime:   "end_time",
+	SortDuration:  "duration",
+	SortDeviceID:  "device_id",
+	SortStatus:    "status",
+	SortDeletedAt: "deleted_at",
+}
+
+// metadataKeySegment restricts metadata keys to characters that are safe to
+// inline in a JSON path, which keeps filters matchable by expression indexes
+var metadataKeySegment = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// metadataPath splits a metadata key such as "operator" or "batch.line"
+// into its validated object keys
+func metadataPath(key string) ([]string, error) {
+	segments := strings.Split(key, ".")
+	for _, segment := range segments {
+		if !metadataKeySegment.MatchString(segment) {
+			return nil, fmt.Errorf("%w: metadata key %q", ErrInvalidFilter, key)
+		}
+	}
+	return segments, nil
+}
+
+// metadataExpr returns the SQL expression extracting a metadata key; it is
+// identical to the expression used by EnsureMetadataIndexes
+func metadataExpr(key string) (string, error) {
+	path, err := metadataPath(key)
+	if err != nil {
+		return "", err
+	}
+	return database.DB.Dialect.JSONValue("metadata", path), nil
+}
+
+// metadataValueArgs returns the values a query string value may be stored as.
+// SQLite's json_extract returns typed values, so the number or boolean the
+// text spells is matched too; PostgreSQL extracts every value as text.
+func metadataValueArgs(value string) []interface{} {
+	args := []interface{}{value}
+	if database.DB.Dialect.Name() != "sqlite" {
+		return args
+	}
+	switch value {
+	case "true":
+		return append(args, 1)
+	case "false":
+		return append(args, 0)
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return append(args, i)
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return append(args, f)
+	}
+	return args
+}
+
+// escapeLike escapes LIKE wildcards so search text matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// sessionConditions builds the WHERE conditions shared by session listing
+// and counting
+func sessionConditions(filter SessionFilter) (string, []interface{}, error) {
+	where := " AND tenant_id = ?" + liveCondition
+	if filter.Deleted {
+		where = " AND tenant_id = ? AND deleted_at IS NOT NULL"
+	}
+	args := []interface{}{filter.TenantID}
+
+	if filter.DeviceID != "" {
+		where += " AND device_id = ?"
+		args = append(args, filter.DeviceID)
+	}
+
+	if filter.Status != "" {
+		where += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+
+	where, args, err := dateFilter(where, args, filter.StartDate, filter.EndDate, filter.Location)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if filter.MinDuration != nil {
+		where += " AND duration >= ?"
+		args = append(args, *filter.MinDuration)
+	}
+	if filter.MaxDuration != nil {
+		where += " AND duration <= ?"
+		args = append(args, *filter.MaxDuration)
+	}
+
+	for key, values := range filter.Metadata {
+		if len(values) == 0 {
+			continue
+		}
+		expr, err := metadataExpr(key)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// Several values for one key match any of them
+		placeholders := []string{}
+		for _, v := range values {
+			for _, arg := range metadataValueArgs(v) {
+				placeholders = append(placeholders, "?")
+				args = append(args, arg)
+			}
+		}
+		where += fmt.Sprintf(" AND %s IN (%s)", expr, strings.Join(placeholders, ", "))
+	}
+
+	if filter.Search != "" {
+		// Match ids, metadata values (but not JSON keys or syntax) and annotations
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		like := database.DB.Dialect.Like()
+		where += fmt.Sprintf(` AND (session_id %[1]s ? ESCAPE '\' OR device_id %[1]s ? ESCAPE '\'
+			OR %[2]s
+			OR EXISTS (
+				SELECT 1 FROM session_annotations a
+				WHERE a.session_id = device_sessions.session_id AND a.body %[1]s ? ESCAPE '\'
+			))`, like, database.DB.Dialect.JSONValuesLike("device_sessions.metadata"))
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	if len(filter.Tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Tags)), ", ")
+		where += ` AND EXISTS (
+			SELECT 1 FROM session_tags st JOIN tags t ON t.id = st.tag_id
+			WHERE st.session_id = device_sessions.session_id AND t.name IN (` + placeholders + `)
+		)`
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+	}
+
+	return where, args, nil
+}
+
+// sessionOrder builds the ORDER BY clause; it defaults to newest first
+func sessionOrder(sort, order string) (string, error) {
+	if sort == "" {
+		sort = SortStartTime
+	}
+
+	direction := "DESC"
+	switch strings.ToLower(order) {
+	case "", "desc":
+	case "asc":
+		direction = "ASC"
+	default:
+		return "", fmt.Errorf("%w: order %q, expected asc or desc", ErrInvalidFilter, order)
+	}
+
+	column, ok := sortColumns[sort]
+	if !ok {
+		if !strings.HasPrefix(sort, SortMetadata) {
+			return "", fmt.Errorf("%w: sort %q", ErrInvalidFilter, sort)
+		}
+		expr, err := metadataExpr(strings.TrimPrefix(sort, SortMetadata))
+		if err != nil {
+			return "", err
+		}
+		column = expr
+	}
+
+	// Keep the order stable across pages
+	return fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction), nil
+}
+
+// EnsureMetadataIndexes creates expression indexes for frequently filtered
+// metadata keys so equality filters on them avoid a full table scan
+func EnsureMetadataIndexes(keys []string) error {
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		expr, err := metadataExpr(key)
+		if err != nil {
+			return err
+		}
+
+		name := "idx_metadata_" + strings.NewReplacer(".", "_", "-", "_").Replace(key)
+		query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON device_sessions((%s))", name, expr)
+		if _, err := database.DB.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index for metadata key %q: %w", key, err)
+		}
+		log.Printf("Ensured index %s", name)
+	}
+	return nil
+}
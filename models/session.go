@@ -2,37 +2,144 @@ package models
 
 import (
 	"database/sql"
+	"device-monitor-go/config"
 	"device-monitor-go/database"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type DeviceSession struct {
-	ID         int                `db:"id" json:"id"`
-	DeviceID   string             `db:"device_id" json:"device_id"`
-	SessionID  string             `db:"session_id" json:"session_id"`
-	StartTime  time.Time          `db:"start_time" json:"start_time"`
-	EndTime    *time.Time         `db:"end_time" json:"end_time"`
-	Duration   sql.NullInt64      `db:"duration" json:"-"`
-	DurationInt *int64            `json:"duration"`
-	Status     string             `db:"status" json:"status"`
-	Metadata   sql.NullString     `db:"metadata" json:"-"`
+	ID          int                    `db:"id" json:"id"`
+	TenantID    string                 `db:"tenant_id" json:"tenant_id"`
+	DeviceID    string                 `db:"device_id" json:"device_id"`
+	SessionID   string                 `db:"session_id" json:"session_id"`
+	StartTime   time.Time              `db:"start_time" json:"start_time"`
+	EndTime     *time.Time             `db:"end_time" json:"end_time"`
+	Duration    sql.NullInt64          `db:"duration" json:"-"`
+	DurationInt *int64                 `json:"duration"`
+	Status      string                 `db:"status" json:"status"`
+	Metadata    sql.NullString         `db:"metadata" json:"-"`
 	MetadataObj map[string]interface{} `json:"metadata"`
-	CreatedAt  time.Time          `db:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `db:"updated_at" json:"updated_at"`
+	CreatedAt   time.Time              `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time              `db:"updated_at" json:"updated_at"`
+	DeletedAt   *time.Time             `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 type SessionFilter struct {
+	// TenantID restricts the sessions to one tenant; it is required
+	TenantID string
+
 	DeviceID  string
 	Status    string
 	StartDate string
 	EndDate   string
 	Limit     int
 	Offset    int
+
+	// Location interprets StartDate/EndDate; defaults to the site timezone
+	Location *time.Location
+
+	// Duration range in seconds, inclusive
+	MinDuration *int64
+	MaxDuration *int64
+
+	// Metadata matches keys (dotted for nested objects) against any of the values
+	Metadata map[string][]string
+
+	// Search matches session and device ids, metadata values and annotation text
+	Search string
+
+	// Tags matches sessions carrying any of the tags
+	Tags []string
+
+	// Sort is a column or "metadata.<key>"; Order is asc or desc
+	Sort  string
+	Order string
+
+	// SkipCount leaves out the COUNT(*) query; the returned total is then 0
+	SkipCount bool
+
+	// Deleted lists sessions in the trash instead of live sessions
+	Deleted bool
+}
+
+// ErrInvalidDate is returned when a date filter is not formatted as YYYY-MM-DD
+var ErrInvalidDate = errors.New("invalid date, expected YYYY-MM-DD")
+
+// In converts the session's timestamps to the given location for output
+func (s *DeviceSession) In(loc *time.Location) {
+	s.StartTime = s.StartTime.In(loc)
+	if s.EndTime != nil {
+		t := s.EndTime.In(loc)
+		s.EndTime = &t
+	}
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	if s.DeletedAt != nil {
+		t := s.DeletedAt.In(loc)
+		s.DeletedAt = &t
+	}
+}
+
+// timeExpr wraps a timestamp column or placeholder so that it compares
+// chronologically in the configured database
+func timeExpr(expr string) string {
+	return database.DB.Dialect.Time(expr)
+}
+
+// timeArg converts a time into an argument comparable with timeExpr("?")
+func timeArg(t time.Time) interface{} {
+	return database.DB.Dialect.TimeArg(t)
+}
+
+// parseDateRange converts inclusive local YYYY-MM-DD dates into a half-open
+// [start, end) range. Missing dates yield zero times.
+func parseDateRange(startDate, endDate string, loc *time.Location) (time.Time, time.Time, error) {
+	if loc == nil {
+		loc = config.SiteLocation()
+	}
+
+	var start, end time.Time
+	if startDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", startDate, loc)
+		if err != nil {
+			return start, end, ErrInvalidDate
+		}
+		start = t
+	}
+	if endDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", endDate, loc)
+		if err != nil {
+			return start, end, ErrInvalidDate
+		}
+		end = t.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// dateFilter appends start_time conditions for inclusive local calendar dates.
+// Dates are converted to UTC instants so that days follow the site timezone
+// rather than the database's UTC dates.
+func dateFilter(query string, args []interface{}, startDate, endDate string, loc *time.Location) (string, []interface{}, error) {
+	start, end, err := parseDateRange(startDate, endDate, loc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !start.IsZero() {
+		query += " AND " + timeExpr("start_time") + " >= " + timeExpr("?")
+		args = append(args, timeArg(start))
+	}
+	if !end.IsZero() {
+		query += " AND " + timeExpr("start_time") + " < " + timeExpr("?")
+		args = append(args, timeArg(end))
+	}
+
+	return query, args, nil
 }
 
 // BeforeSave processes metadata before saving
@@ -56,20 +163,24 @@ func (s *DeviceSession) AfterFind() error {
 			return err
 		}
 	}
-	
+
 	// Process duration
 	if s.Duration.Valid {
 		s.DurationInt = &s.Duration.Int64
 	} else {
 		s.DurationInt = nil
 	}
-	
+
+	// Present timestamps in the site timezone
+	s.In(config.SiteLocation())
+
 	return nil
 }
 
-// CreateSession creates a new device session
-func CreateSession(deviceID string, startTime time.Time, metadata map[string]interface{}) (*DeviceSession, error) {
+// CreateSession creates a new device session for a tenant's device
+func CreateSession(tenantID, deviceID string, startTime time.Time, metadata map[string]interface{}) (*DeviceSession, error) {
 	session := &DeviceSession{
+		TenantID:    tenantID,
 		DeviceID:    deviceID,
 		SessionID:   uuid.New().String(),
 		StartTime:   startTime,
@@ -81,23 +192,10 @@ func CreateSession(deviceID string, startTime time.Time, metadata map[string]int
 		return nil, err
 	}
 
-	query := `
-		INSERT INTO device_sessions (device_id, session_id, start_time, status, metadata)
-		VALUES (?, ?, ?, ?, ?)
-	`
-
-	result, err := database.DB.Exec(query, session.DeviceID, session.SessionID, 
-		session.StartTime, session.Status, session.Metadata)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+	if err := Sessions.Create(session); err != nil {
 		return nil, err
 	}
 
-	session.ID = int(id)
 	session.CreatedAt = time.Now()
 	session.UpdatedAt = time.Now()
 
@@ -105,9 +203,9 @@ func CreateSession(deviceID string, startTime time.Time, metadata map[string]int
 }
 
 // EndSession ends a running session
-func EndSession(sessionID string, endTime time.Time, metadata map[string]interface{}) error {
+func EndSession(tenantID, sessionID string, endTime time.Time, metadata map[string]interface{}) error {
 	// First get the session to calculate duration
-	session, err := GetSessionByID(sessionID)
+	session, err := GetSessionByID(tenantID, sessionID)
 	if err != nil {
 		return err
 	}
@@ -117,7 +215,7 @@ func EndSession(sessionID string, endTime time.Time, metadata map[string]interfa
 	}
 
 	duration := int64(endTime.Sub(session.StartTime).Seconds())
-	
+
 	// Merge metadata
 	if metadata != nil {
 		if session.MetadataObj == nil {
@@ -137,273 +235,40 @@ func EndSession(sessionID string, endTime time.Time, metadata map[string]interfa
 		return err
 	}
 
-	query := `
-		UPDATE device_sessions 
-		SET end_time = ?, duration = ?, status = ?, metadata = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE session_id = ?
-	`
-
-	_, err = database.DB.Exec(query, endTime, duration, session.Status, session.Metadata, sessionID)
-	return err
+	return Sessions.End(session)
 }
 
-// GetSessionByID retrieves a session by ID
-func GetSessionByID(sessionID string) (*DeviceSession, error) {
-	session := &DeviceSession{}
-	query := `SELECT * FROM device_sessions WHERE session_id = ?`
-	
-	err := database.DB.Get(session, query, sessionID)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := session.AfterFind(); err != nil {
-		return nil, err
-	}
-
-	return session, nil
+// GetSessionByID retrieves a tenant's session by ID; sessions in the trash
+// and sessions of other tenants are not found
+func GetSessionByID(tenantID, sessionID string) (*DeviceSession, error) {
+	return Sessions.Get(tenantID, sessionID)
 }
 
-// GetRunningSessions gets all running sessions for a device
-func GetRunningSessions(deviceID string) ([]*DeviceSession, error) {
-	sessions := []*DeviceSession{}
-	query := `SELECT * FROM device_sessions WHERE device_id = ? AND status = 'running' ORDER BY start_time DESC`
-	
-	err := database.DB.Select(&sessions, query, deviceID)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, session := range sessions {
-		if err := session.AfterFind(); err != nil {
-			return nil, err
-		}
-	}
-
-	return sessions, nil
+// GetRunningSessions gets all running sessions for a tenant's device
+func GetRunningSessions(tenantID, deviceID string) ([]*DeviceSession, error) {
+	return Sessions.Running(tenantID, deviceID)
 }
 
 // GetSessions retrieves sessions with filtering
 func GetSessions(filter SessionFilter) ([]*DeviceSession, int, error) {
-	// Build query
-	query := `SELECT * FROM device_sessions WHERE 1=1`
-	countQuery := `SELECT COUNT(*) FROM device_sessions WHERE 1=1`
-	args := []interface{}{}
-
-	if filter.DeviceID != "" {
-		query += " AND device_id = ?"
-		countQuery += " AND device_id = ?"
-		args = append(args, filter.DeviceID)
-	}
-
-	if filter.Status != "" {
-		query += " AND status = ?"
-		countQuery += " AND status = ?"
-		args = append(args, filter.Status)
-	}
-
-	if filter.StartDate != "" {
-		query += " AND DATE(start_time) >= ?"
-		countQuery += " AND DATE(start_time) >= ?"
-		args = append(args, filter.StartDate)
-	}
-
-	if filter.EndDate != "" {
-		query += " AND DATE(start_time) <= ?"
-		countQuery += " AND DATE(start_time) <= ?"
-		args = append(args, filter.EndDate)
-	}
-
-	// Get total count
-	var total int
-	err := database.DB.Get(&total, countQuery, args...)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Add ordering and pagination
-	query += " ORDER BY start_time DESC"
-	
-	if filter.Limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, filter.Limit)
-	}
-
-	if filter.Offset > 0 {
-		query += " OFFSET ?"
-		args = append(args, filter.Offset)
-	}
-
-	// Get sessions
-	sessions := []*DeviceSession{}
-	err = database.DB.Select(&sessions, query, args...)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Process metadata
-	for _, session := range sessions {
-		if err := session.AfterFind(); err != nil {
-			return nil, 0, err
-		}
-	}
-
-	return sessions, total, nil
+	return Sessions.List(filter)
 }
 
-// DeleteSession deletes a session
-func DeleteSession(sessionID string) error {
-	query := `DELETE FROM device_sessions WHERE session_id = ?`
-	_, err := database.DB.Exec(query, sessionID)
-	return err
+// EachSession calls fn with every session matching the filter, in list
+// order, without loading them all at once
+func EachSession(filter SessionFilter, fn func(*DeviceSession) error) error {
+	return Sessions.Each(filter, fn)
 }
 
-// GetStatistics retrieves session statistics
-func GetStatistics(deviceID string, startDate, endDate string) (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
-
-	// Total sessions count
-	var totalSessions int
-	query := `SELECT COUNT(*) FROM device_sessions WHERE 1=1`
-	args := []interface{}{}
-
-	if deviceID != "" {
-		query += " AND device_id = ?"
-		args = append(args, deviceID)
-	}
-
-	if startDate != "" {
-		query += " AND DATE(start_time) >= ?"
-		args = append(args, startDate)
-	}
-
-	if endDate != "" {
-		query += " AND DATE(start_time) <= ?"
-		args = append(args, endDate)
-	}
-
-	err := database.DB.Get(&totalSessions, query, args...)
-	if err != nil {
-		return nil, err
-	}
-	stats["total_sessions"] = totalSessions
-
-	// Completed sessions
-	var completedSessions int
-	completedQuery := query + " AND status = 'completed'"
-	err = database.DB.Get(&completedSessions, completedQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	stats["completed_sessions"] = completedSessions
-
-	// Running sessions
-	var runningSessions int
-	runningQuery := query + " AND status = 'running'"
-	err = database.DB.Get(&runningSessions, runningQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	stats["running_sessions"] = runningSessions
-
-	// Total duration
-	var totalDuration sql.NullInt64
-	durationQuery := strings.Replace(query, "COUNT(*)", "SUM(duration)", 1)
-	err = database.DB.Get(&totalDuration, durationQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	if totalDuration.Valid {
-		stats["total_duration"] = totalDuration.Int64
-	} else {
-		stats["total_duration"] = 0
-	}
-
-	// Average duration
-	var avgDuration sql.NullFloat64
-	avgQuery := strings.Replace(query, "COUNT(*)", "AVG(duration)", 1) + " AND status = 'completed'"
-	err = database.DB.Get(&avgDuration, avgQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	if avgDuration.Valid {
-		stats["avg_duration"] = avgDuration.Float64
-	} else {
-		stats["avg_duration"] = 0
-	}
-
-	// Max duration
-	var maxDuration sql.NullInt64
-	maxQuery := strings.Replace(query, "COUNT(*)", "MAX(duration)", 1) + " AND status = 'completed'"
-	err = database.DB.Get(&maxDuration, maxQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	if maxDuration.Valid {
-		stats["max_duration"] = maxDuration.Int64
-	} else {
-		stats["max_duration"] = 0
-	}
-
-	// Min duration
-	var minDuration sql.NullInt64
-	minQuery := strings.Replace(query, "COUNT(*)", "MIN(duration)", 1) + " AND status = 'completed' AND duration > 0"
-	err = database.DB.Get(&minDuration, minQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	if minDuration.Valid {
-		stats["min_duration"] = minDuration.Int64
-	} else {
-		stats["min_duration"] = 0
-	}
-
-	// Daily distribution
-	dailyQuery := `
-		SELECT DATE(start_time) as date, COUNT(*) as count, SUM(duration) as total_duration
-		FROM device_sessions
-		WHERE 1=1
-	`
-	if deviceID != "" {
-		dailyQuery += " AND device_id = ?"
-	}
-	if startDate != "" {
-		dailyQuery += " AND DATE(start_time) >= ?"
-	}
-	if endDate != "" {
-		dailyQuery += " AND DATE(start_time) <= ?"
-	}
-	dailyQuery += " GROUP BY DATE(start_time) ORDER BY date"
-
-	rows, err := database.DB.Query(dailyQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	dailyStats := []map[string]interface{}{}
-	for rows.Next() {
-		var date string
-		var count int
-		var totalDuration sql.NullInt64
-		
-		err := rows.Scan(&date, &count, &totalDuration)
+// DeleteSession moves a session to the trash and records the deleted version
+// in the audit log; its annotations, tags and IoT data are kept until the
+// session is purged. sql.ErrNoRows means the session did not exist.
+func DeleteSession(tenantID, sessionID, actor, reason string) error {
+	return database.WithTx(func(tx *database.Tx) error {
+		before, err := getSessionTx(tx, tenantID, sessionID)
 		if err != nil {
-			return nil, err
-		}
-
-		stat := map[string]interface{}{
-			"date":  date,
-			"count": count,
-		}
-		if totalDuration.Valid {
-			stat["total_duration"] = totalDuration.Int64
-		} else {
-			stat["total_duration"] = 0
+			return err
 		}
-		dailyStats = append(dailyStats, stat)
-	}
-	stats["daily_distribution"] = dailyStats
-
-	return stats, nil
-}
\ No newline at end of file
+		return trashSessionTx(tx, before, actor, reason)
+	})
+}
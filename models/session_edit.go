@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"device-monitor-go/database"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSession is returned when a created or corrected session is inconsistent
+var ErrInvalidSession = errors.New("invalid session")
+
+// clockSkew tolerates small clock differences when rejecting future times
+const clockSkew = time.Minute
+
+// SessionPatch holds corrections to a session; nil fields are left unchanged
+type SessionPatch struct {
+	DeviceID     *string
+	StartTime    *time.Time
+	EndTime      *time.Time
+	ClearEndTime bool // reopen the session as running
+
+	// Metadata is merged into the existing metadata; nil values remove keys
+	Metadata map[string]interface{}
+}
+
+// getSessionTx loads a tenant's live (not trashed) session within a transaction
+func getSessionTx(tx *database.Tx, tenantID, sessionID string) (*DeviceSession, error) {
+	session := &DeviceSession{}
+	query := `SELECT * FROM device_sessions WHERE session_id = ? AND tenant_id = ? AND deleted_at IS NULL`
+	if err := tx.Get(session, query, sessionID, tenantID); err != nil {
+		return nil, err
+	}
+	if err := session.AfterFind(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// normalize validates a session and derives its status and duration from
+// its start and end times
+func (s *DeviceSession) normalize() error {
+	s.DeviceID = strings.TrimSpace(s.DeviceID)
+	if s.DeviceID == "" {
+		return fmt.Errorf("%w: device_id is required", ErrInvalidSession)
+	}
+	if s.StartTime.IsZero() {
+		return fmt.Errorf("%w: start_time is required", ErrInvalidSession)
+	}
+
+	latest := time.Now().Add(clockSkew)
+	if s.StartTime.After(latest) {
+		return fmt.Errorf("%w: start_time is in the future", ErrInvalidSession)
+	}
+
+	if s.EndTime == nil {
+		s.Status = "running"
+		s.Duration = sql.NullInt64{Int64: 0, Valid: true}
+	} else {
+		if s.EndTime.Before(s.StartTime) {
+			return fmt.Errorf("%w: end_time is before start_time", ErrInvalidSession)
+		}
+		if s.EndTime.After(latest) {
+			return fmt.Errorf("%w: end_time is in the future", ErrInvalidSession)
+		}
+		s.Status = "completed"
+		s.Duration = sql.NullInt64{Int64: int64(s.EndTime.Sub(s.StartTime).Seconds()), Valid: true}
+	}
+	duration := s.Duration.Int64
+	s.DurationInt = &duration
+
+	return s.BeforeSave()
+}
+
+// CreateManualSession backfills a session that was not reported by webhook.
+// Without an end time the session is created as running.
+func CreateManualSession(tenantID, deviceID string, startTime time.Time, endTime *time.Time, metadata map[string]interface{}, actor, reason string) (*DeviceSession, error) {
+	session := &DeviceSession{
+		TenantID:    tenantID,
+		DeviceID:    deviceID,
+		SessionID:   uuid.New().String(),
+		StartTime:   startTime,
+		EndTime:     endTime,
+		MetadataObj: metadata,
+	}
+	if err := session.normalize(); err != nil {
+		return nil, err
+	}
+
+	err := database.WithTx(func(tx *database.Tx) error {
+		if err := insertSessionTx(tx, session); err != nil {
+			return err
+		}
+		return recordAudit(tx, AuditCreate, session.SessionID, actor, reason, nil, session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// insertSessionTx stores a normalized session within a transaction
+func insertSessionTx(tx *database.Tx, session *DeviceSession) error {
+	query := `
+		INSERT INTO device_sessions (tenant_id, device_id, session_id, start_time, end_time, duration, status, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	id, err := tx.Insert(query, session.TenantID, session.DeviceID, session.SessionID, session.StartTime.UTC(),
+		utcTime(session.EndTime), session.Duration, session.Status, session.Metadata)
+	if err != nil {
+		return err
+	}
+	session.ID = int(id)
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+	return nil
+}
+
+// updateSessionTx saves a normalized session's editable fields
+func updateSessionTx(tx *database.Tx, session *DeviceSession) error {
+	query := `
+		UPDATE device_sessions
+		SET device_id = ?, start_time = ?, end_time = ?, duration = ?, status = ?, metadata = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE session_id = ?
+	`
+	_, err := tx.Exec(query, session.DeviceID, session.StartTime.UTC(), utcTime(session.EndTime),
+		session.Duration, session.Status, session.Metadata, session.SessionID)
+	if err != nil {
+		return err
+	}
+	session.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateSession applies corrections to a session, recomputing its duration
+// and status, and records the before and after versions in the audit log
+func UpdateSession(tenantID, sessionID string, patch SessionPatch, actor, reason string) (*DeviceSession, error) {
+	var updated *DeviceSession
+
+	err := database.WithTx(func(tx *database.Tx) error {
+		before, err := getSessionTx(tx, tenantID, sessionID)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		if patch.DeviceID != nil {
+			after.DeviceID = *patch.DeviceID
+		}
+		if patch.StartTime != nil {
+			after.StartTime = *patch.StartTime
+		}
+		if patch.ClearEndTime {
+			after.EndTime = nil
+		} else if patch.EndTime != nil {
+			after.EndTime = patch.EndTime
+		}
+		if patch.Metadata != nil {
+			merged := map[string]interface{}{}
+			for k, v := range before.MetadataObj {
+				merged[k] = v
+			}
+			for k, v := range patch.Metadata {
+				if v == nil {
+					delete(merged, k)
+				} else {
+					merged[k] = v
+				}
+			}
+			after.MetadataObj = merged
+			after.Metadata = sql.NullString{}
+		}
+
+		if err := after.normalize(); err != nil {
+			return err
+		}
+
+		if err := updateSessionTx(tx, &after); err != nil {
+			return err
+		}
+		updated = &after
+		return recordAudit(tx, AuditUpdate, sessionID, actor, reason, before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
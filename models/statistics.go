@@ -0,0 +1,487 @@
+package models
+
+import (
+	"database/sql"
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Statistics grouping keys; metadata grouping uses "metadata.<key>"
+const (
+	GroupByDevice   = "device"
+	GroupByDay      = "day"
+	GroupByWeek     = "week"
+	GroupByMonth    = "month"
+	GroupByStatus   = "status"
+	GroupByMetadata = "metadata."
+)
+
+// ErrInvalidGroupBy is returned for an unsupported groupBy value
+var ErrInvalidGroupBy = errors.New("invalid groupBy, expected device, day, week, month, status or metadata.<key>")
+
+// durationHistogramEdges are the lower bounds, in seconds, of the duration
+// histogram bins; the last bin is open-ended
+var durationHistogramEdges = []int64{0, 60, 300, 900, 1800, 3600, 7200, 14400, 28800, 43200, 86400}
+
+// StatisticsQuery selects the sessions to summarise. Dates are inclusive local
+// calendar days in Location, matched against session start times. Only the
+// sessions of TenantID are summarised.
+type StatisticsQuery struct {
+	TenantID  string
+	DeviceID  string
+	StartDate string
+	EndDate   string
+	Location  *time.Location
+	GroupBy   string
+	// Percentiles adds duration percentiles, which unlike the other figures
+	// need every completed session's duration to be read
+	Percentiles bool
+}
+
+// DurationPercentiles holds completed session duration percentiles in seconds
+type DurationPercentiles struct {
+	P50 float64 `json:"p50"`
+	P75 float64 `json:"p75"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// HistogramBin counts completed sessions with From <= duration < To seconds;
+// To is null for the last, open-ended bin
+type HistogramBin struct {
+	From  int64  `json:"from"`
+	To    *int64 `json:"to"`
+	Count int    `json:"count"`
+}
+
+// SessionSummary holds the aggregate figures shared by the whole result and
+// each group. Durations are in seconds; averages, extremes, percentiles and
+// the histogram only consider completed sessions.
+type SessionSummary struct {
+	TotalSessions     int                  `json:"total_sessions"`
+	CompletedSessions int                  `json:"completed_sessions"`
+	RunningSessions   int                  `json:"running_sessions"`
+	TotalDuration     int64                `json:"total_duration"`
+	AvgDuration       float64              `json:"avg_duration"`
+	MaxDuration       int64                `json:"max_duration"`
+	MinDuration       int64                `json:"min_duration"` // smallest non-zero duration
+	Percentiles       *DurationPercentiles `json:"percentiles,omitempty"`
+	Histogram         []HistogramBin       `json:"histogram"`
+
+	timedSessions int   // completed sessions with a duration
+	timedDuration int64 // their summed duration
+}
+
+// DailyStat holds the runtime apportioned to one local calendar day
+type DailyStat struct {
+	Date          string `json:"date"`
+	Count         int    `json:"count"`          // sessions started on the day
+	TotalDuration int64  `json:"total_duration"` // seconds of running time on the day
+}
+
+// StatisticsGroup is the summary of the sessions sharing one group key.
+// Sessions without the grouped metadata key fall into the "" group.
+type StatisticsGroup struct {
+	Key string `json:"key"`
+	SessionSummary
+}
+
+// Statistics is the response of the session statistics endpoints
+type Statistics struct {
+	SessionSummary
+	DailyDistribution []DailyStat        `json:"daily_distribution"`
+	GroupBy           string             `json:"group_by,omitempty"`
+	Groups            []*StatisticsGroup `json:"groups,omitempty"`
+}
+
+// timedSession selects the sessions whose durations are summarised
+const timedSession = "status = 'completed' AND duration IS NOT NULL"
+
+// percentileLevels are the percentiles reported in DurationPercentiles
+var percentileLevels = []float64{0.50, 0.75, 0.90, 0.95, 0.99}
+
+// summaryColumns returns the aggregates scanned by SessionSummary.scanDest
+func summaryColumns() string {
+	columns := []string{
+		"COUNT(*)",
+		"SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END)",
+		"SUM(CASE WHEN status = 'running' THEN 1 ELSE 0 END)",
+		"COALESCE(SUM(duration), 0)",
+		"SUM(CASE WHEN " + timedSession + " THEN 1 ELSE 0 END)",
+		"COALESCE(SUM(CASE WHEN " + timedSession + " THEN duration END), 0)",
+		"COALESCE(MAX(CASE WHEN " + timedSession + " THEN duration END), 0)",
+		"COALESCE(MIN(CASE WHEN " + timedSession + " AND duration > 0 THEN duration END), 0)",
+	}
+	for i, from := range durationHistogramEdges {
+		// Negative durations fall into the first bin
+		var bin string
+		switch {
+		case i == 0:
+			bin = fmt.Sprintf("duration < %d", durationHistogramEdges[1])
+		case i+1 == len(durationHistogramEdges):
+			bin = fmt.Sprintf("duration >= %d", from)
+		default:
+			bin = fmt.Sprintf("duration >= %d AND duration < %d", from, durationHistogramEdges[i+1])
+		}
+		columns = append(columns, "SUM(CASE WHEN "+timedSession+" AND "+bin+" THEN 1 ELSE 0 END)")
+	}
+	return strings.Join(columns, ", ")
+}
+
+func newSessionSummary() SessionSummary {
+	s := SessionSummary{Histogram: make([]HistogramBin, len(durationHistogramEdges))}
+	for i, from := range durationHistogramEdges {
+		s.Histogram[i].From = from
+		if i+1 < len(durationHistogramEdges) {
+			to := durationHistogramEdges[i+1]
+			s.Histogram[i].To = &to
+		}
+	}
+	return s
+}
+
+// scanDest returns the scan destinations of summaryColumns
+func (s *SessionSummary) scanDest() []interface{} {
+	dest := []interface{}{
+		&s.TotalSessions, &s.CompletedSessions, &s.RunningSessions, &s.TotalDuration,
+		&s.timedSessions, &s.timedDuration, &s.MaxDuration, &s.MinDuration,
+	}
+	for i := range s.Histogram {
+		dest = append(dest, &s.Histogram[i].Count)
+	}
+	return dest
+}
+
+// merge adds the figures of another summary, before finish
+func (s *SessionSummary) merge(o *SessionSummary) {
+	if o.timedSessions > 0 && (s.timedSessions == 0 || o.MaxDuration > s.MaxDuration) {
+		s.MaxDuration = o.MaxDuration
+	}
+	if o.MinDuration > 0 && (s.MinDuration == 0 || o.MinDuration < s.MinDuration) {
+		s.MinDuration = o.MinDuration
+	}
+	s.TotalSessions += o.TotalSessions
+	s.CompletedSessions += o.CompletedSessions
+	s.RunningSessions += o.RunningSessions
+	s.TotalDuration += o.TotalDuration
+	s.timedSessions += o.timedSessions
+	s.timedDuration += o.timedDuration
+	for i := range s.Histogram {
+		s.Histogram[i].Count += o.Histogram[i].Count
+	}
+}
+
+// finish derives the average duration
+func (s *SessionSummary) finish() {
+	if s.timedSessions > 0 {
+		s.AvgDuration = float64(s.timedDuration) / float64(s.timedSessions)
+	}
+}
+
+// percentileStream picks the durations the percentiles interpolate between
+// from n durations read in ascending order
+type percentileStream struct {
+	n      int
+	index  int
+	values map[int]int64
+}
+
+func newPercentileStream(n int) *percentileStream {
+	return &percentileStream{n: n, values: map[int]int64{}}
+}
+
+func (ps *percentileStream) add(duration int64) {
+	for _, p := range percentileLevels {
+		rank := p * float64(ps.n-1)
+		if ps.index == int(math.Floor(rank)) || ps.index == int(math.Ceil(rank)) {
+			ps.values[ps.index] = duration
+		}
+	}
+	ps.index++
+}
+
+// result interpolates linearly between the closest ranks
+func (ps *percentileStream) result() *DurationPercentiles {
+	v := make([]float64, len(percentileLevels))
+	for i, p := range percentileLevels {
+		rank := p * float64(ps.n-1)
+		lo := int(math.Floor(rank))
+		hi := int(math.Ceil(rank))
+		v[i] = float64(ps.values[lo]) + (rank-float64(lo))*float64(ps.values[hi]-ps.values[lo])
+	}
+	return &DurationPercentiles{P50: v[0], P75: v[1], P90: v[2], P95: v[3], P99: v[4]}
+}
+
+// validGroupBy reports whether groupBy is empty or a supported grouping
+func validGroupBy(groupBy string) bool {
+	switch groupBy {
+	case "", GroupByDevice, GroupByDay, GroupByWeek, GroupByMonth, GroupByStatus:
+		return true
+	}
+	return strings.HasPrefix(groupBy, GroupByMetadata) && len(groupBy) > len(GroupByMetadata)
+}
+
+// statisticsGroupExpr returns the SQL expression, and its arguments, that
+// yields the key a session is grouped under. where and args select the
+// summarised sessions, which bound the time zone offsets date keys need.
+func statisticsGroupExpr(groupBy string, loc *time.Location, start, end time.Time, where string, args []interface{}) (string, []interface{}, error) {
+	switch groupBy {
+	case "":
+		return "''", nil, nil
+	case GroupByDevice:
+		return "device_id", nil, nil
+	case GroupByStatus:
+		return "status", nil, nil
+	case GroupByDay, GroupByWeek, GroupByMonth:
+		from, to, err := startTimeBounds(start, end, where, args)
+		if err != nil {
+			return "", nil, err
+		}
+		return localDateExpr(groupBy, loc, from, to)
+	}
+
+	expr, err := metadataExpr(strings.TrimPrefix(groupBy, GroupByMetadata))
+	if err != nil {
+		return "", nil, ErrInvalidGroupBy
+	}
+	// SQLite extracts typed values; group them by their text
+	return "CAST(COALESCE(" + expr + ", '') AS TEXT)", nil, nil
+}
+
+// startTimeBounds returns [start, end), with open sides replaced by the
+// earliest and latest start time of the selected sessions
+func startTimeBounds(start, end time.Time, where string, args []interface{}) (time.Time, time.Time, error) {
+	bound := func(order string) (time.Time, error) {
+		var s DeviceSession
+		query := "SELECT start_time FROM device_sessions" + where + " ORDER BY " + timeExpr("start_time") + " " + order + " LIMIT 1"
+		err := database.DB.Get(&s, query, args...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Now(), nil
+		}
+		return s.StartTime, err
+	}
+
+	var err error
+	if start.IsZero() {
+		if start, err = bound("ASC"); err != nil {
+			return start, end, err
+		}
+	}
+	if end.IsZero() {
+		if end, err = bound("DESC"); err != nil {
+			return start, end, err
+		}
+		end = end.Add(time.Second)
+	}
+	return start, end, nil
+}
+
+// localDateExpr returns the local day, ISO week or month of start_time in
+// loc. SQL has no time zone database, so the UTC offsets loc uses between
+// from and to are looked up here and the key is chosen by start time.
+func localDateExpr(unit string, loc *time.Location, from, to time.Time) (string, []interface{}, error) {
+	offsets, changes := zoneOffsets(loc, from, to)
+	last, err := database.DB.Dialect.LocalDate("start_time", offsets[len(offsets)-1], unit)
+	if err != nil || len(changes) == 0 {
+		return last, nil, err
+	}
+
+	var b strings.Builder
+	var args []interface{}
+	b.WriteString("CASE")
+	for i, change := range changes {
+		key, err := database.DB.Dialect.LocalDate("start_time", offsets[i], unit)
+		if err != nil {
+			return "", nil, err
+		}
+		fmt.Fprintf(&b, " WHEN %s < %s THEN %s", timeExpr("start_time"), timeExpr("?"), key)
+		args = append(args, timeArg(change))
+	}
+	b.WriteString(" ELSE " + last + " END")
+	return b.String(), args, nil
+}
+
+// zoneOffsets returns the UTC offsets in seconds loc uses from from to to,
+// and the instants at which each offset after the first takes effect
+func zoneOffsets(loc *time.Location, from, to time.Time) ([]int, []time.Time) {
+	offsetAt := func(unix int64) int {
+		_, offset := time.Unix(unix, 0).In(loc).Zone()
+		return offset
+	}
+
+	offsets := []int{offsetAt(from.Unix())}
+	var changes []time.Time
+	// Zones change offset at most once a day
+	for t := from.Unix(); t < to.Unix(); t += 86400 {
+		next := min(t+86400, to.Unix())
+		offset := offsetAt(next)
+		if offset == offsets[len(offsets)-1] {
+			continue
+		}
+		lo, hi := t, next
+		for hi-lo > 1 {
+			mid := (lo + hi) / 2
+			if offsetAt(mid) == offset {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		offsets = append(offsets, offset)
+		changes = append(changes, time.Unix(hi, 0))
+	}
+	return offsets, changes
+}
+
+// durationPercentiles streams completed session durations in order of group
+// key and duration, keeping only the ones each group's percentiles
+// interpolate between
+func durationPercentiles(keyExpr string, keyArgs []interface{}, where string, args []interface{}) (map[string]*DurationPercentiles, error) {
+	query := "SELECT " + keyExpr + " AS group_key, duration, COUNT(*) OVER (PARTITION BY " + keyExpr + ")" +
+		" FROM device_sessions" + where + " AND " + timedSession + " ORDER BY 1, 2"
+	queryArgs := append(append(append([]interface{}{}, keyArgs...), keyArgs...), args...)
+
+	rows, err := database.DB.Queryx(query, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]*DurationPercentiles{}
+	var key string
+	var stream *percentileStream
+	for rows.Next() {
+		var k string
+		var duration int64
+		var n int
+		if err := rows.Scan(&k, &duration, &n); err != nil {
+			return nil, err
+		}
+		if stream == nil || k != key {
+			if stream != nil {
+				result[key] = stream.result()
+			}
+			key, stream = k, newPercentileStream(n)
+		}
+		stream.add(duration)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if stream != nil {
+		result[key] = stream.result()
+	}
+	return result, nil
+}
+
+// GetStatistics summarises sessions started within the query's date range.
+// The figures are aggregated by the database in one grouped query; only
+// percentiles read individual durations. The daily distribution streams
+// every session running within the range, including sessions that started
+// before it.
+func GetStatistics(q StatisticsQuery) (*Statistics, error) {
+	if !validGroupBy(q.GroupBy) {
+		return nil, ErrInvalidGroupBy
+	}
+
+	loc := q.Location
+	if loc == nil {
+		loc = config.SiteLocation()
+	}
+
+	start, end, err := parseDateRange(q.StartDate, q.EndDate, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	where := " WHERE tenant_id = ? AND deleted_at IS NULL"
+	args := []interface{}{q.TenantID}
+	if q.DeviceID != "" {
+		where += " AND device_id = ?"
+		args = append(args, q.DeviceID)
+	}
+	where, args, err = dateFilter(where, args, q.StartDate, q.EndDate, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	keyExpr, keyArgs, err := statisticsGroupExpr(q.GroupBy, loc, start, end, where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Queryx("SELECT "+keyExpr+" AS group_key, "+summaryColumns()+
+		" FROM device_sessions"+where+" GROUP BY 1", append(append([]interface{}{}, keyArgs...), args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &Statistics{SessionSummary: newSessionSummary(), GroupBy: q.GroupBy}
+	for rows.Next() {
+		group := &StatisticsGroup{SessionSummary: newSessionSummary()}
+		if err := rows.Scan(append([]interface{}{&group.Key}, group.scanDest()...)...); err != nil {
+			return nil, err
+		}
+		stats.merge(&group.SessionSummary)
+		group.finish()
+		stats.Groups = append(stats.Groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	stats.finish()
+
+	if q.GroupBy == "" {
+		stats.Groups = nil
+	}
+	sort.Slice(stats.Groups, func(i, j int) bool {
+		return stats.Groups[i].Key < stats.Groups[j].Key
+	})
+
+	if q.Percentiles && stats.timedSessions > 0 {
+		overall, err := durationPercentiles("''", nil, where, args)
+		if err != nil {
+			return nil, err
+		}
+		stats.Percentiles = overall[""]
+
+		if q.GroupBy != "" {
+			groups, err := durationPercentiles(keyExpr, keyArgs, where, args)
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range stats.Groups {
+				group.Percentiles = groups[group.Key]
+			}
+		}
+	}
+
+	acc := newRuntimeAccumulator(start, end, time.Now(), loc, BucketDay)
+	err = Sessions.EachOverlapping(q.TenantID, q.DeviceID, start, end, func(s *DeviceSession) error {
+		acc.add(s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.DailyDistribution = []DailyStat{}
+	for _, b := range acc.result() {
+		stats.DailyDistribution = append(stats.DailyDistribution, DailyStat{
+			Date:          b.Bucket,
+			Count:         b.Count,
+			TotalDuration: b.Runtime,
+		})
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatistics(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forEachBackend(t, func(t *testing.T) {
+		t.Run("summary", func(t *testing.T) {
+			tenantID := testTenant()
+			addSession(t, tenantID, "dev", testBase, 30*time.Second)
+			addSession(t, tenantID, "dev", testBase.Add(time.Hour), 2*time.Minute)
+			addSession(t, tenantID, "dev", testBase.Add(2*time.Hour), time.Millisecond) // ends with a zero duration
+			addSession(t, tenantID, "dev", testBase.Add(3*time.Hour), 0)
+
+			stats, err := GetStatistics(StatisticsQuery{TenantID: tenantID, Location: time.UTC})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.TotalSessions != 4 || stats.CompletedSessions != 3 || stats.RunningSessions != 1 ||
+				stats.TotalDuration != 150 || !approxEqual(stats.AvgDuration, 50) ||
+				stats.MinDuration != 30 || stats.MaxDuration != 120 {
+				t.Fatalf("summary = %+v", stats.SessionSummary)
+			}
+			if stats.Histogram[0].Count != 2 || stats.Histogram[1].Count != 1 {
+				t.Fatalf("histogram = %+v", stats.Histogram)
+			}
+			if stats.Percentiles != nil || stats.Groups != nil {
+				t.Fatalf("percentiles %v and groups %v not requested", stats.Percentiles, stats.Groups)
+			}
+
+			stats, err = GetStatistics(StatisticsQuery{TenantID: tenantID, Location: time.UTC, Percentiles: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := stats.Percentiles
+			if p == nil || !approxEqual(p.P50, 30) || !approxEqual(p.P90, 102) {
+				t.Fatalf("percentiles = %+v, want p50 30 and p90 102", p)
+			}
+		})
+
+		t.Run("groups by local day across a DST change", func(t *testing.T) {
+			tenantID := testTenant()
+			// New York moves to daylight saving time on 2026-03-08
+			for _, start := range []string{
+				"2026-03-08T04:30:00Z", // 7 March, 23:30 EST
+				"2026-03-08T05:30:00Z", // 8 March, 00:30 EST
+				"2026-03-09T03:30:00Z", // 8 March, 23:30 EDT
+				"2026-03-09T04:30:00Z", // 9 March, 00:30 EDT
+			} {
+				at, _ := time.Parse(time.RFC3339, start)
+				addSession(t, tenantID, "dev", at, time.Minute)
+			}
+
+			stats, err := GetStatistics(StatisticsQuery{TenantID: tenantID, Location: newYork, GroupBy: GroupByDay, Percentiles: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]int{}
+			for _, g := range stats.Groups {
+				got[g.Key] = g.TotalSessions
+				if g.Percentiles == nil || !approxEqual(g.Percentiles.P50, 60) {
+					t.Fatalf("group %s percentiles = %+v", g.Key, g.Percentiles)
+				}
+			}
+			if want := map[string]int{"2026-03-07": 1, "2026-03-08": 2, "2026-03-09": 1}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("day groups = %v, want %v", got, want)
+			}
+
+			stats, err = GetStatistics(StatisticsQuery{TenantID: tenantID, Location: newYork, GroupBy: GroupByWeek,
+				StartDate: "2026-03-08", EndDate: "2026-03-09"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stats.Groups) != 2 || stats.Groups[0].Key != "2026-W10" || stats.Groups[0].TotalSessions != 2 ||
+				stats.Groups[1].Key != "2026-W11" || stats.Groups[1].TotalSessions != 1 {
+				t.Fatalf("week groups = %+v", stats.Groups)
+			}
+		})
+
+		t.Run("groups by metadata value", func(t *testing.T) {
+			tenantID := testTenant()
+			for _, metadata := range []map[string]interface{}{
+				{"line": 2}, {"line": "2"}, {"line": "a"}, nil,
+			} {
+				s, err := CreateSession(tenantID, "dev", testBase, metadata)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := EndSession(tenantID, s.SessionID, testBase.Add(time.Minute), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats, err := GetStatistics(StatisticsQuery{TenantID: tenantID, GroupBy: "metadata.line"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]int{}
+			for _, g := range stats.Groups {
+				got[g.Key] = g.TotalSessions
+			}
+			if want := map[string]int{"": 1, "2": 2, "a": 1}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("metadata groups = %v, want %v", got, want)
+			}
+
+			if _, err := GetStatistics(StatisticsQuery{TenantID: tenantID, GroupBy: "metadata.a'b"}); err != ErrInvalidGroupBy {
+				t.Fatalf("invalid metadata key: got %v, want ErrInvalidGroupBy", err)
+			}
+		})
+
+		t.Run("daily distribution splits runtime at midnight", func(t *testing.T) {
+			tenantID := testTenant()
+			addSession(t, tenantID, "dev", time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC), 2*time.Hour)
+
+			stats, err := GetStatistics(StatisticsQuery{TenantID: tenantID, Location: time.UTC,
+				StartDate: "2026-03-02", EndDate: "2026-03-03"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []DailyStat{
+				{Date: "2026-03-02", Count: 1, TotalDuration: 3600},
+				{Date: "2026-03-03", Count: 0, TotalDuration: 3600},
+			}
+			if !reflect.DeepEqual(stats.DailyDistribution, want) {
+				t.Fatalf("daily distribution = %+v, want %+v", stats.DailyDistribution, want)
+			}
+		})
+	})
+}
@@ -0,0 +1,308 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"device-monitor-go/database"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTenantID is the tenant that owns data recorded before tenants
+// existed. It uses the IOT_* and REPORT_WEBHOOK_URL settings and is the
+// only tenant allowed to administer the instance.
+const DefaultTenantID = "default"
+
+// Tenant secrets; each is stored as its SHA-256 hash and shown only once
+const (
+	TenantAPIKey        = "api_key"
+	TenantWebhookSecret = "webhook_secret"
+)
+
+var tenantSecretColumns = map[string]string{
+	TenantAPIKey:        "api_key_hash",
+	TenantWebhookSecret: "webhook_secret_hash",
+}
+
+var (
+	// ErrInvalidTenant is returned when a tenant fails validation
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// ErrTenantExists is returned when a tenant ID is already taken
+	ErrTenantExists = errors.New("tenant already exists")
+	// ErrTenantInUse is returned when deleting a tenant that still owns sessions
+	ErrTenantInUse = errors.New("tenant still owns sessions")
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// Tenant is a customer whose devices, sessions and reports are isolated
+// from other tenants. Empty IoT settings fall back to the IOT_* settings
+// for the default tenant only; other tenants must configure their own.
+type Tenant struct {
+	ID                string         `db:"id" json:"id"`
+	Name              string         `db:"name" json:"name"`
+	APIKeyHash        sql.NullString `db:"api_key_hash" json:"-"`
+	WebhookSecretHash sql.NullString `db:"webhook_secret_hash" json:"-"`
+	IotAPIBaseURL     string         `db:"iot_api_base_url" json:"iot_api_base_url"`
+	IotAppKey         string         `db:"iot_app_key" json:"iot_app_key"`
+	IotAppSecret      string         `db:"iot_app_secret" json:"-"`
+	IotDeviceCode     string         `db:"iot_device_code" json:"iot_device_code"`
+	ReportWebhookURL  string         `db:"report_webhook_url" json:"report_webhook_url"`
+	CreatedAt         time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time      `db:"updated_at" json:"updated_at"`
+	HasAPIKey         bool           `db:"-" json:"has_api_key"`
+	HasWebhookSecret  bool           `db:"-" json:"has_webhook_secret"`
+	HasIotAppSecret   bool           `db:"-" json:"has_iot_app_secret"`
+}
+
+// IsDefault reports whether this is the default tenant
+func (t *Tenant) IsDefault() bool {
+	return t.ID == DefaultTenantID
+}
+
+// AfterFind fills in which secrets are set without exposing them
+func (t *Tenant) AfterFind() {
+	t.HasAPIKey = t.APIKeyHash.Valid
+	t.HasWebhookSecret = t.WebhookSecretHash.Valid
+	t.HasIotAppSecret = t.IotAppSecret != ""
+}
+
+// validate normalizes a tenant's fields and checks they are usable
+func (t *Tenant) validate() error {
+	t.ID = strings.TrimSpace(t.ID)
+	if !tenantIDPattern.MatchString(t.ID) {
+		return fmt.Errorf("%w: id must be 1-50 lowercase letters, digits, '-' or '_'", ErrInvalidTenant)
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if len(t.Name) > 100 {
+		return fmt.Errorf("%w: name must be at most 100 characters", ErrInvalidTenant)
+	}
+	if t.IsDefault() && t.IotAPIBaseURL+t.IotAppKey+t.IotAppSecret+t.IotDeviceCode+t.ReportWebhookURL != "" {
+		return fmt.Errorf("%w: the default tenant uses the IOT_* and REPORT_WEBHOOK_URL settings", ErrInvalidTenant)
+	}
+	for field, value := range map[string]string{"iot_api_base_url": t.IotAPIBaseURL, "report_webhook_url": t.ReportWebhookURL} {
+		if value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return fmt.Errorf("%w: %s must be an http or https URL", ErrInvalidTenant, field)
+		}
+	}
+	return nil
+}
+
+// hashTenantSecret returns the stored form of an API key or webhook secret
+func hashTenantSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetTenants lists all tenants
+func GetTenants() ([]*Tenant, error) {
+	tenants := []*Tenant{}
+	if err := database.DB.Select(&tenants, `SELECT * FROM tenants ORDER BY id`); err != nil {
+		return nil, err
+	}
+	for _, t := range tenants {
+		t.AfterFind()
+	}
+	return tenants, nil
+}
+
+// GetTenantByID retrieves a tenant; sql.ErrNoRows means it does not exist
+func GetTenantByID(id string) (*Tenant, error) {
+	return findTenant(`SELECT * FROM tenants WHERE id = ?`, id)
+}
+
+// FindTenantBySecret returns the tenant holding an API key or webhook
+// secret; sql.ErrNoRows means no tenant holds it
+func FindTenantBySecret(kind, secret string) (*Tenant, error) {
+	column, ok := tenantSecretColumns[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant secret %q", kind)
+	}
+	return findTenant(`SELECT * FROM tenants WHERE `+column+` = ?`, hashTenantSecret(secret))
+}
+
+func findTenant(query string, args ...interface{}) (*Tenant, error) {
+	tenant := &Tenant{}
+	if err := database.DB.Get(tenant, query, args...); err != nil {
+		return nil, err
+	}
+	tenant.AfterFind()
+	return tenant, nil
+}
+
+// CreateTenant adds a tenant without any API key or webhook secret.
+// Keyless requests act as the default tenant, which administers the
+// instance, so other tenants are only isolated once it has an API key: if
+// it has none, one is issued in the same transaction and returned.
+func CreateTenant(t *Tenant) (defaultAPIKey string, err error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+
+	err = database.WithTx(func(tx *database.Tx) error {
+		query := `
+			INSERT INTO tenants (id, name, iot_api_base_url, iot_app_key, iot_app_secret, iot_device_code, report_webhook_url)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`
+		_, err := tx.Exec(query, t.ID, t.Name, t.IotAPIBaseURL, t.IotAppKey, t.IotAppSecret,
+			t.IotDeviceCode, t.ReportWebhookURL)
+		if err != nil {
+			if tx.Dialect.IsUniqueViolation(err) {
+				return fmt.Errorf("%w: %s", ErrTenantExists, t.ID)
+			}
+			return err
+		}
+
+		defaultAPIKey, err = ensureDefaultAPIKeyTx(tx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	t.AfterFind()
+	return defaultAPIKey, nil
+}
+
+// UpdateTenant saves a tenant's name, IoT credentials and report webhook
+func UpdateTenant(t *Tenant) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE tenants
+		SET name = ?, iot_api_base_url = ?, iot_app_key = ?, iot_app_secret = ?, iot_device_code = ?,
+			report_webhook_url = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	result, err := database.DB.Exec(query, t.Name, t.IotAPIBaseURL, t.IotAppKey, t.IotAppSecret,
+		t.IotDeviceCode, t.ReportWebhookURL, t.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	t.UpdatedAt = time.Now()
+	t.AfterFind()
+	return nil
+}
+
+// DeleteTenant removes a tenant that no longer owns any sessions, including
+// sessions in the trash. The default tenant cannot be deleted.
+func DeleteTenant(id string) error {
+	if id == DefaultTenantID {
+		return fmt.Errorf("%w: the default tenant cannot be deleted", ErrInvalidTenant)
+	}
+
+	return database.WithTx(func(tx *database.Tx) error {
+		var sessions int
+		if err := tx.Get(&sessions, `SELECT COUNT(*) FROM device_sessions WHERE tenant_id = ?`, id); err != nil {
+			return err
+		}
+		if sessions > 0 {
+			return fmt.Errorf("%w: %d sessions", ErrTenantInUse, sessions)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM report_snapshots WHERE tenant_id = ?`, id); err != nil {
+			return err
+		}
+		result, err := tx.Exec(`DELETE FROM tenants WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// RotateTenantSecret generates a new API key or webhook secret for a
+// tenant, replacing the previous one, and returns it. Only its hash is
+// stored, so it cannot be shown again.
+func RotateTenantSecret(id, kind string) (string, error) {
+	column, ok := tenantSecretColumns[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown tenant secret %q", kind)
+	}
+
+	secret, err := newTenantSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := setTenantSecret(id, column, hashTenantSecret(secret)); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// ensureDefaultAPIKeyTx gives the default tenant an API key if it has none
+// and returns it; it returns "" when the default tenant already has one
+func ensureDefaultAPIKeyTx(tx *database.Tx) (string, error) {
+	secret, err := newTenantSecret()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE tenants SET api_key_hash = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND api_key_hash IS NULL
+	`, hashTenantSecret(secret), DefaultTenantID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return "", nil
+	}
+	return secret, nil
+}
+
+// RevokeTenantSecret removes a tenant's API key or webhook secret. The
+// default tenant keeps its API key while other tenants exist.
+func RevokeTenantSecret(id, kind string) error {
+	column, ok := tenantSecretColumns[kind]
+	if !ok {
+		return fmt.Errorf("unknown tenant secret %q", kind)
+	}
+
+	if id == DefaultTenantID && kind == TenantAPIKey {
+		var others int
+		if err := database.DB.Get(&others, `SELECT COUNT(*) FROM tenants WHERE id <> ?`, DefaultTenantID); err != nil {
+			return err
+		}
+		if others > 0 {
+			return fmt.Errorf("%w: the default tenant needs an API key while other tenants exist", ErrInvalidTenant)
+		}
+	}
+	return setTenantSecret(id, column, nil)
+}
+
+// newTenantSecret generates a random API key or webhook secret
+func newTenantSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "dm_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func setTenantSecret(id, column string, hash interface{}) error {
+	result, err := database.DB.Exec(`UPDATE tenants SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, hash, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"device-monitor-go/database"
+	"fmt"
+	"time"
+)
+
+// liveCondition restricts queries to sessions that are not in the trash
+const liveCondition = " AND deleted_at IS NULL"
+
+// trashSessionTx marks a loaded session as deleted and audits it
+func trashSessionTx(tx *database.Tx, session *DeviceSession, actor, reason string) error {
+	query := `UPDATE device_sessions SET deleted_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := tx.Exec(query, time.Now().UTC(), session.ID); err != nil {
+		return err
+	}
+	return recordAudit(tx, AuditDelete, session.SessionID, actor, reason, session, nil)
+}
+
+// DeleteSessions moves every live session matching the filter to the trash.
+// A filter without any condition is rejected so that a missing query
+// parameter cannot empty the whole table.
+func DeleteSessions(filter SessionFilter, actor, reason string) (int, error) {
+	filter.Deleted = false
+	where, args, err := sessionConditions(filter)
+	if err != nil {
+		return 0, err
+	}
+	unfiltered, _, _ := sessionConditions(SessionFilter{TenantID: filter.TenantID})
+	if where == unfiltered {
+		return 0, fmt.Errorf("%w: bulk delete requires at least one filter", ErrInvalidFilter)
+	}
+
+	deleted := 0
+	err = database.WithTx(func(tx *database.Tx) error {
+		sessions := []*DeviceSession{}
+		if err := tx.Select(&sessions, `SELECT * FROM device_sessions WHERE 1=1`+where, args...); err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			if err := session.AfterFind(); err != nil {
+				return err
+			}
+			if err := trashSessionTx(tx, session, actor, reason); err != nil {
+				return err
+			}
+		}
+		deleted = len(sessions)
+		return nil
+	})
+	return deleted, err
+}
+
+// RestoreSession moves a session out of the trash; sql.ErrNoRows means it
+// is not in the trash
+func RestoreSession(tenantID, sessionID, actor, reason string) (*DeviceSession, error) {
+	var restored *DeviceSession
+
+	err := database.WithTx(func(tx *database.Tx) error {
+		before := &DeviceSession{}
+		query := `SELECT * FROM device_sessions WHERE session_id = ? AND tenant_id = ? AND deleted_at IS NOT NULL`
+		if err := tx.Get(before, query, sessionID, tenantID); err != nil {
+			return err
+		}
+		if err := before.AfterFind(); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`UPDATE device_sessions SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, before.ID)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		after.UpdatedAt = time.Now()
+		restored = &after
+		return recordAudit(tx, AuditRestore, sessionID, actor, reason, before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// PurgeDeletedSessions permanently removes sessions deleted before the given
+// time together with their IoT data, annotations and tags. The audit log
+// keeps their history.
+func PurgeDeletedSessions(before time.Time) (int, error) {
+	purged := 0
+
+	err := database.WithTx(func(tx *database.Tx) error {
+		sessions := []*DeviceSession{}
+		query := `SELECT * FROM device_sessions WHERE deleted_at IS NOT NULL AND ` + timeExpr("deleted_at") + ` < ` + timeExpr("?")
+		if err := tx.Select(&sessions, query, timeArg(before)); err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if err := session.AfterFind(); err != nil {
+				return err
+			}
+			for _, query := range []string{
+				`DELETE FROM iot_data_points WHERE session_id = ?`,
+				`DELETE FROM iot_data_rollups WHERE session_id = ?`,
+				`DELETE FROM session_annotations WHERE session_id = ?`,
+				`DELETE FROM session_tags WHERE session_id = ?`,
+				`DELETE FROM device_sessions WHERE session_id = ?`,
+			} {
+				if _, err := tx.Exec(query, session.SessionID); err != nil {
+					return err
+				}
+			}
+			if err := recordAudit(tx, AuditPurge, session.SessionID, "system", "trash retention expired", session, nil); err != nil {
+				return err
+			}
+		}
+
+		purged = len(sessions)
+		return nil
+	})
+	return purged, err
+}
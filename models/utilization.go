@@ -0,0 +1,357 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShiftWindow is a planned production window in seconds since midnight of the
+// day it starts on; overnight windows end after 24h
+type ShiftWindow struct {
+	Start int
+	End   int
+}
+
+// ShiftCalendar maps each weekday to its planned production windows
+type ShiftCalendar map[time.Weekday][]ShiftWindow
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseShiftCalendar parses a calendar such as
+// "mon-fri=08:00-12:00,13:00-17:00;sat=08:00-12:00".
+// Windows ending before they start (e.g. 22:00-06:00) run past midnight.
+// An empty spec means the device is planned to run around the clock.
+func ParseShiftCalendar(spec string) (ShiftCalendar, error) {
+	calendar := ShiftCalendar{}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			calendar[d] = []ShiftWindow{{Start: 0, End: 24 * 3600}}
+		}
+		return calendar, nil
+	}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid shift entry %q", entry)
+		}
+
+		days, err := parseWeekdays(parts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, window := range strings.Split(parts[1], ",") {
+			bounds := strings.SplitN(strings.TrimSpace(window), "-", 2)
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("invalid shift window %q", window)
+			}
+			start, err := parseClock(bounds[0])
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseClock(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+
+			for _, d := range days {
+				if end <= start {
+					// Overnight shift: it belongs to the day it starts on
+					end += 24 * 3600
+				}
+				calendar[d] = append(calendar[d], ShiftWindow{Start: start, End: end})
+			}
+		}
+	}
+
+	return calendar, nil
+}
+
+// parseWeekdays parses "mon", "mon,wed" or "mon-fri"
+func parseWeekdays(spec string) ([]time.Weekday, error) {
+	days := []time.Weekday{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if bounds := strings.SplitN(part, "-", 2); len(bounds) == 2 {
+			from, ok1 := weekdayNames[bounds[0]]
+			to, ok2 := weekdayNames[bounds[1]]
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("invalid weekday range %q", part)
+			}
+			for d := from; ; d = (d + 1) % 7 {
+				days = append(days, d)
+				if d == to {
+					break
+				}
+			}
+			continue
+		}
+
+		d, ok := weekdayNames[part]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", part)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// parseClock parses HH:MM into seconds since midnight; 24:00 is allowed
+func parseClock(s string) (int, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*3600 + m*60, nil
+}
+
+// plannedIntervals expands the calendar into absolute intervals within
+// [start, end). Windows are placed on the local wall clock, so a shift keeps
+// its hours across daylight saving changes, and overlapping windows are
+// merged so that no time is planned twice.
+func (sc ShiftCalendar) plannedIntervals(start, end time.Time) [][2]time.Time {
+	loc := start.Location()
+	intervals := [][2]time.Time{}
+	// Start a day early to pick up overnight shifts running into the range
+	day := time.Date(start.Year(), start.Month(), start.Day()-1, 0, 0, 0, 0, loc)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		y, m, d := day.Date()
+		for _, w := range sc[day.Weekday()] {
+			ws := time.Date(y, m, d, 0, 0, w.Start, 0, loc)
+			we := time.Date(y, m, d, 0, 0, w.End, 0, loc)
+			if ws.Before(start) {
+				ws = start
+			}
+			if we.After(end) {
+				we = end
+			}
+			if we.After(ws) {
+				intervals = append(intervals, [2]time.Time{ws, we})
+			}
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i][0].Before(intervals[j][0])
+	})
+
+	merged := [][2]time.Time{}
+	for _, iv := range intervals {
+		if n := len(merged); n > 0 && !iv[0].After(merged[n-1][1]) {
+			if iv[1].After(merged[n-1][1]) {
+				merged[n-1][1] = iv[1]
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// UtilizationStats holds availability figures for one device over a date range
+type UtilizationStats struct {
+	DeviceID string `json:"device_id"`
+
+	CalendarSeconds int64   `json:"calendar_seconds"`
+	PlannedSeconds  int64   `json:"planned_seconds"`
+	RunningSeconds  int64   `json:"running_seconds"`
+	InShiftSeconds  int64   `json:"in_shift_seconds"`
+	OffShiftSeconds int64   `json:"off_shift_seconds"`
+	SessionCount    int     `json:"session_count"`
+	Availability    float64 `json:"availability"`
+	Utilization     float64 `json:"utilization"`
+
+	IdleGapCount   int     `json:"idle_gap_count"`
+	IdleGapSeconds int64   `json:"idle_gap_seconds"`
+	AvgIdleGap     float64 `json:"avg_idle_gap"`
+	MaxIdleGap     int64   `json:"max_idle_gap"`
+
+	Failures int      `json:"failures"`
+	MTBF     *float64 `json:"mtbf"`
+	MTTR     *float64 `json:"mttr"`
+}
+
+// IsAbnormalEnd reports whether a session's metadata marks it as ended by a
+// fault: either "abnormal": true or an "end_reason" other than "normal"
+func (s *DeviceSession) IsAbnormalEnd() bool {
+	if s.MetadataObj == nil {
+		return false
+	}
+	if v, ok := s.MetadataObj["abnormal"].(bool); ok && v {
+		return true
+	}
+	if v, ok := s.MetadataObj["end_reason"].(string); ok && v != "" && v != "normal" {
+		return true
+	}
+	return false
+}
+
+// GetUtilization computes availability metrics per device for sessions
+// overlapping [start, end). An empty deviceID returns every known device of
+// the tenant, including those that did not run within the range.
+func GetUtilization(tenantID, deviceID string, start, end time.Time, calendar ShiftCalendar) ([]*UtilizationStats, error) {
+	sessions, err := getOverlappingSessions(tenantID, deviceID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	byDevice := map[string][]*DeviceSession{}
+	for _, s := range sessions {
+		byDevice[s.DeviceID] = append(byDevice[s.DeviceID], s)
+	}
+	if deviceID != "" {
+		if len(byDevice) == 0 {
+			byDevice[deviceID] = nil
+		}
+	} else {
+		// Idle devices have no overlapping sessions but still count, with
+		// zero runtime
+		known, err := Devices.LastEnded(tenantID)
+		if err != nil {
+			return nil, err
+		}
+		for d := range known {
+			if _, ok := byDevice[d]; !ok {
+				byDevice[d] = nil
+			}
+		}
+	}
+
+	devices := make([]string, 0, len(byDevice))
+	for d := range byDevice {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+
+	planned := calendar.plannedIntervals(start, end)
+	now := time.Now()
+
+	result := []*UtilizationStats{}
+	for _, d := range devices {
+		result = append(result, computeUtilization(d, byDevice[d], start, end, now, planned))
+	}
+	return result, nil
+}
+
+func computeUtilization(deviceID string, sessions []*DeviceSession, start, end, now time.Time, planned [][2]time.Time) *UtilizationStats {
+	stats := &UtilizationStats{
+		DeviceID:        deviceID,
+		CalendarSeconds: int64(end.Sub(start).Seconds()),
+	}
+	for _, p := range planned {
+		stats.PlannedSeconds += int64(p[1].Sub(p[0]).Seconds())
+	}
+
+	var repairTotal float64
+	repairs := 0
+	var prevEnd *time.Time
+	var prevAbnormal bool
+
+	for _, s := range sessions {
+		sStart := s.StartTime
+		sEnd := now
+		if s.EndTime != nil {
+			sEnd = *s.EndTime
+		}
+
+		// Clip to the requested range
+		cs, ce := sStart, sEnd
+		if cs.Before(start) {
+			cs = start
+		}
+		if ce.After(end) {
+			ce = end
+		}
+		if ce.After(cs) {
+			stats.SessionCount++
+			stats.RunningSeconds += int64(ce.Sub(cs).Seconds())
+			for _, p := range planned {
+				ovStart, ovEnd := cs, ce
+				if p[0].After(ovStart) {
+					ovStart = p[0]
+				}
+				if p[1].Before(ovEnd) {
+					ovEnd = p[1]
+				}
+				if ovEnd.After(ovStart) {
+					stats.InShiftSeconds += int64(ovEnd.Sub(ovStart).Seconds())
+				}
+			}
+		}
+
+		// Idle gap since the previous session, counted within the range
+		if prevEnd != nil && sStart.After(*prevEnd) {
+			gs, ge := *prevEnd, sStart
+			if gs.Before(start) {
+				gs = start
+			}
+			if ge.After(end) {
+				ge = end
+			}
+			if ge.After(gs) {
+				gap := int64(ge.Sub(gs).Seconds())
+				stats.IdleGapCount++
+				stats.IdleGapSeconds += gap
+				if gap > stats.MaxIdleGap {
+					stats.MaxIdleGap = gap
+				}
+			}
+
+			// Time from a fault to the next start counts as repair time
+			if prevAbnormal {
+				repairTotal += sStart.Sub(*prevEnd).Seconds()
+				repairs++
+			}
+		}
+
+		if s.EndTime != nil && !s.EndTime.Before(start) && s.EndTime.Before(end) && s.IsAbnormalEnd() {
+			stats.Failures++
+		}
+
+		if s.EndTime != nil {
+			prevEnd = s.EndTime
+			prevAbnormal = s.IsAbnormalEnd()
+		} else {
+			prevEnd = nil
+			prevAbnormal = false
+		}
+	}
+
+	stats.OffShiftSeconds = stats.RunningSeconds - stats.InShiftSeconds
+	if stats.PlannedSeconds > 0 {
+		stats.Availability = float64(stats.InShiftSeconds) / float64(stats.PlannedSeconds)
+	}
+	if stats.CalendarSeconds > 0 {
+		stats.Utilization = float64(stats.RunningSeconds) / float64(stats.CalendarSeconds)
+	}
+	if stats.IdleGapCount > 0 {
+		stats.AvgIdleGap = float64(stats.IdleGapSeconds) / float64(stats.IdleGapCount)
+	}
+	if stats.Failures > 0 {
+		mtbf := float64(stats.RunningSeconds) / float64(stats.Failures)
+		stats.MTBF = &mtbf
+	}
+	if repairs > 0 {
+		mttr := repairTotal / float64(repairs)
+		stats.MTTR = &mttr
+	}
+
+	return stats
+}
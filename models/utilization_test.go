@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlannedIntervals(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("keeps wall clock hours across a DST change", func(t *testing.T) {
+		calendar, err := ParseShiftCalendar("mon-sun=08:00-17:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// New York moves to daylight saving time on Sunday 2026-03-08
+		start := time.Date(2026, 3, 7, 0, 0, 0, 0, newYork)
+		intervals := calendar.plannedIntervals(start, start.AddDate(0, 0, 2))
+		if len(intervals) != 2 {
+			t.Fatalf("intervals = %v, want two shifts", intervals)
+		}
+		for _, iv := range intervals {
+			if iv[0].Hour() != 8 || iv[1].Hour() != 17 || iv[1].Sub(iv[0]) != 9*time.Hour {
+				t.Fatalf("shift %v - %v, want 08:00 - 17:00 local", iv[0], iv[1])
+			}
+		}
+	})
+
+	t.Run("merges overlapping windows", func(t *testing.T) {
+		calendar, err := ParseShiftCalendar("mon=08:00-12:00,10:00-14:00;sun=22:00-09:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC) // a Monday
+		intervals := calendar.plannedIntervals(start, start.AddDate(0, 0, 1))
+		if len(intervals) != 1 || !intervals[0][0].Equal(start) || !intervals[0][1].Equal(start.Add(14*time.Hour)) {
+			t.Fatalf("intervals = %v, want one from midnight to 14:00", intervals)
+		}
+	})
+}
+
+func TestUtilizationIncludesIdleDevices(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tenantID := testTenant()
+		addSession(t, tenantID, "idle", testBase.Add(-48*time.Hour), time.Hour)
+		addSession(t, tenantID, "busy", testBase, 2*time.Hour)
+
+		calendar, err := ParseShiftCalendar("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats, err := GetUtilization(tenantID, "", testBase, testBase.Add(24*time.Hour), calendar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != 2 || stats[0].DeviceID != "busy" || stats[1].DeviceID != "idle" {
+			t.Fatalf("utilization devices = %+v, want busy and idle", stats)
+		}
+		if stats[0].RunningSeconds != 7200 || stats[1].RunningSeconds != 0 || stats[1].PlannedSeconds != 24*3600 {
+			t.Fatalf("utilization = %+v, %+v", stats[0], stats[1])
+		}
+	})
+}
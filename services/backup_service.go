@@ -0,0 +1,66 @@
+package services
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/database"
+	"fmt"
+	"log"
+
+	"github.com/robfig/cron/v3"
+)
+
+var backupCron *cron.Cron
+
+// StartBackupScheduler schedules SQLite backups with rotation
+func StartBackupScheduler() error {
+	cfg := config.Current()
+	spec := cfg.BackupCron
+	// An empty variable falls back to the default schedule, so "off" disables
+	if spec == "" || spec == "off" || database.DB.Dialect.Name() != "sqlite" {
+		log.Println("Scheduled backups disabled")
+		return nil
+	}
+
+	c := cron.New(cron.WithLocation(config.SiteLocation()))
+	if _, err := c.AddFunc(spec, func() {
+		cfg := config.Current()
+		if _, err := RunBackup(cfg.BackupDir, cfg.BackupCompress); err != nil {
+			log.Printf("Scheduled backup failed: %v", err)
+		}
+	}); err != nil {
+		return fmt.Errorf("invalid backup schedule %q: %w", spec, err)
+	}
+	log.Printf("Scheduled backups at %q to %s, keeping %d", spec, cfg.BackupDir, cfg.BackupKeep)
+
+	c.Start()
+	backupCron = c
+	return nil
+}
+
+// StopBackupScheduler stops the backup schedule and waits for a running backup
+func StopBackupScheduler() {
+	if backupCron != nil {
+		<-backupCron.Stop().Done()
+		backupCron = nil
+	}
+}
+
+// RunBackup backs up the database into dir and then deletes the oldest
+// backups beyond the configured number to keep
+func RunBackup(dir string, compress bool) (*database.BackupInfo, error) {
+	backup, err := database.Backup(dir, compress)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Backed up database to %s (%d bytes)", backup.Path, backup.Size)
+
+	pruned, err := database.PruneBackups(dir, config.Current().BackupKeep)
+	if err != nil {
+		// The new backup is fine; rotation retries next time
+		log.Printf("Failed to rotate backups: %v", err)
+	}
+	for _, b := range pruned {
+		log.Printf("Removed old backup %s", b.Name)
+	}
+	return backup, nil
+}
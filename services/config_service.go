@@ -0,0 +1,83 @@
+package services
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/models"
+	"fmt"
+	"log"
+	"sync"
+)
+
+var reloadMutex sync.Mutex
+
+// ValidateConfig checks the settings parsed by the models, which the
+// config package cannot validate itself
+func ValidateConfig(c *config.Config) error {
+	if _, err := models.ParseShiftCalendar(c.ShiftCalendar); err != nil {
+		return fmt.Errorf("server.shift_calendar (SHIFT_CALENDAR): %w", err)
+	}
+	if _, err := models.ParseRetentionPolicies(c.TelemetryRetention, c.TelemetryRetentionPoints); err != nil {
+		return fmt.Errorf("retention.telemetry (TELEMETRY_RETENTION): %w", err)
+	}
+	if _, err := iotTLSConfig(c); err != nil {
+		return fmt.Errorf("iot.tls (IOT_TLS_*): %w", err)
+	}
+	return nil
+}
+
+// ReloadConfig re-reads the configuration, installs the settings that can
+// change at runtime and restarts the background jobs whose settings changed
+func ReloadConfig() (*config.ReloadResult, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	previous := config.Current()
+	result, err := config.Reload(ValidateConfig)
+	if err != nil {
+		return nil, err
+	}
+	current := config.Current()
+
+	for _, name := range result.Changed {
+		log.Printf("Configuration reloaded: %s changed", name)
+	}
+	for _, name := range result.Ignored {
+		log.Printf("Configuration reloaded: %s changed but needs a restart to take effect", name)
+	}
+
+	if previous.IotApiBaseURL != current.IotApiBaseURL || previous.IotAppKey != current.IotAppKey ||
+		previous.IotAppSecret != current.IotAppSecret {
+		GetIotService().resetToken()
+	}
+
+	restarts := []struct {
+		changed bool
+		stop    func()
+		start   func() error
+	}{
+		{previous.ReportDailyCron != current.ReportDailyCron || previous.ReportWeeklyCron != current.ReportWeeklyCron,
+			StopReportScheduler, StartReportScheduler},
+		{previous.TrashPurgeCron != current.TrashPurgeCron || previous.TrashRetentionDays != current.TrashRetentionDays,
+			StopTrashPurge, StartTrashPurge},
+		{previous.BackupCron != current.BackupCron,
+			StopBackupScheduler, StartBackupScheduler},
+		{previous.TelemetryCompactCron != current.TelemetryCompactCron ||
+			previous.TelemetryRetention != current.TelemetryRetention ||
+			previous.TelemetryRetentionPoints != current.TelemetryRetentionPoints,
+			StopTelemetryCompaction, StartTelemetryCompaction},
+		{previous.FleetRefreshSeconds != current.FleetRefreshSeconds,
+			StopFleetMonitor, func() error { StartFleetMonitor(); return nil }},
+	}
+	for _, r := range restarts {
+		if !r.changed {
+			continue
+		}
+		r.stop()
+		if err := r.start(); err != nil {
+			// Settings were validated, so this is unexpected; the job stays off
+			log.Printf("Failed to restart job after reload: %v", err)
+		}
+	}
+
+	return result, nil
+}
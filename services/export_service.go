@@ -0,0 +1,307 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported export formats
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatXLSX    = "xlsx"
+	ExportFormatParquet = "parquet"
+)
+
+// ExportColumnKind describes the value type of an export column
+type ExportColumnKind int
+
+const (
+	ExportString ExportColumnKind = iota
+	ExportNumber
+)
+
+// ExportColumn describes a single column in an exported table
+type ExportColumn struct {
+	Name string
+	Kind ExportColumnKind
+}
+
+// TableWriter writes tabular export data row by row
+type TableWriter interface {
+	// WriteHeader must be called once before any rows are written
+	WriteHeader(columns []ExportColumn) error
+	// WriteRow writes one row; nil values are written as empty cells
+	WriteRow(values []interface{}) error
+	// Close flushes any buffered data to the underlying writer
+	Close() error
+}
+
+// NewTableWriter creates a TableWriter for the given format
+func NewTableWriter(format string, w io.Writer) (TableWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		return &csvTableWriter{w: csv.NewWriter(w)}, nil
+	case ExportFormatXLSX:
+		return &xlsxTableWriter{out: w}, nil
+	case ExportFormatParquet:
+		return &parquetTableWriter{out: w}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+// ExportContentType returns the MIME type for an export format
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv; charset=utf-8"
+	case ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ExportFormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// formatExportValue renders a cell value as text
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// csvTableWriter streams rows as CSV, flushing every few rows
+type csvTableWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func (t *csvTableWriter) WriteHeader(columns []ExportColumn) error {
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name
+	}
+	return t.w.Write(header)
+}
+
+func (t *csvTableWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatExportValue(v)
+	}
+	if err := t.w.Write(record); err != nil {
+		return err
+	}
+
+	t.rows++
+	if t.rows%500 == 0 {
+		t.w.Flush()
+		return t.w.Error()
+	}
+	return nil
+}
+
+func (t *csvTableWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// The fixed parts of a single-sheet workbook; xlsxTableWriter streams the
+// sheet itself
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// xlsxTableWriter writes the workbook zip straight to the output, one sheet
+// row at a time, so neither rows nor the finished file are held in memory
+type xlsxTableWriter struct {
+	out   io.Writer
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+func (t *xlsxTableWriter) WriteHeader(columns []ExportColumn) error {
+	t.zip = zip.NewWriter(t.out)
+	for _, part := range xlsxParts {
+		w, err := t.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.body); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := t.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	t.sheet = sheet
+	if _, err := io.WriteString(t.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name
+	}
+	return t.WriteRow(header)
+}
+
+func (t *xlsxTableWriter) WriteRow(values []interface{}) error {
+	t.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, t.row)
+	for i, v := range values {
+		ref := xlsxColumnName(i+1) + strconv.Itoa(t.row)
+		switch n := v.(type) {
+		case nil:
+			continue
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(n, 'f', -1, 64))
+		case int, int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, n)
+		case bool:
+			value := 0
+			if n {
+				value = 1
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, value)
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&b, []byte(formatExportValue(v))); err != nil {
+				return err
+			}
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(t.sheet, b.String())
+	return err
+}
+
+func (t *xlsxTableWriter) Close() error {
+	if t.zip == nil {
+		return nil
+	}
+	if _, err := io.WriteString(t.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return t.zip.Close()
+}
+
+// xlsxColumnName returns the letters of a 1-based column number
+func xlsxColumnName(col int) string {
+	name := ""
+	for ; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// parquetTableWriter writes rows with a schema built from the export columns;
+// rows are flushed to the output one row group at a time
+type parquetTableWriter struct {
+	out     io.Writer
+	writer  *parquet.Writer
+	columns []ExportColumn
+	index   []int
+}
+
+const parquetRowGroupSize = 10000
+
+func (t *parquetTableWriter) WriteHeader(columns []ExportColumn) error {
+	group := parquet.Group{}
+	for _, col := range columns {
+		if col.Kind == ExportNumber {
+			group[col.Name] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		} else {
+			group[col.Name] = parquet.Optional(parquet.String())
+		}
+	}
+
+	schema := parquet.NewSchema("export", group)
+	t.columns = columns
+	t.index = make([]int, len(columns))
+	for i, col := range columns {
+		leaf, ok := schema.Lookup(col.Name)
+		if !ok {
+			return fmt.Errorf("column %s missing from parquet schema", col.Name)
+		}
+		t.index[i] = leaf.ColumnIndex
+	}
+
+	t.writer = parquet.NewWriter(t.out, schema, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))
+	return nil
+}
+
+func (t *parquetTableWriter) WriteRow(values []interface{}) error {
+	row := make(parquet.Row, len(t.columns))
+	for i, col := range t.columns {
+		var v interface{}
+		if i < len(values) {
+			v = values[i]
+		}
+
+		if v == nil {
+			row[t.index[i]] = parquet.NullValue().Level(0, 0, t.index[i])
+			continue
+		}
+
+		if col.Kind == ExportNumber {
+			f, ok := v.(float64)
+			if !ok {
+				row[t.index[i]] = parquet.NullValue().Level(0, 0, t.index[i])
+				continue
+			}
+			row[t.index[i]] = parquet.ValueOf(f).Level(0, 1, t.index[i])
+		} else {
+			row[t.index[i]] = parquet.ValueOf(formatExportValue(v)).Level(0, 1, t.index[i])
+		}
+	}
+
+	_, err := t.writer.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func (t *parquetTableWriter) Close() error {
+	if t.writer == nil {
+		return nil
+	}
+	return t.writer.Close()
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Fleet overview tuning
+const (
+	fleetReadingWindow   = 15 * time.Minute // how far back to look for the latest IoT value
+	fleetIotConcurrency  = 4                // devices queried against the IoT platform at once
+	fleetMinRefreshDelay = 5 * time.Second
+)
+
+// Data points shown as latest readings in the fleet overview
+const (
+	fleetTemperaturePoint = "temperature"
+	fleetSpeedPoint       = "feature_speed_1_speed"
+)
+
+// FleetSnapshot is a tenant's cached fleet overview served to dashboards
+type FleetSnapshot struct {
+	GeneratedAt     time.Time              `json:"generated_at"`
+	RefreshInterval int                    `json:"refresh_interval"` // seconds
+	Devices         []*models.DeviceStatus `json:"devices"`
+}
+
+var (
+	fleetMutex     sync.RWMutex
+	fleetSnapshots = map[string]*FleetSnapshot{} // by tenant ID
+	fleetRefresh   sync.Mutex                    // serialises refreshes
+	fleetStop      chan struct{}
+	fleetDone      chan struct{}
+)
+
+// StartFleetMonitor refreshes every tenant's fleet snapshot in the background
+func StartFleetMonitor() {
+	interval := fleetRefreshInterval()
+	fleetStop = make(chan struct{})
+	fleetDone = make(chan struct{})
+
+	go func() {
+		defer close(fleetDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			refreshFleetSnapshots()
+			select {
+			case <-ticker.C:
+			case <-fleetStop:
+				return
+			}
+		}
+	}()
+	log.Printf("Refreshing fleet overview every %s", interval)
+}
+
+// StopFleetMonitor stops the background refresh and waits for it to finish
+func StopFleetMonitor() {
+	if fleetStop != nil {
+		close(fleetStop)
+		<-fleetDone
+		fleetStop = nil
+	}
+}
+
+// refreshFleetSnapshots rebuilds the fleet overview of every tenant and
+// drops the snapshots of deleted tenants
+func refreshFleetSnapshots() {
+	tenants, err := models.GetTenants()
+	if err != nil {
+		log.Printf("Failed to refresh fleet snapshots: %v", err)
+		return
+	}
+
+	current := map[string]bool{}
+	for _, tenant := range tenants {
+		current[tenant.ID] = true
+		if _, err := RefreshFleetSnapshot(tenant); err != nil {
+			log.Printf("Failed to refresh fleet snapshot of tenant %s: %v", tenant.ID, err)
+		}
+	}
+
+	fleetMutex.Lock()
+	for id := range fleetSnapshots {
+		if !current[id] {
+			delete(fleetSnapshots, id)
+		}
+	}
+	fleetMutex.Unlock()
+}
+
+// GetFleetSnapshot returns a tenant's cached fleet overview, building it on
+// first use
+func GetFleetSnapshot(tenant *models.Tenant) (*FleetSnapshot, error) {
+	fleetMutex.RLock()
+	snapshot := fleetSnapshots[tenant.ID]
+	fleetMutex.RUnlock()
+
+	if snapshot != nil {
+		return snapshot, nil
+	}
+	return RefreshFleetSnapshot(tenant)
+}
+
+// RefreshFleetSnapshot rebuilds a tenant's fleet overview from the database
+// and the IoT platform. Readings that cannot be fetched keep their previous
+// value and raise an iot_unavailable alert.
+func RefreshFleetSnapshot(tenant *models.Tenant) (*FleetSnapshot, error) {
+	fleetRefresh.Lock()
+	defer fleetRefresh.Unlock()
+
+	iot := IotServiceFor(tenant)
+	now := time.Now()
+	devices, err := models.GetDeviceStatuses(tenant.ID, now, config.SiteLocation(), iot.DeviceCode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device states: %w", err)
+	}
+
+	fleetMutex.RLock()
+	previous := map[string]*models.DeviceStatus{}
+	if snapshot := fleetSnapshots[tenant.ID]; snapshot != nil {
+		for _, d := range snapshot.Devices {
+			previous[d.DeviceID] = d
+		}
+	}
+	fleetMutex.RUnlock()
+
+	points := map[string]models.IotDeviceDataPoint{}
+	for _, dp := range models.GetIotDataPoints() {
+		points[dp.Name] = dp
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, fleetIotConcurrency)
+	for _, d := range devices {
+		wg.Add(1)
+		go func(d *models.DeviceStatus) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prev := previous[d.DeviceID]
+			temperature, tempErr := iot.LatestValue(d.DeviceID, points[fleetTemperaturePoint], fleetReadingWindow)
+			speed, speedErr := iot.LatestValue(d.DeviceID, points[fleetSpeedPoint], fleetReadingWindow)
+
+			d.Temperature, d.Speed = temperature, speed
+			if tempErr != nil && prev != nil {
+				d.Temperature = prev.Temperature
+			}
+			if speedErr != nil && prev != nil {
+				d.Speed = prev.Speed
+			}
+
+			if err := tempErr; err != nil || speedErr != nil {
+				if err == nil {
+					err = speedErr
+				}
+				since := now
+				if prev != nil {
+					// Keep the time the outage was first seen
+					for _, a := range prev.Alerts {
+						if a.Type == models.AlertIotUnavailable {
+							since = a.Since
+						}
+					}
+				}
+				d.Alerts = append(d.Alerts, models.FleetAlert{
+					Type:    models.AlertIotUnavailable,
+					Message: err.Error(),
+					Since:   since,
+				})
+			}
+		}(d)
+	}
+	wg.Wait()
+
+	snapshot := &FleetSnapshot{
+		GeneratedAt:     now.In(config.SiteLocation()),
+		RefreshInterval: int(fleetRefreshInterval().Seconds()),
+		Devices:         devices,
+	}
+
+	fleetMutex.Lock()
+	fleetSnapshots[tenant.ID] = snapshot
+	fleetMutex.Unlock()
+
+	return snapshot, nil
+}
+
+func fleetRefreshInterval() time.Duration {
+	interval := time.Duration(config.Current().FleetRefreshSeconds) * time.Second
+	if interval < fleetMinRefreshDelay {
+		return fleetMinRefreshDelay
+	}
+	return interval
+}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"bytes"
-	"crypto/tls"
 	"device-monitor-go/config"
 	"device-monitor-go/models"
 	"encoding/json"
@@ -10,7 +9,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"strconv"
 	"sync"
 	"time"
@@ -18,30 +16,41 @@ import (
 
 type IotService struct {
 	httpClient  *http.Client
+	tenant      *models.Tenant // nil for the default tenant
 	accessToken string
 	tokenExpiry time.Time
 	tokenMutex  sync.RWMutex
 }
 
+// iotCredentials are the IoT platform settings a service authenticates with
+type iotCredentials struct {
+	BaseURL    string
+	AppKey     string
+	AppSecret  string
+	DeviceCode string
+}
+
 var iotServiceInstance *IotService
 var once sync.Once
 
+var (
+	tenantIotMutex    sync.Mutex
+	tenantIotServices = map[string]*IotService{}
+)
+
 // GetIotService returns singleton instance of IotService
 func GetIotService() *IotService {
 	once.Do(func() {
-		// Create HTTP client with proxy support if configured
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // For development/testing
-			},
+		cfg := config.Current()
+		transport, err := newIotTransport(cfg)
+		if err != nil {
+			// ValidateConfig rejects this at startup
+			log.Printf("Invalid IoT TLS settings, verifying against system roots only: %v", err)
 		}
-
-		// Configure proxy if set
-		if config.AppConfig.HttpProxy != "" || config.AppConfig.HttpsProxy != "" {
-			proxyURL, err := url.Parse(config.AppConfig.HttpsProxy)
-			if err == nil {
-				transport.Proxy = http.ProxyURL(proxyURL)
-			}
+		if cfg.IotTLSInsecure {
+			log.Println("WARNING: TLS certificate verification for the IoT platform is DISABLED " +
+				"(IOT_TLS_INSECURE_SKIP_VERIFY=true). Credentials and data can be intercepted; " +
+				"use IOT_TLS_CA_FILE for private certificate authorities instead.")
 		}
 
 		iotServiceInstance = &IotService{
@@ -50,10 +59,64 @@ func GetIotService() *IotService {
 				Timeout:   30 * time.Second,
 			},
 		}
+		if info := iotServiceInstance.ProxyInfo(); info.Proxy != "" {
+			log.Printf("IoT platform requests go through proxy %s (%s)", info.Proxy, info.Reason)
+		} else {
+			log.Printf("IoT platform requests go direct (%s)", info.Reason)
+		}
 	})
 	return iotServiceInstance
 }
 
+// IotServiceFor returns the IoT platform client of a tenant. The default
+// tenant uses GetIotService; other tenants share its transport but keep
+// their own credentials and access token. A client is replaced when its
+// tenant's credentials change.
+func IotServiceFor(tenant *models.Tenant) *IotService {
+	if tenant == nil || tenant.IsDefault() {
+		return GetIotService()
+	}
+
+	candidate := &IotService{httpClient: GetIotService().httpClient, tenant: tenant}
+
+	tenantIotMutex.Lock()
+	defer tenantIotMutex.Unlock()
+	if s, ok := tenantIotServices[tenant.ID]; ok && s.credentials() == candidate.credentials() {
+		return s
+	}
+	tenantIotServices[tenant.ID] = candidate
+	return candidate
+}
+
+// credentials returns the IoT settings of the service's tenant. Only the
+// platform URL falls back to IOT_API_BASE_URL, so a tenant without its own
+// credentials can never query the devices of the default tenant.
+func (s *IotService) credentials() iotCredentials {
+	c := config.Current()
+	if s.tenant == nil {
+		return iotCredentials{c.IotApiBaseURL, c.IotAppKey, c.IotAppSecret, c.IotDeviceCode}
+	}
+
+	creds := iotCredentials{s.tenant.IotAPIBaseURL, s.tenant.IotAppKey, s.tenant.IotAppSecret, s.tenant.IotDeviceCode}
+	if creds.BaseURL == "" {
+		creds.BaseURL = c.IotApiBaseURL
+	}
+	return creds
+}
+
+// DeviceCode returns the tenant's default IoT device code
+func (s *IotService) DeviceCode() string {
+	return s.credentials().DeviceCode
+}
+
+// resetToken drops the cached access token so the next request
+// authenticates with the current credentials
+func (s *IotService) resetToken() {
+	s.tokenMutex.Lock()
+	s.accessToken = ""
+	s.tokenMutex.Unlock()
+}
+
 // getAccessToken retrieves or refreshes OAuth access token
 func (s *IotService) getAccessToken() (string, error) {
 	s.tokenMutex.RLock()
@@ -73,15 +136,20 @@ func (s *IotService) getAccessToken() (string, error) {
 		return s.accessToken, nil
 	}
 
+	creds := s.credentials()
+	if s.tenant != nil && creds.AppKey == "" {
+		return "", fmt.Errorf("IoT credentials are not configured for tenant %s", s.tenant.ID)
+	}
+
 	// Get new token - matching Node.js implementation
-	tokenURL := fmt.Sprintf("%s/api/v1/oauth/auth", config.AppConfig.IotApiBaseURL)
-	
+	tokenURL := fmt.Sprintf("%s/api/v1/oauth/auth", creds.BaseURL)
+
 	// Create JSON payload
 	payload := map[string]string{
-		"appId":     config.AppConfig.IotAppKey,
-		"appSecret": config.AppConfig.IotAppSecret,
+		"appId":     creds.AppKey,
+		"appSecret": creds.AppSecret,
 	}
-	
+
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal auth payload: %w", err)
@@ -134,21 +202,23 @@ func (s *IotService) QueryDeviceData(deviceCode, dataPoint string, startTime, en
 	}
 
 	// Build query URL - matching Node.js implementation
-	queryURL := fmt.Sprintf("%s/api/v1/thing/queryDevicePropertiesData", config.AppConfig.IotApiBaseURL)
+	queryURL := fmt.Sprintf("%s/api/v1/thing/queryDevicePropertiesData", s.credentials().BaseURL)
 
-	// Prepare request body - use formatted strings like Node.js version
+	// Prepare request body - use formatted strings like Node.js version,
+	// expressed in the site timezone rather than the server's
+	loc := config.SiteLocation()
 	requestBody := map[string]interface{}{
 		"deviceName": deviceCode,
 		"identifier": []string{dataPoint},
-		"startTime":  startTime.Format("2006-01-02 15:04:05"),
-		"endTime":    endTime.Format("2006-01-02 15:04:05"),
+		"startTime":  startTime.In(loc).Format("2006-01-02 15:04:05"),
+		"endTime":    endTime.In(loc).Format("2006-01-02 15:04:05"),
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
-	
+
 	log.Printf("Query request URL: %s", queryURL)
 	log.Printf("Query request body: %s", string(jsonBody))
 
@@ -177,7 +247,7 @@ func (s *IotService) QueryDeviceData(deviceCode, dataPoint string, startTime, en
 		s.tokenMutex.Lock()
 		s.accessToken = ""
 		s.tokenMutex.Unlock()
-		
+
 		var errResp models.IotErrorResponse
 		json.Unmarshal(body, &errResp)
 		return nil, fmt.Errorf("authentication failed: %s", errResp.Message)
@@ -189,7 +259,7 @@ func (s *IotService) QueryDeviceData(deviceCode, dataPoint string, startTime, en
 
 	// Log response for debugging
 	log.Printf("IoT query response status: %d, body length: %d", resp.StatusCode, len(body))
-	
+
 	// Parse response
 	var dataResp map[string]interface{}
 	if err := json.Unmarshal(body, &dataResp); err != nil {
@@ -251,7 +321,7 @@ func (s *IotService) QueryDeviceData(deviceCode, dataPoint string, startTime, en
 func (s *IotService) SyncSessionData(session *models.DeviceSession) (map[string]interface{}, error) {
 	deviceCode := session.DeviceID
 	if deviceCode == "" {
-		deviceCode = config.AppConfig.IotDeviceCode
+		deviceCode = s.DeviceCode()
 	}
 
 	// For running sessions, use current time as end time
@@ -261,13 +331,13 @@ func (s *IotService) SyncSessionData(session *models.DeviceSession) (map[string]
 	}
 
 	// Log the query parameters
-	log.Printf("Syncing IoT data for device %s, session %s, time range: %s to %s", 
+	log.Printf("Syncing IoT data for device %s, session %s, time range: %s to %s",
 		deviceCode, session.SessionID, session.StartTime, endTime)
 
 	// Query all data points
 	dataPoints := models.GetIotDataPoints()
 	results := make(map[string]interface{})
-	
+
 	// Use goroutines to query multiple data points concurrently
 	var wg sync.WaitGroup
 	var mu sync.Mutex
@@ -283,7 +353,7 @@ func (s *IotService) SyncSessionData(session *models.DeviceSession) (map[string]
 			if err != nil {
 				log.Printf("Error querying %s: %v", dataPoint.Name, err)
 				errChan <- fmt.Errorf("failed to query %s: %w", dataPoint.Name, err)
-				
+
 				// Still add empty data for this point
 				mu.Lock()
 				results[dataPoint.Name] = map[string]interface{}{
@@ -300,7 +370,7 @@ func (s *IotService) SyncSessionData(session *models.DeviceSession) (map[string]
 
 			// Process data
 			processedData := s.processDataPoints(resp.Data.List, dataPoint)
-			
+
 			mu.Lock()
 			results[dataPoint.Name] = map[string]interface{}{
 				"displayName": dataPoint.DisplayName,
@@ -336,20 +406,7 @@ func (s *IotService) processDataPoints(items []models.IotDataItem, dataPoint mod
 	processed := []map[string]interface{}{}
 
 	for _, item := range items {
-		// Convert timestamp
-		var timestamp time.Time
-		switch t := item.Time.(type) {
-		case float64:
-			timestamp = time.UnixMilli(int64(t))
-		case string:
-			if ts, err := strconv.ParseInt(t, 10, 64); err == nil {
-				if len(t) == 13 { // Milliseconds
-					timestamp = time.UnixMilli(ts)
-				} else { // Seconds
-					timestamp = time.Unix(ts, 0)
-				}
-			}
-		}
+		timestamp := parseIotTime(item.Time)
 
 		// Process value based on type
 		var value interface{}
@@ -379,7 +436,7 @@ func (s *IotService) processDataPoints(items []models.IotDataItem, dataPoint mod
 		}
 
 		processed = append(processed, map[string]interface{}{
-			"time":  timestamp.Format(time.RFC3339),
+			"time":  timestamp.In(config.SiteLocation()).Format(time.RFC3339),
 			"value": value,
 		})
 	}
@@ -387,8 +444,65 @@ func (s *IotService) processDataPoints(items []models.IotDataItem, dataPoint mod
 	return processed
 }
 
+// parseIotTime converts an IoT platform timestamp in unix seconds or milliseconds
+func parseIotTime(value interface{}) time.Time {
+	var timestamp time.Time
+	switch t := value.(type) {
+	case float64:
+		timestamp = time.UnixMilli(int64(t))
+	case string:
+		if ts, err := strconv.ParseInt(t, 10, 64); err == nil {
+			if len(t) == 13 { // Milliseconds
+				timestamp = time.UnixMilli(ts)
+			} else { // Seconds
+				timestamp = time.Unix(ts, 0)
+			}
+		}
+	}
+	return timestamp
+}
+
+// LatestValue returns the most recent numeric value of a data point reported
+// within the window before now, or nil if there is none
+func (s *IotService) LatestValue(deviceCode string, dataPoint models.IotDeviceDataPoint, window time.Duration) (*models.FleetReading, error) {
+	now := time.Now()
+	resp, err := s.QueryDeviceData(deviceCode, dataPoint.Name, now.Add(-window), now)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *models.FleetReading
+	for _, item := range resp.Data.List {
+		timestamp := parseIotTime(item.Time)
+		if timestamp.IsZero() || (latest != nil && !timestamp.After(latest.Time)) {
+			continue
+		}
+
+		var value float64
+		switch v := item.Value.(type) {
+		case float64:
+			value = v
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			value = f
+		default:
+			continue
+		}
+
+		latest = &models.FleetReading{
+			Value: value,
+			Unit:  dataPoint.Unit,
+			Time:  timestamp.In(config.SiteLocation()),
+		}
+	}
+	return latest, nil
+}
+
 // TestConnection tests the IoT platform connection
 func (s *IotService) TestConnection() error {
 	_, err := s.getAccessToken()
 	return err
-}
\ No newline at end of file
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"device-monitor-go/config"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// IotProxyInfo describes how requests to the IoT platform are routed
+type IotProxyInfo struct {
+	Target string `json:"target"`
+	// Proxy is the proxy URL with any password masked, or empty when
+	// requests go direct
+	Proxy string `json:"proxy"`
+	// Reason names the setting that decided the route
+	Reason string `json:"reason"`
+}
+
+// iotProxyFunc selects a proxy per request URL the way Go's
+// http.ProxyFromEnvironment does, but from the loaded configuration:
+// HTTPS_PROXY for https URLs, HTTP_PROXY for http URLs, and no proxy for
+// hosts matched by NO_PROXY or for localhost
+func iotProxyFunc(c *config.Config) func(*url.URL) (*url.URL, error) {
+	return (&httpproxy.Config{
+		HTTPProxy:  c.HttpProxy,
+		HTTPSProxy: c.HttpsProxy,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+}
+
+// IotTLSInfo describes the TLS settings of IoT platform requests
+type IotTLSInfo struct {
+	Verify            bool   `json:"verify"`
+	CAFile            string `json:"ca_file,omitempty"`
+	ClientCertificate bool   `json:"client_certificate"`
+}
+
+// iotTLSConfig builds the TLS settings for IoT platform requests. Server
+// certificates are verified unless IOT_TLS_INSECURE_SKIP_VERIFY is set.
+func iotTLSConfig(c *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.IotTLSCAFile != "" {
+		pem, err := os.ReadFile(c.IotTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		// The bundle adds to the system roots rather than replacing them
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", c.IotTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.IotTLSCertFile != "" || c.IotTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.IotTLSCertFile, c.IotTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	tlsConfig.InsecureSkipVerify = c.IotTLSInsecure
+	return tlsConfig, nil
+}
+
+// newIotTransport builds the transport for IoT platform requests from the
+// default transport, keeping its timeouts and HTTP/2 support. If the TLS
+// settings are invalid the error is returned with a transport that verifies
+// against the system roots, so verification is never silently dropped.
+func newIotTransport(c *config.Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxy := iotProxyFunc(c)
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+
+	tlsConfig, err := iotTLSConfig(c)
+	if err != nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		return transport, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// describeIotProxy reports the proxy used for requests to target
+func describeIotProxy(c *config.Config, target string) IotProxyInfo {
+	info := IotProxyInfo{Target: target}
+	u, err := url.Parse(target)
+	if err != nil {
+		info.Reason = "invalid target URL"
+		return info
+	}
+
+	setting, configured := "HTTP_PROXY", c.HttpProxy
+	if u.Scheme == "https" {
+		setting, configured = "HTTPS_PROXY", c.HttpsProxy
+	}
+
+	proxy, err := iotProxyFunc(c)(u)
+	if err == nil {
+		err = checkProxySetting(configured)
+	}
+	switch {
+	case configured == "":
+		info.Reason = setting + " not set"
+	case err != nil:
+		info.Reason = "invalid " + setting + ": " + err.Error()
+	case proxy != nil:
+		info.Proxy = proxy.Redacted()
+		info.Reason = setting
+	case configured != "":
+		info.Reason = "host excluded by NO_PROXY or local"
+	}
+	return info
+}
+
+// checkProxySetting reports whether a proxy setting parses, either as a
+// URL or as a host with http:// implied. httpproxy ignores unparseable
+// settings, which would otherwise look like NO_PROXY exclusions.
+func checkProxySetting(setting string) error {
+	if setting == "" {
+		return nil
+	}
+	if _, err := url.Parse(setting); err == nil {
+		return nil
+	}
+	_, err := url.Parse("http://" + setting)
+	return err
+}
+
+// TLSInfo reports the TLS settings of IoT platform requests
+func (s *IotService) TLSInfo() IotTLSInfo {
+	c := config.Current()
+	return IotTLSInfo{
+		Verify:            !c.IotTLSInsecure,
+		CAFile:            c.IotTLSCAFile,
+		ClientCertificate: c.IotTLSCertFile != "",
+	}
+}
+
+// ProxyInfo reports how requests to the IoT platform are routed
+func (s *IotService) ProxyInfo() IotProxyInfo {
+	return describeIotProxy(config.Current(), s.credentials().BaseURL)
+}
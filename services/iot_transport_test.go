@@ -0,0 +1,201 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"device-monitor-go/config"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadIotTLSConfig loads the configuration with the given IOT_TLS_* settings;
+// settings left out are cleared
+func loadIotTLSConfig(t *testing.T, env map[string]string) *config.Config {
+	t.Helper()
+	for _, key := range []string{"IOT_TLS_CA_FILE", "IOT_TLS_CERT_FILE", "IOT_TLS_KEY_FILE", "IOT_TLS_INSECURE_SKIP_VERIFY"} {
+		t.Setenv(key, env[key])
+	}
+	c, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// writePEM writes PEM blocks to a file in dir and returns its path
+func writePEM(t *testing.T, dir, name string, blocks ...*pem.Block) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, b := range blocks {
+		if err := pem.Encode(f, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// serverCAFile writes the certificate of a httptest TLS server as a CA bundle
+func serverCAFile(t *testing.T, srv *httptest.Server) string {
+	return writePEM(t, t.TempDir(), "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+// newClientCert creates a self-signed client certificate and writes it and
+// its key to PEM files
+func newClientCert(t *testing.T, commonName string) (cert *x509.Certificate, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = writePEM(t, dir, "client.pem", &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyFile = writePEM(t, dir, "client-key.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return cert, certFile, keyFile
+}
+
+// newMTLSServer starts a TLS server that requires a client certificate
+// signed by clientCA and answers with the certificate's common name
+func newMTLSServer(t *testing.T, clientCA *x509.Certificate) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCA)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// iotGet requests url through the IoT platform transport built from c
+func iotGet(t *testing.T, c *config.Config, url string) (string, error) {
+	t.Helper()
+	transport, err := newIotTransport(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport, Timeout: 10 * time.Second}).Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestIotTransportVerifiesByDefault(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := iotGet(t, loadIotTLSConfig(t, nil), srv.URL)
+	var verifyErr *tls.CertificateVerificationError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("request to an unknown CA: got %v, want a certificate verification error", err)
+	}
+}
+
+func TestIotTransportCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := loadIotTLSConfig(t, map[string]string{"IOT_TLS_CA_FILE": serverCAFile(t, srv)})
+	if body, err := iotGet(t, c, srv.URL); err != nil || body != "ok" {
+		t.Fatalf("request with IOT_TLS_CA_FILE: got %q, %v", body, err)
+	}
+}
+
+func TestIotTransportClientCertificate(t *testing.T) {
+	clientCert, certFile, keyFile := newClientCert(t, "device-monitor")
+	srv := newMTLSServer(t, clientCert)
+	caFile := serverCAFile(t, srv)
+
+	c := loadIotTLSConfig(t, map[string]string{
+		"IOT_TLS_CA_FILE":   caFile,
+		"IOT_TLS_CERT_FILE": certFile,
+		"IOT_TLS_KEY_FILE":  keyFile,
+	})
+	if body, err := iotGet(t, c, srv.URL); err != nil || body != "device-monitor" {
+		t.Fatalf("request with a client certificate: got %q, %v", body, err)
+	}
+
+	c = loadIotTLSConfig(t, map[string]string{"IOT_TLS_CA_FILE": caFile})
+	if _, err := iotGet(t, c, srv.URL); err == nil {
+		t.Fatal("request without a client certificate succeeded")
+	}
+}
+
+func TestIotTransportInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := loadIotTLSConfig(t, map[string]string{"IOT_TLS_INSECURE_SKIP_VERIFY": "true"})
+	if body, err := iotGet(t, c, srv.URL); err != nil || body != "ok" {
+		t.Fatalf("request with IOT_TLS_INSECURE_SKIP_VERIFY: got %q, %v", body, err)
+	}
+}
+
+func TestValidateConfigRejectsInvalidTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, certFile, _ := newClientCert(t, "client")
+	_, _, otherKeyFile := newClientCert(t, "other")
+
+	for name, env := range map[string]map[string]string{
+		"missing CA bundle":   {"IOT_TLS_CA_FILE": filepath.Join(dir, "missing.pem")},
+		"CA bundle not PEM":   {"IOT_TLS_CA_FILE": notPEM},
+		"mismatched key pair": {"IOT_TLS_CERT_FILE": certFile, "IOT_TLS_KEY_FILE": otherKeyFile},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateConfig(loadIotTLSConfig(t, env)); err == nil {
+				t.Fatal("ValidateConfig accepted invalid TLS settings")
+			}
+		})
+	}
+}
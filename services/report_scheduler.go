@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"device-monitor-go/config"
+	"device-monitor-go/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var reportCron *cron.Cron
+
+// StartReportScheduler schedules daily and weekly summary reports for every tenant
+func StartReportScheduler() error {
+	// Cron times are interpreted in the site timezone
+	c := cron.New(cron.WithLocation(config.SiteLocation()))
+
+	cfg := config.Current()
+	schedules := map[string]string{
+		models.ReportPeriodDaily:  cfg.ReportDailyCron,
+		models.ReportPeriodWeekly: cfg.ReportWeeklyCron,
+	}
+	for period, spec := range schedules {
+		if spec == "" {
+			continue
+		}
+
+		period := period
+		if _, err := c.AddFunc(spec, func() {
+			tenants, err := models.GetTenants()
+			if err != nil {
+				log.Printf("Failed to generate %s reports: %v", period, err)
+				return
+			}
+			for _, tenant := range tenants {
+				if _, err := GenerateSummaryReport(tenant, period, time.Now()); err != nil {
+					log.Printf("Failed to generate %s report of tenant %s: %v", period, tenant.ID, err)
+				}
+			}
+		}); err != nil {
+			return fmt.Errorf("invalid %s report schedule %q: %w", period, spec, err)
+		}
+		log.Printf("Scheduled %s summary report at %q", period, spec)
+	}
+
+	c.Start()
+	reportCron = c
+	return nil
+}
+
+// StopReportScheduler stops the scheduler and waits for running jobs
+func StopReportScheduler() {
+	if reportCron != nil {
+		<-reportCron.Stop().Done()
+		reportCron = nil
+	}
+}
+
+// ReportWindow returns the most recent complete period before now
+func ReportWindow(period string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case models.ReportPeriodDaily:
+		return today.AddDate(0, 0, -1), today, nil
+	case models.ReportPeriodWeekly:
+		// Weeks start on Monday
+		offset := (int(today.Weekday()) + 6) % 7
+		end := today.AddDate(0, 0, -offset)
+		return end.AddDate(0, 0, -7), end, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown report period: %s", period)
+}
+
+// GenerateSummaryReport builds, stores and delivers a tenant's report for
+// the period preceding now
+func GenerateSummaryReport(tenant *models.Tenant, period string, now time.Time) (*models.ReportSnapshot, error) {
+	start, end, err := ReportWindow(period, now.In(config.SiteLocation()))
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := models.BuildSummaryReport(tenant.ID, period, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build report: %w", err)
+	}
+
+	snapshot, err := models.SaveReportSnapshot(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save report: %w", err)
+	}
+	log.Printf("Generated %s report %d of tenant %s for %s - %s", period, snapshot.ID, tenant.ID,
+		start.Format("2006-01-02"), end.Format("2006-01-02"))
+
+	if url := reportWebhookURL(tenant); url != "" {
+		if err := deliverReport(url, snapshot); err != nil {
+			// The snapshot is stored either way; delivery can be retried manually
+			log.Printf("Failed to deliver report %d: %v", snapshot.ID, err)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// reportWebhookURL returns where a tenant's reports are delivered; only the
+// default tenant uses REPORT_WEBHOOK_URL
+func reportWebhookURL(tenant *models.Tenant) string {
+	if tenant.IsDefault() {
+		return config.Current().ReportWebhookURL
+	}
+	return tenant.ReportWebhookURL
+}
+
+// deliverReport posts a report snapshot to a webhook
+func deliverReport(url string, snapshot *models.ReportSnapshot) error {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(data))
+	}
+
+	now := time.Now()
+	snapshot.DeliveredAt = &now
+	return models.MarkReportDelivered(snapshot.ID, now)
+}
@@ -0,0 +1,438 @@
+package services
+
+import (
+	"bytes"
+	"device-monitor-go/config"
+	"device-monitor-go/models"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+//go:embed templates/report.html
+var reportTemplates embed.FS
+
+// Files looked up in the report template directory
+const (
+	reportTemplateFile = "report.html"
+	reportBrandingFile = "branding.json"
+	reportLogoFile     = "logo.png"
+	reportFontFile     = "font.ttf"
+
+	defaultReportTitle = "设备运行报告"
+)
+
+// ReportBranding holds the customizable parts of a printable report
+type ReportBranding struct {
+	Title       string `json:"title"`
+	Company     string `json:"company"`
+	Footer      string `json:"footer"`
+	AccentColor string `json:"accentColor"`
+
+	// Resolved from the template directory, not from branding.json
+	LogoPath string `json:"-"`
+	FontPath string `json:"-"`
+}
+
+// ReportSample is a single numeric value of a report chart
+type ReportSample struct {
+	Time  time.Time
+	Value float64
+}
+
+// ReportPoint holds the summary and chart data of one data point
+type ReportPoint struct {
+	Name        string
+	DisplayName string
+	Unit        string
+	Count       int
+	MinValue    float64
+	MaxValue    float64
+	AvgValue    float64
+	Samples     []ReportSample
+}
+
+// SessionReport is everything needed to render a printable session report
+type SessionReport struct {
+	Session     *models.DeviceSession
+	Duration    time.Duration
+	GeneratedAt time.Time
+	Points      []ReportPoint
+	Annotations []*models.SessionAnnotation
+	Tags        []*models.SessionTag
+	Branding    ReportBranding
+}
+
+// TagNames returns the names of the session's tags
+func (r *SessionReport) TagNames() string {
+	names := make([]string, len(r.Tags))
+	for i, t := range r.Tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// LoadReportBranding reads branding settings from the report template directory
+func LoadReportBranding() ReportBranding {
+	branding := ReportBranding{
+		Title:       defaultReportTitle,
+		AccentColor: "#409eff",
+	}
+
+	dir := config.Current().ReportTemplateDir
+	if dir == "" {
+		return branding
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, reportBrandingFile)); err == nil {
+		if err := json.Unmarshal(data, &branding); err != nil {
+			log.Printf("Invalid %s in %s: %v", reportBrandingFile, dir, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, reportLogoFile)); err == nil {
+		branding.LogoPath = filepath.Join(dir, reportLogoFile)
+	}
+	if _, err := os.Stat(filepath.Join(dir, reportFontFile)); err == nil {
+		branding.FontPath = filepath.Join(dir, reportFontFile)
+	}
+
+	return branding
+}
+
+// SortedMetadataKeys returns the session metadata keys in a stable order
+func (r *SessionReport) SortedMetadataKeys() []string {
+	keys := make([]string, 0, len(r.Session.MetadataObj))
+	for k := range r.Session.MetadataObj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RenderReportHTML renders a self-contained HTML report
+func RenderReportHTML(w io.Writer, report *SessionReport) error {
+	tmpl := template.New(reportTemplateFile).Funcs(template.FuncMap{
+		"formatTime":     formatReportTime,
+		"formatDuration": formatReportDuration,
+		"formatValue":    formatReportValue,
+		"chartPoints":    chartPoints,
+		"logoDataURI":    logoDataURI,
+		"metadataValue": func(v interface{}) string {
+			return formatExportValue(v)
+		},
+	})
+
+	var err error
+	customTemplate := ""
+	if dir := config.Current().ReportTemplateDir; dir != "" {
+		customTemplate = filepath.Join(dir, reportTemplateFile)
+		if _, statErr := os.Stat(customTemplate); statErr != nil {
+			customTemplate = ""
+		}
+	}
+
+	if customTemplate != "" {
+		tmpl, err = tmpl.ParseFiles(customTemplate)
+	} else {
+		tmpl, err = tmpl.ParseFS(reportTemplates, "templates/"+reportTemplateFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse report template: %w", err)
+	}
+
+	// Render into a buffer so template errors don't leave a partial response
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, report); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// RenderReportPDF renders the report as a PDF document using fpdf
+func RenderReportPDF(w io.Writer, report *SessionReport) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+
+	// Core PDF fonts only cover Latin text; a TTF in the template directory
+	// enables Chinese display names and metadata
+	fontFamily := "Helvetica"
+	unicode := false
+	if report.Branding.FontPath != "" {
+		pdf.AddUTF8Font("report", "", report.Branding.FontPath)
+		pdf.AddUTF8Font("report", "B", report.Branding.FontPath)
+		fontFamily = "report"
+		unicode = true
+	}
+	tr := func(s string) string { return s }
+	if !unicode {
+		tr = pdf.UnicodeTranslatorFromDescriptor("")
+	}
+	label := func(p ReportPoint) string {
+		if unicode && p.DisplayName != "" {
+			return p.DisplayName
+		}
+		return p.Name
+	}
+
+	accentR, accentG, accentB := parseHexColor(report.Branding.AccentColor)
+	title := report.Branding.Title
+	if !unicode && title == defaultReportTitle {
+		title = "Device Session Report"
+	}
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont(fontFamily, "", 8)
+		pdf.SetTextColor(128, 128, 128)
+		footer := fmt.Sprintf("Page %d", pdf.PageNo())
+		if report.Branding.Footer != "" {
+			footer = tr(report.Branding.Footer) + "  -  " + footer
+		}
+		pdf.CellFormat(0, 8, footer, "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+
+	// Header
+	if report.Branding.LogoPath != "" {
+		pdf.ImageOptions(report.Branding.LogoPath, 15, 12, 0, 12, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+		pdf.SetY(27)
+	}
+	pdf.SetFont(fontFamily, "B", 18)
+	pdf.SetTextColor(accentR, accentG, accentB)
+	pdf.CellFormat(0, 10, tr(title), "", 1, "L", false, 0, "")
+	if report.Branding.Company != "" {
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.SetTextColor(96, 96, 96)
+		pdf.CellFormat(0, 6, tr(report.Branding.Company), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Session details
+	pdf.SetTextColor(0, 0, 0)
+	section := func(name string) {
+		pdf.Ln(2)
+		pdf.SetFont(fontFamily, "B", 12)
+		pdf.SetDrawColor(accentR, accentG, accentB)
+		pdf.CellFormat(0, 8, tr(name), "B", 1, "L", false, 0, "")
+		pdf.Ln(2)
+		pdf.SetFont(fontFamily, "", 10)
+	}
+	row := func(key, value string) {
+		pdf.SetFont(fontFamily, "B", 10)
+		pdf.CellFormat(45, 6, tr(key), "", 0, "L", false, 0, "")
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.MultiCell(0, 6, tr(value), "", "L", false)
+	}
+
+	session := report.Session
+	section("Session")
+	row("Session ID", session.SessionID)
+	row("Device", session.DeviceID)
+	row("Status", session.Status)
+	row("Start time", formatReportTime(session.StartTime))
+	if session.EndTime != nil {
+		row("End time", formatReportTime(*session.EndTime))
+	}
+	row("Duration", formatReportDuration(report.Duration))
+	for _, key := range report.SortedMetadataKeys() {
+		row(key, formatExportValue(session.MetadataObj[key]))
+	}
+	if len(report.Tags) > 0 {
+		row("Tags", report.TagNames())
+	}
+
+	// Operator notes and markers
+	if len(report.Annotations) > 0 {
+		section("Notes")
+		for _, a := range report.Annotations {
+			when := formatReportTime(a.CreatedAt)
+			if a.MarkerTime != nil {
+				when = formatReportTime(*a.MarkerTime)
+			}
+			if a.Author != "" {
+				when += "  " + a.Author
+			}
+			row(when, a.Body)
+		}
+	}
+
+	// Summary table
+	section("Summary")
+	widths := []float64{50, 20, 25, 25, 25, 35}
+	headers := []string{"Point", "Count", "Min", "Max", "Average", "Unit"}
+	pdf.SetFont(fontFamily, "B", 10)
+	pdf.SetFillColor(240, 240, 240)
+	for i, h := range headers {
+		pdf.CellFormat(widths[i], 7, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont(fontFamily, "", 10)
+	for _, p := range report.Points {
+		cells := []string{label(p), strconv.Itoa(p.Count), formatReportValue(p.MinValue),
+			formatReportValue(p.MaxValue), formatReportValue(p.AvgValue), p.Unit}
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 || i == 5 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 7, tr(cell), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	// Charts
+	for _, p := range report.Points {
+		if len(p.Samples) < 2 {
+			continue
+		}
+		if pdf.GetY() > 210 {
+			pdf.AddPage()
+		}
+		section(fmt.Sprintf("%s (%s)", label(p), p.Unit))
+		drawPDFChart(pdf, p, 15, pdf.GetY(), 180, 55, accentR, accentG, accentB)
+		pdf.SetY(pdf.GetY() + 60)
+	}
+
+	// Sign-off
+	if pdf.GetY() > 240 {
+		pdf.AddPage()
+	}
+	section("Sign-off")
+	pdf.Ln(8)
+	for _, who := range []string{"Operator", "Reviewer"} {
+		pdf.CellFormat(30, 6, who, "", 0, "L", false, 0, "")
+		pdf.CellFormat(70, 6, "", "B", 0, "L", false, 0, "")
+		pdf.CellFormat(15, 6, "Date", "", 0, "R", false, 0, "")
+		pdf.CellFormat(45, 6, "", "B", 1, "L", false, 0, "")
+		pdf.Ln(8)
+	}
+
+	pdf.SetFont(fontFamily, "", 8)
+	pdf.SetTextColor(128, 128, 128)
+	pdf.CellFormat(0, 6, "Generated "+formatReportTime(report.GeneratedAt), "", 1, "L", false, 0, "")
+
+	return pdf.Output(w)
+}
+
+// drawPDFChart draws a simple line chart of a point's samples
+func drawPDFChart(pdf *fpdf.Fpdf, p ReportPoint, x, y, width, height float64, r, g, b int) {
+	minV, maxV := p.MinValue, p.MaxValue
+	if maxV == minV {
+		maxV = minV + 1
+	}
+	start := p.Samples[0].Time
+	span := p.Samples[len(p.Samples)-1].Time.Sub(start).Seconds()
+	if span <= 0 {
+		span = 1
+	}
+
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.SetLineWidth(0.2)
+	pdf.Rect(x, y, width, height, "D")
+
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.SetTextColor(96, 96, 96)
+	pdf.Text(x+1, y+3, formatReportValue(maxV))
+	pdf.Text(x+1, y+height-1, formatReportValue(minV))
+	pdf.Text(x+width-20, y+height+4, formatReportDuration(time.Duration(span)*time.Second))
+
+	pdf.SetDrawColor(r, g, b)
+	pdf.SetLineWidth(0.4)
+	var prevX, prevY float64
+	for i, s := range p.Samples {
+		px := x + s.Time.Sub(start).Seconds()/span*width
+		py := y + height - (s.Value-minV)/(maxV-minV)*height
+		if i > 0 {
+			pdf.Line(prevX, prevY, px, py)
+		}
+		prevX, prevY = px, py
+	}
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// chartPoints renders samples as an SVG polyline points attribute
+func chartPoints(p ReportPoint, width, height float64) string {
+	if len(p.Samples) < 2 {
+		return ""
+	}
+
+	minV, maxV := p.MinValue, p.MaxValue
+	if maxV == minV {
+		maxV = minV + 1
+	}
+	start := p.Samples[0].Time
+	span := p.Samples[len(p.Samples)-1].Time.Sub(start).Seconds()
+	if span <= 0 {
+		span = 1
+	}
+
+	var sb strings.Builder
+	for i, s := range p.Samples {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		px := s.Time.Sub(start).Seconds() / span * width
+		py := height - (s.Value-minV)/(maxV-minV)*height
+		fmt.Fprintf(&sb, "%.1f,%.1f", px, py)
+	}
+	return sb.String()
+}
+
+// logoDataURI inlines the branding logo so the HTML stays self-contained
+func logoDataURI(path string) template.URL {
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))
+}
+
+func formatReportTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func formatReportDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+}
+
+func formatReportValue(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// parseHexColor parses #rrggbb, falling back to the default accent color
+func parseHexColor(hex string) (int, int, int) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)
+		}
+	}
+	return 0x40, 0x9e, 0xff
+}
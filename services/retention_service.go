@@ -0,0 +1,77 @@
+package services
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/models"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var retentionCron *cron.Cron
+
+// RetentionPolicies parses the configured IoT data retention policies
+func RetentionPolicies() (*models.RetentionPolicies, error) {
+	cfg := config.Current()
+	policies, err := models.ParseRetentionPolicies(cfg.TelemetryRetention, cfg.TelemetryRetentionPoints)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telemetry retention: %w", err)
+	}
+	return policies, nil
+}
+
+// StartTelemetryCompaction schedules the downsampling and removal of IoT
+// data past its retention
+func StartTelemetryCompaction() error {
+	policies, err := RetentionPolicies()
+	if err != nil {
+		return err
+	}
+	spec := config.Current().TelemetryCompactCron
+	if !policies.Enabled() || spec == "" || spec == "off" {
+		log.Println("Telemetry compaction disabled")
+		return nil
+	}
+
+	c := cron.New(cron.WithLocation(config.SiteLocation()))
+	if _, err := c.AddFunc(spec, func() {
+		if _, err := CompactTelemetry(time.Now()); err != nil {
+			log.Printf("Failed to compact telemetry: %v", err)
+		}
+	}); err != nil {
+		return fmt.Errorf("invalid telemetry compaction schedule %q: %w", spec, err)
+	}
+	log.Printf("Scheduled telemetry compaction at %q, %d point overrides", spec, len(policies.Points))
+
+	c.Start()
+	retentionCron = c
+	return nil
+}
+
+// StopTelemetryCompaction stops the compaction schedule and waits for a
+// running compaction
+func StopTelemetryCompaction() {
+	if retentionCron != nil {
+		<-retentionCron.Stop().Done()
+		retentionCron = nil
+	}
+}
+
+// CompactTelemetry applies the retention policies as of now
+func CompactTelemetry(now time.Time) (*models.CompactionResult, error) {
+	policies, err := RetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+	result, err := models.CompactTelemetry(policies, now)
+	if err != nil {
+		return nil, err
+	}
+	if result.RawRolledUp > 0 || result.MinuteRolledUp > 0 || result.HourDeleted > 0 || result.RawDeleted > 0 {
+		log.Printf("Compacted telemetry: %d raw points and %d minute rollups rolled up, %d hour rollups and %d points without a value deleted",
+			result.RawRolledUp, result.MinuteRolledUp, result.HourDeleted, result.RawDeleted)
+	}
+	return result, nil
+}
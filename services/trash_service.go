@@ -0,0 +1,60 @@
+package services
+
+import (
+	"device-monitor-go/config"
+	"device-monitor-go/models"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var trashCron *cron.Cron
+
+// StartTrashPurge schedules the permanent removal of sessions that have been
+// in the trash longer than the retention period
+func StartTrashPurge() error {
+	cfg := config.Current()
+	days := cfg.TrashRetentionDays
+	spec := cfg.TrashPurgeCron
+	if days <= 0 || spec == "" {
+		log.Println("Trash purge disabled")
+		return nil
+	}
+
+	c := cron.New(cron.WithLocation(config.SiteLocation()))
+	if _, err := c.AddFunc(spec, func() {
+		if _, err := PurgeTrash(time.Now()); err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		}
+	}); err != nil {
+		return fmt.Errorf("invalid trash purge schedule %q: %w", spec, err)
+	}
+	log.Printf("Scheduled trash purge at %q, retention %d days", spec, days)
+
+	c.Start()
+	trashCron = c
+	return nil
+}
+
+// StopTrashPurge stops the purge schedule and waits for a running purge
+func StopTrashPurge() {
+	if trashCron != nil {
+		<-trashCron.Stop().Done()
+		trashCron = nil
+	}
+}
+
+// PurgeTrash removes sessions deleted more than the retention period before now
+func PurgeTrash(now time.Time) (int, error) {
+	cutoff := now.AddDate(0, 0, -config.Current().TrashRetentionDays)
+	purged, err := models.PurgeDeletedSessions(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d sessions deleted before %s", purged, cutoff.Format(time.RFC3339))
+	}
+	return purged, nil
+}
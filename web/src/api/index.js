@@ -13,7 +13,11 @@ const api = axios.create({
 // Request interceptor
 api.interceptors.request.use(
   config => {
-    // Add auth token if needed
+    // Authenticate as the tenant whose API key is stored
+    const apiKey = localStorage.getItem('apiKey')
+    if (apiKey) {
+      config.headers['X-API-Key'] = apiKey
+    }
     return config
   },
   error => {
@@ -50,14 +54,181 @@ export const sessionAPI = {
     return api.get(`/sessions/${sessionId}/report`)
   },
   
+  // Compare several sessions aligned by time since start
+  compare(ids, params = {}) {
+    return api.get('/sessions/compare', { params: { ids: ids.join(','), ...params } })
+  },
+  
   // Get device statistics
   getStatistics(deviceId, params) {
     return api.get(`/sessions/device/${deviceId}/statistics`, { params })
   },
   
+  // Backfill a session manually
+  create(data) {
+    return api.post('/sessions', data)
+  },
+
+  // Correct a session; only the given fields change
+  update(sessionId, data) {
+    return api.patch(`/sessions/${sessionId}`, data)
+  },
+
   // Delete session
-  delete(sessionId) {
-    return api.delete(`/sessions/${sessionId}`)
+  delete(sessionId, reason) {
+    return api.delete(`/sessions/${sessionId}`, { params: { reason } })
+  },
+
+  // Bulk delete sessions matching list filters
+  deleteMany(params) {
+    return api.delete('/sessions', { params })
+  },
+
+  // Deleted sessions
+  getTrash(params) {
+    return api.get('/sessions/trash', { params })
+  },
+
+  // Restore a session from the trash
+  restore(sessionId, data = {}) {
+    return api.post(`/sessions/${sessionId}/restore`, data)
+  },
+
+  // Merge adjacent sessions of a device
+  merge(sessionIds, data = {}) {
+    return api.post('/sessions/merge', { session_ids: sessionIds, ...data })
+  },
+
+  // Split a session at a timestamp
+  split(sessionId, at, data = {}) {
+    return api.post(`/sessions/${sessionId}/split`, { at, ...data })
+  },
+
+  // Audit history of a session
+  getHistory(sessionId) {
+    return api.get(`/sessions/${sessionId}/history`)
+  },
+
+  // Session annotations
+  getAnnotations(sessionId) {
+    return api.get(`/sessions/${sessionId}/annotations`)
+  },
+
+  addAnnotation(sessionId, data) {
+    return api.post(`/sessions/${sessionId}/annotations`, data)
+  },
+
+  updateAnnotation(sessionId, annotationId, data) {
+    return api.put(`/sessions/${sessionId}/annotations/${annotationId}`, data)
+  },
+
+  deleteAnnotation(sessionId, annotationId) {
+    return api.delete(`/sessions/${sessionId}/annotations/${annotationId}`)
+  },
+
+  // Session tags
+  getTags(sessionId) {
+    return api.get(`/sessions/${sessionId}/tags`)
+  },
+
+  addTag(sessionId, tag, author) {
+    return api.post(`/sessions/${sessionId}/tags`, { tag, author })
+  },
+
+  removeTag(sessionId, tag) {
+    return api.delete(`/sessions/${sessionId}/tags/${encodeURIComponent(tag)}`)
+  }
+}
+
+// Tag vocabulary APIs
+export const tagAPI = {
+  list() {
+    return api.get('/tags')
+  },
+
+  create(data) {
+    return api.post('/tags', data)
+  },
+
+  update(tagId, data) {
+    return api.put(`/tags/${tagId}`, data)
+  },
+
+  delete(tagId) {
+    return api.delete(`/tags/${tagId}`)
+  }
+}
+
+// Audit log API
+export const auditAPI = {
+  getList(params) {
+    return api.get('/audit', { params })
+  }
+}
+
+// Admin APIs
+export const adminAPI = {
+  // Reload the server configuration
+  reload() {
+    return api.post('/admin/reload')
+  },
+
+  // Back up the database now
+  backup(params) {
+    return api.post('/admin/backup', null, { params })
+  },
+
+  // List database backups
+  getBackups() {
+    return api.get('/admin/backups')
+  },
+
+  // Get IoT data retention policies
+  getRetention() {
+    return api.get('/admin/retention')
+  },
+
+  // Apply the retention policies now
+  compactTelemetry() {
+    return api.post('/admin/retention/compact')
+  },
+
+  // List tenants
+  getTenants() {
+    return api.get('/admin/tenants')
+  },
+
+  // Create a tenant; its API key and webhook secret are returned once
+  createTenant(data) {
+    return api.post('/admin/tenants', data)
+  },
+
+  // Update a tenant
+  updateTenant(id, data) {
+    return api.patch(`/admin/tenants/${id}`, data)
+  },
+
+  // Delete a tenant without sessions
+  deleteTenant(id) {
+    return api.delete(`/admin/tenants/${id}`)
+  },
+
+  // Rotate a tenant's API key or webhook secret ('api-key' or 'webhook-secret')
+  rotateTenantSecret(id, kind) {
+    return api.post(`/admin/tenants/${id}/${kind}`)
+  },
+
+  // Revoke a tenant's API key or webhook secret
+  revokeTenantSecret(id, kind) {
+    return api.delete(`/admin/tenants/${id}/${kind}`)
+  }
+}
+
+// Fleet APIs
+export const fleetAPI = {
+  // Get current state of every device
+  get(params) {
+    return api.get('/fleet', { params })
   }
 }
 